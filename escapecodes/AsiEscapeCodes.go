@@ -1,5 +1,7 @@
 package escapecodes
 
+import "fmt"
+
 const (
 	DisableAlternativeScreenBuffer = "\x1b[?1049l"
 	EnableAlternativeScreenBuffer  = "\x1b[?1049h"
@@ -7,6 +9,41 @@ const (
 	EnableMouseTracking            = "\x1b[?1003h"
 	DisableMouseTracking           = "\x1b[?1003l"
 	DisableNormalMouseTracking     = "\x1b[?1000l"
+	EnableBracketedPaste           = "\x1b[?2004h"
+	DisableBracketedPaste          = "\x1b[?2004l"
+	BracketedPasteStart            = "\x1b[200~"
+	BracketedPasteEnd              = "\x1b[201~"
+
+	/**
+	 * The terminal sends FocusIn and FocusOut
+	 * when its window or tab gains or loses focus
+	 */
+	EnableFocusReporting  = "\x1b[?1004h"
+	DisableFocusReporting = "\x1b[?1004l"
+	FocusIn               = "\x1b[I"
+	FocusOut              = "\x1b[O"
+
+	/**
+	 * kitty keyboard protocol, flags 11 =
+	 * disambiguate (1) | report event types (2)
+	 * | report all keys as escape codes (8)
+	 */
+	PushKittyKeyboardFlags  = "\x1b[>11u"
+	PopKittyKeyboardFlags   = "\x1b[<u"
+	QueryKittyKeyboardFlags = "\x1b[?u"
+
+	/**
+	 * OSC 52, follow with base64 text
+	 * and end with StringTerminator
+	 */
+	SetClipboard     = "\x1b]52;c;"
+	StringTerminator = "\x07"
+
+	/**
+	 * kitty graphics protocol, APC G <keys>;<payload> ST
+	 */
+	KittyGraphicsStart = "\x1b_G"
+	KittyGraphicsEnd   = "\x1b\\"
 
 	HideCursor = "\x1b[?25l"
 	ShowCursor = "\x1b[?25h"
@@ -41,3 +78,10 @@ const (
 	ClearLine            = "\x1b[2K"
 	ClearLineAfterCursor = "\x1b[0K"
 )
+
+/**
+ * row and col start at 1
+ */
+func MoveCursor(row, col int) string {
+	return fmt.Sprintf("\x1b[%d;%dH", row, col)
+}
@@ -122,3 +122,33 @@ func DetectTerminal() (termInfo *C.ChafaTermInfo, mode C.ChafaCanvasMode, pixelM
 	mode = getCanvasMode(termInfo, pixelMode)
 	return
 }
+
+/**
+ * Returns nil unless the terminal speaks the kitty
+ * graphics protocol and we should encode frames ourselves.
+ */
+func DetectKittyGraphics(sessionTypeIsX11 bool) *KittyGraphics {
+	transmission, probe, native := getKittyTransmission()
+	if !native {
+		return nil
+	}
+	termInfo, _, pixelMode := DetectTerminal()
+	C.chafa_term_info_unref(termInfo)
+	if pixelMode != C.CHAFA_PIXEL_MODE_KITTY {
+		return nil
+	}
+	/**
+	 * Same choice of pixel type that
+	 * ChafaInfo makes for kitty
+	 */
+	pixelType := getChafaPixelType()
+	if pixelType == C.CHAFA_PIXEL_MAX {
+		pixelType = C.CHAFA_PIXEL_BGRA8_UNASSOCIATED
+		if !sessionTypeIsX11 {
+			pixelType = C.CHAFA_PIXEL_RGBA8_UNASSOCIATED
+		}
+	}
+	swapRedAndBlue := pixelType != C.CHAFA_PIXEL_RGBA8_UNASSOCIATED &&
+		pixelType != C.CHAFA_PIXEL_RGBA8_PREMULTIPLIED
+	return MakeKittyGraphics(transmission, probe, swapRedAndBlue)
+}
@@ -6,6 +6,8 @@ import "C"
 
 import (
 	"fmt"
+	"image"
+	"io"
 	"os"
 	"strings"
 	"unsafe"
@@ -16,11 +18,44 @@ import (
 type DrawState struct {
 	SessionTypeIsX11 bool
 	ChafaInfo        *ChafaInfo
+	/**
+	 * Not nil when we draw with the kitty
+	 * graphics protocol instead of chafa
+	 */
+	KittyGraphics *KittyGraphics
+
+	/**
+	 * What we drew last time, if any of
+	 * it changes we have to redraw everything.
+	 */
+	lastGeometry drawGeometry
+	/**
+	 * The rows of the last chafa output,
+	 * for symbols we only write rows that changed.
+	 */
+	lastRows []string
+
+	/**
+	 * Where frames are written, os.Stdout
+	 * (and a recording, with --record)
+	 */
+	Output io.Writer
+}
+
+type drawGeometry struct {
+	WidthCells       int
+	HeightCells      int
+	StatusLineHeight int
+	TermSize         TermSize
+	Width            uint32
+	Height           uint32
 }
 
 func MakeDrawState(sessionTypeIsX11 bool) *DrawState {
 	return &DrawState{
 		SessionTypeIsX11: sessionTypeIsX11,
+		KittyGraphics:    DetectKittyGraphics(sessionTypeIsX11),
+		Output:           os.Stdout,
 	}
 }
 
@@ -49,9 +84,15 @@ func (ds *DrawState) Destroy() {
 		ds.ChafaInfo.Destroy()
 		ds.ChafaInfo = nil
 	}
+	if ds.KittyGraphics != nil {
+		ds.KittyGraphics.Destroy()
+	}
 }
 
-func (ds *DrawState) DrawDesktop(texturePixels []byte, width, height uint32, statusLine *string) (int, int) {
+/**
+ * damage is in desktop pixels, nil means redraw everything.
+ */
+func (ds *DrawState) DrawDesktop(texturePixels []byte, width, height uint32, statusLine *string, damage []image.Rectangle) (int, int) {
 	haveStatusLine := statusLine != nil && len(*statusLine) > 0
 	termSize := MakeTermSize()
 
@@ -75,9 +116,19 @@ func (ds *DrawState) DrawDesktop(texturePixels []byte, width, height uint32, sta
 		C.gboolean(0), // do not upscale
 	)
 
-	ds.ResizeChafaInfoIfNeeded(widthCells, heightCells, termSize)
-
-	printable := ds.ChafaInfo.ConvertImage(texturePixels, width, height, width*4)
+	geometry := drawGeometry{
+		WidthCells:       widthCells,
+		HeightCells:      heightCells,
+		StatusLineHeight: statusLineHeight,
+		TermSize:         termSize,
+		Width:            width,
+		Height:           height,
+	}
+	if geometry != ds.lastGeometry {
+		ds.lastGeometry = geometry
+		damage = nil
+	}
+	topRow := 1 + statusLineHeight
 
 	var sb strings.Builder
 	if haveStatusLine {
@@ -87,10 +138,62 @@ func (ds *DrawState) DrawDesktop(texturePixels []byte, width, height uint32, sta
 		sb.WriteString("\n")
 
 	}
-	sb.WriteString(printable)
 
-	fmt.Fprint(os.Stdout, sb.String())
+	switch {
+	case damage != nil && len(damage) == 0:
+		/**
+		 * Nothing changed on the desktop
+		 */
+	case ds.KittyGraphics != nil && damage == nil:
+		sb.WriteString(escapecodes.MoveCursor(topRow, 1))
+		sb.WriteString(ds.KittyGraphics.ConvertImage(texturePixels, width, height, widthCells, heightCells))
+	case ds.KittyGraphics != nil:
+		sb.WriteString(ds.KittyGraphics.ConvertDamage(texturePixels, width, height, widthCells, heightCells, topRow, damage))
+	default:
+		ds.ResizeChafaInfoIfNeeded(widthCells, heightCells, termSize)
+		printable := ds.ChafaInfo.ConvertImage(texturePixels, width, height, width*4)
+		if ds.ChafaInfo.PixelMode != C.CHAFA_PIXEL_MODE_SYMBOLS {
+			/**
+			 * Sixels and iterm images are one image
+			 */
+			sb.WriteString(escapecodes.MoveCursor(topRow, 1))
+			sb.WriteString(printable)
+			break
+		}
+		sb.WriteString(ds.changedRows(printable, topRow, damage, height, heightCells))
+	}
+
+	fmt.Fprint(ds.Output, sb.String())
 	_ = os.Stdout.Sync()
 
 	return widthCells, heightCells
 }
+
+/**
+ * chafa encodes the whole canvas, but we only write
+ * the rows of cells that are damaged and changed.
+ */
+func (ds *DrawState) changedRows(printable string, topRow int, damage []image.Rectangle, height uint32, heightCells int) string {
+	rows := strings.Split(printable, "\n")
+	full := damage == nil || len(rows) != len(ds.lastRows)
+
+	damagedRows := make([]bool, len(rows))
+	for _, r := range damage {
+		firstRow := r.Min.Y * heightCells / int(height)
+		lastRow := min((r.Max.Y*heightCells+int(height)-1)/int(height), len(rows))
+		for row := max(firstRow, 0); row < lastRow; row++ {
+			damagedRows[row] = true
+		}
+	}
+
+	var sb strings.Builder
+	for i, row := range rows {
+		if !full && (!damagedRows[i] || row == ds.lastRows[i]) {
+			continue
+		}
+		sb.WriteString(escapecodes.MoveCursor(topRow+i, 1))
+		sb.WriteString(row)
+	}
+	ds.lastRows = rows
+	return sb.String()
+}
@@ -0,0 +1,459 @@
+package framebuffertoansi
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mmulet/term.everything/escapecodes"
+)
+
+/**
+ * How the pixels get to the terminal
+ */
+type KittyTransmission int
+
+const (
+	/**
+	 * base64 in the escape codes, in chunks.
+	 * Works everywhere, including over ssh.
+	 */
+	KittyTransmission_Direct KittyTransmission = iota
+	/**
+	 * A file in the temp directory that the
+	 * terminal reads, then deletes.
+	 */
+	KittyTransmission_TempFile
+	/**
+	 * A POSIX shared memory object that the
+	 * terminal reads, then unlinks.
+	 */
+	KittyTransmission_SharedMemory
+)
+
+/**
+ * The max size of a chunk of base64 in
+ * a single escape code, from the spec.
+ */
+const kittyChunkSize = 4096
+
+const kittyImageID = 1
+const kittyPlacementID = 1
+
+/**
+ * Partial redraws are sent as tiles of this many cells,
+ * each its own image, placed over the full frame.
+ */
+const kittyTileColumns = 16
+const kittyTileRows = 8
+const kittyFirstTileImageID = 2
+
+/**
+ * Ids of the probeQueries images, far
+ * above the ids the tiles use
+ */
+const kittyProbeSharedMemoryImageID = 0xfffffff0
+const kittyProbeTempFileImageID = 0xfffffff1
+
+/**
+ * If the terminal never reads our shared memory
+ * or temp files, we clean up after this many draws.
+ */
+const kittyMaxPendingDraws = 3
+
+type kittyPendingFile struct {
+	Path string
+	Draw int
+}
+
+/**
+ * Draws the desktop with the kitty graphics protocol
+ * https://sw.kovidgoyal.net/kitty/graphics-protocol/
+ * without going through chafa. Every frame is sent
+ * as raw RGBA with the same image and placement id,
+ * so the terminal replaces the last frame in place.
+ */
+type KittyGraphics struct {
+	/**
+	 * Direct until the terminal answers
+	 * the probe, unless it was forced
+	 */
+	Transmission KittyTransmission
+	/**
+	 * Send probeQueries with the next full frame
+	 */
+	probe bool
+	/**
+	 * The desktop is BGRA, kitty wants RGBA
+	 */
+	SwapRedAndBlue bool
+
+	rgba []byte
+
+	/**
+	 * Image ids of tiles on screen
+	 */
+	tiles map[uint32]bool
+
+	/**
+	 * For unique file names
+	 */
+	transmissions int
+	draws         int
+	/**
+	 * Files (or shared memory) we wrote, that the
+	 * terminal may not have read (and deleted) yet
+	 */
+	pendingFiles []kittyPendingFile
+}
+
+/**
+ * probe to start with base64 and ask the terminal
+ * if it can read shared memory or temp files.
+ */
+func MakeKittyGraphics(transmission KittyTransmission, probe bool, swapRedAndBlue bool) *KittyGraphics {
+	return &KittyGraphics{
+		Transmission:   transmission,
+		probe:          probe,
+		SwapRedAndBlue: swapRedAndBlue,
+		tiles:          make(map[uint32]bool),
+	}
+}
+
+/**
+ * TERM_EVERYTHING_KITTY_TRANSMISSION picks how frames are sent,
+ * CHAFA means let chafa encode them (native is false).
+ * By default (probe is true), base64 until the terminal
+ * says it can read our shared memory or temp files. It
+ * may be remote (ie over ssh or mosh) or in another
+ * container, so /dev/shm existing here says nothing.
+ */
+func getKittyTransmission() (transmission KittyTransmission, probe bool, native bool) {
+	switch os.Getenv("TERM_EVERYTHING_KITTY_TRANSMISSION") {
+	case "CHAFA":
+		return KittyTransmission_Direct, false, false
+	case "DIRECT":
+		return KittyTransmission_Direct, false, true
+	case "FILE":
+		return KittyTransmission_TempFile, false, true
+	case "SHM":
+		return KittyTransmission_SharedMemory, false, true
+	}
+	return KittyTransmission_Direct, true, true
+}
+
+/**
+ * Replies to our queries, from the input goroutine
+ * (TakeKittyGraphicsReplies) to the draw loop.
+ */
+var kittyGraphicsReplies = make(chan string, 16)
+
+/**
+ * Queries (a=q) that load a 1x1 image from shared memory
+ * and from a temp file. The terminal answers each with
+ * OK if it could, or an error. A terminal that doesn't
+ * answer (or can't read them) gets base64.
+ */
+func (kg *KittyGraphics) probeQueries() string {
+	pixel := []byte{0, 0, 0}
+	keys := "a=q,f=24,s=1,v=1,i=%d"
+	var sb strings.Builder
+	if info, err := os.Stat("/dev/shm"); err == nil && info.IsDir() {
+		if out, err := kg.transmitSharedMemory(fmt.Sprintf(keys, kittyProbeSharedMemoryImageID), pixel); err == nil {
+			sb.WriteString(out)
+		}
+	}
+	if out, err := kg.transmitTempFile(fmt.Sprintf(keys, kittyProbeTempFileImageID), pixel); err == nil {
+		sb.WriteString(out)
+	}
+	return sb.String()
+}
+
+/**
+ * reply is what is between ESC _G and ESC \,
+ * ie "i=4294967280;OK"
+ */
+func (kg *KittyGraphics) handleReply(reply string) {
+	keys, message, _ := strings.Cut(reply, ";")
+	if message != "OK" {
+		return
+	}
+	for _, key := range strings.Split(keys, ",") {
+		switch key {
+		case fmt.Sprintf("i=%d", kittyProbeSharedMemoryImageID):
+			kg.Transmission = KittyTransmission_SharedMemory
+		case fmt.Sprintf("i=%d", kittyProbeTempFileImageID):
+			/**
+			 * Shared memory is better, if it can do both
+			 */
+			if kg.Transmission == KittyTransmission_Direct {
+				kg.Transmission = KittyTransmission_TempFile
+			}
+		}
+	}
+}
+
+/**
+ * Removes the replies to our kitty graphics commands
+ * from what the terminal sent (so they don't become
+ * key presses) and hands them to the draw loop.
+ */
+func TakeKittyGraphicsReplies(data []byte) []byte {
+	if !bytes.Contains(data, []byte(escapecodes.KittyGraphicsStart)) {
+		return data
+	}
+	out := make([]byte, 0, len(data))
+	for {
+		start := bytes.Index(data, []byte(escapecodes.KittyGraphicsStart))
+		if start == -1 {
+			break
+		}
+		end := bytes.Index(data[start:], []byte(escapecodes.KittyGraphicsEnd))
+		if end == -1 {
+			break
+		}
+		out = append(out, data[:start]...)
+		reply := string(data[start+len(escapecodes.KittyGraphicsStart) : start+end])
+		select {
+		case kittyGraphicsReplies <- reply:
+		default:
+		}
+		data = data[start+end+len(escapecodes.KittyGraphicsEnd):]
+	}
+	return append(out, data...)
+}
+
+/**
+ * Copy the rectangle out of the desktop as RGBA
+ */
+func (kg *KittyGraphics) toRGBA(texturePixels []byte, textureWidth uint32, rect image.Rectangle) []byte {
+	stride := int(textureWidth) * 4
+	rowBytes := rect.Dx() * 4
+	if !kg.SwapRedAndBlue && rect.Min.X == 0 && rowBytes == stride {
+		return texturePixels[rect.Min.Y*stride : rect.Max.Y*stride]
+	}
+	size := rowBytes * rect.Dy()
+	if cap(kg.rgba) < size {
+		kg.rgba = make([]byte, size)
+	}
+	out := kg.rgba[:size]
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		src := texturePixels[y*stride+rect.Min.X*4 : y*stride+rect.Max.X*4]
+		dst := out[(y-rect.Min.Y)*rowBytes : (y-rect.Min.Y+1)*rowBytes]
+		if !kg.SwapRedAndBlue {
+			copy(dst, src)
+			continue
+		}
+		for i := 0; i+3 < len(src); i += 4 {
+			dst[i] = src[i+2]
+			dst[i+1] = src[i+1]
+			dst[i+2] = src[i]
+			dst[i+3] = src[i+3]
+		}
+	}
+	return out
+}
+
+/**
+ * Returns the escape codes to draw the pixels
+ * scaled to widthCells x heightCells, at the cursor.
+ * The cursor does not move.
+ */
+func (kg *KittyGraphics) ConvertImage(texturePixels []byte, textureWidth, textureHeight uint32, widthCells, heightCells int) string {
+	if len(texturePixels) == 0 {
+		return ""
+	}
+	kg.startDraw()
+	var sb strings.Builder
+	if kg.probe {
+		kg.probe = false
+		sb.WriteString(kg.probeQueries())
+	}
+	/**
+	 * The full frame covers all the tiles
+	 */
+	for id := range kg.tiles {
+		sb.WriteString(kittyDeleteImage(id))
+	}
+	clear(kg.tiles)
+
+	pixels := kg.toRGBA(texturePixels, textureWidth, image.Rect(0, 0, int(textureWidth), int(textureHeight)))
+	keys := fmt.Sprintf("a=T,f=32,s=%d,v=%d,i=%d,p=%d,c=%d,r=%d,C=1,q=2",
+		textureWidth, textureHeight, kittyImageID, kittyPlacementID, widthCells, heightCells)
+	sb.WriteString(kg.transmit(keys, pixels))
+	return sb.String()
+}
+
+/**
+ * Only redraw the tiles that cover damage (in desktop pixels).
+ * The image is at topRow (starting at 1), in the first column,
+ * and scaled to widthCells x heightCells like ConvertImage.
+ */
+func (kg *KittyGraphics) ConvertDamage(texturePixels []byte, textureWidth, textureHeight uint32, widthCells, heightCells int, topRow int, damage []image.Rectangle) string {
+	if len(texturePixels) == 0 || widthCells <= 0 || heightCells <= 0 {
+		return ""
+	}
+	kg.startDraw()
+	width := int(textureWidth)
+	height := int(textureHeight)
+	tilesAcross := (widthCells + kittyTileColumns - 1) / kittyTileColumns
+
+	/**
+	 * The first pixel of a column or row of cells
+	 */
+	columnToPixel := func(column int) int { return column * width / widthCells }
+	rowToPixel := func(row int) int { return row * height / heightCells }
+
+	damagedTiles := make(map[int]bool)
+	for _, r := range damage {
+		firstColumn := r.Min.X * widthCells / width
+		lastColumn := min((r.Max.X*widthCells+width-1)/width, widthCells) - 1
+		firstRow := r.Min.Y * heightCells / height
+		lastRow := min((r.Max.Y*heightCells+height-1)/height, heightCells) - 1
+		for tileY := firstRow / kittyTileRows; tileY <= lastRow/kittyTileRows; tileY++ {
+			for tileX := firstColumn / kittyTileColumns; tileX <= lastColumn/kittyTileColumns; tileX++ {
+				damagedTiles[tileY*tilesAcross+tileX] = true
+			}
+		}
+	}
+
+	var sb strings.Builder
+	for tile := range damagedTiles {
+		column := (tile % tilesAcross) * kittyTileColumns
+		row := (tile / tilesAcross) * kittyTileRows
+		columns := min(kittyTileColumns, widthCells-column)
+		rows := min(kittyTileRows, heightCells-row)
+		rect := image.Rect(
+			columnToPixel(column),
+			rowToPixel(row),
+			columnToPixel(column+columns),
+			rowToPixel(row+rows),
+		)
+		if rect.Empty() {
+			continue
+		}
+		id := uint32(kittyFirstTileImageID + tile)
+		kg.tiles[id] = true
+
+		keys := fmt.Sprintf("a=T,f=32,s=%d,v=%d,i=%d,p=%d,c=%d,r=%d,z=1,C=1,q=2",
+			rect.Dx(), rect.Dy(), id, kittyPlacementID, columns, rows)
+		sb.WriteString(escapecodes.MoveCursor(topRow+row, column+1))
+		sb.WriteString(kg.transmit(keys, kg.toRGBA(texturePixels, textureWidth, rect)))
+	}
+	return sb.String()
+}
+
+func (kg *KittyGraphics) transmit(keys string, pixels []byte) string {
+	kg.transmissions++
+	switch kg.Transmission {
+	case KittyTransmission_SharedMemory:
+		if out, err := kg.transmitSharedMemory(keys, pixels); err == nil {
+			return out
+		}
+		/**
+		 * Fall back to sending it over the
+		 * terminal from now on
+		 */
+		kg.Transmission = KittyTransmission_Direct
+	case KittyTransmission_TempFile:
+		if out, err := kg.transmitTempFile(keys, pixels); err == nil {
+			return out
+		}
+		kg.Transmission = KittyTransmission_Direct
+	}
+	return kg.transmitDirect(keys, pixels)
+}
+
+func (kg *KittyGraphics) transmitDirect(keys string, pixels []byte) string {
+	payload := base64.StdEncoding.EncodeToString(pixels)
+
+	var sb strings.Builder
+	sb.Grow(len(payload) + (len(payload)/kittyChunkSize+1)*16 + len(keys))
+	for start := 0; start < len(payload); start += kittyChunkSize {
+		end := min(start+kittyChunkSize, len(payload))
+		more := 0
+		if end < len(payload) {
+			more = 1
+		}
+		sb.WriteString(escapecodes.KittyGraphicsStart)
+		if start == 0 {
+			sb.WriteString(keys)
+			sb.WriteString(",")
+		}
+		fmt.Fprintf(&sb, "m=%d;", more)
+		sb.WriteString(payload[start:end])
+		sb.WriteString(escapecodes.KittyGraphicsEnd)
+	}
+	return sb.String()
+}
+
+func (kg *KittyGraphics) transmitSharedMemory(keys string, pixels []byte) (string, error) {
+	name := fmt.Sprintf("term.everything-%d-%d", os.Getpid(), kg.transmissions)
+	path := filepath.Join("/dev/shm", name)
+	if err := os.WriteFile(path, pixels, 0o600); err != nil {
+		return "", err
+	}
+	kg.addPendingFile(path)
+	return kittyTransmitPath(keys, "s", "/"+name), nil
+}
+
+func (kg *KittyGraphics) transmitTempFile(keys string, pixels []byte) (string, error) {
+	/**
+	 * The terminal only deletes temp files with
+	 * tty-graphics-protocol in the name
+	 */
+	f, err := os.CreateTemp("", "term.everything-tty-graphics-protocol-*")
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	if _, err := f.Write(pixels); err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	kg.addPendingFile(f.Name())
+	return kittyTransmitPath(keys, "t", f.Name()), nil
+}
+
+func kittyTransmitPath(keys string, medium string, path string) string {
+	return escapecodes.KittyGraphicsStart +
+		keys + ",t=" + medium + ";" +
+		base64.StdEncoding.EncodeToString([]byte(path)) +
+		escapecodes.KittyGraphicsEnd
+}
+
+func (kg *KittyGraphics) addPendingFile(path string) {
+	kg.pendingFiles = append(kg.pendingFiles, kittyPendingFile{Path: path, Draw: kg.draws})
+}
+
+func (kg *KittyGraphics) startDraw() {
+	kg.draws++
+	for len(kittyGraphicsReplies) > 0 {
+		kg.handleReply(<-kittyGraphicsReplies)
+	}
+	for len(kg.pendingFiles) > 0 && kg.draws-kg.pendingFiles[0].Draw > kittyMaxPendingDraws {
+		/**
+		 * Usually already deleted by the terminal
+		 */
+		_ = os.Remove(kg.pendingFiles[0].Path)
+		kg.pendingFiles = kg.pendingFiles[1:]
+	}
+}
+
+/**
+ * Escape codes to remove an image from the screen
+ */
+func kittyDeleteImage(id uint32) string {
+	return fmt.Sprintf("%sa=d,d=I,i=%d,q=2%s", escapecodes.KittyGraphicsStart, id, escapecodes.KittyGraphicsEnd)
+}
+
+func (kg *KittyGraphics) Destroy() {
+	for _, pending := range kg.pendingFiles {
+		_ = os.Remove(pending.Path)
+	}
+	kg.pendingFiles = nil
+}
@@ -25,6 +25,23 @@ type WinSize struct {
 	Ypixel uint16
 }
 
+/**
+ * Where the size of the terminal comes from, nil is
+ * stdout (or stderr, stdin). A session (--session)
+ * sets it to the size of the attached terminal.
+ */
+var TerminalWinsize func() (WinSize, error)
+
+/**
+ * The size of the terminal we draw to
+ */
+func GetTerminalWinsize() (WinSize, error) {
+	if TerminalWinsize != nil {
+		return TerminalWinsize()
+	}
+	return GetWinsize(os.Stdout.Fd())
+}
+
 func MakeTermSize() TermSize {
 	ts := TermSize{
 		WidthCells:            -1,
@@ -36,9 +53,16 @@ func MakeTermSize() TermSize {
 		FontRatio:             0.5,
 	}
 
-	tryFDs := []uintptr{os.Stdout.Fd(), os.Stderr.Fd(), os.Stdin.Fd()}
-	for _, fd := range tryFDs {
-		if ws, err := GetWinsize(fd); err == nil {
+	tryWinsize := []func() (WinSize, error){
+		func() (WinSize, error) { return GetWinsize(os.Stdout.Fd()) },
+		func() (WinSize, error) { return GetWinsize(os.Stderr.Fd()) },
+		func() (WinSize, error) { return GetWinsize(os.Stdin.Fd()) },
+	}
+	if TerminalWinsize != nil {
+		tryWinsize = []func() (WinSize, error){TerminalWinsize}
+	}
+	for _, getWinsize := range tryWinsize {
+		if ws, err := getWinsize(); err == nil {
 			ts.WidthCells = int(ws.Col)
 			ts.HeightCells = int(ws.Row)
 			ts.WidthPixels = int(ws.Xpixel)
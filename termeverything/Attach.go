@@ -0,0 +1,249 @@
+package termeverything
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/mmulet/term.everything/framebuffertoansi"
+)
+
+/**
+ * Every session with a socket someone is listening on
+ */
+func ListSessions() []string {
+	entries, err := os.ReadDir(SessionsDir())
+	if err != nil {
+		return nil
+	}
+	sessions := make([]string, 0)
+	for _, entry := range entries {
+		if entry.Type()&os.ModeSocket == 0 {
+			continue
+		}
+		if sessionIsRunning(entry.Name()) {
+			sessions = append(sessions, entry.Name())
+		}
+	}
+	return sessions
+}
+
+/**
+ * Only checks that it is listening, the
+ * session ignores a connection without a hello
+ */
+func sessionIsRunning(name string) bool {
+	conn, err := net.DialTimeout("unix", SessionSocketPath(name), time.Second)
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
+
+/**
+ * term.everything attach [session]
+ * Without a session, attach to the only one
+ * (or list them if there are more).
+ */
+func Attach(arguments []string) int {
+	var name string
+	switch len(arguments) {
+	case 0:
+		sessions := ListSessions()
+		if len(sessions) != 1 {
+			if len(sessions) == 0 {
+				fmt.Fprintf(os.Stderr, "There are no sessions, start one with term.everything --session <name> <app>\n")
+				return 1
+			}
+			fmt.Fprintf(os.Stderr, "Which session? term.everything attach <session>\n")
+			for _, session := range sessions {
+				fmt.Fprintf(os.Stderr, "  %s\n", session)
+			}
+			return 2
+		}
+		name = sessions[0]
+	case 1:
+		name = arguments[0]
+	default:
+		fmt.Fprintf(os.Stderr, "Usage: term.everything attach [session]\n")
+		return 2
+	}
+	if err := checkSessionName(name); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 2
+	}
+	conn, err := net.Dial("unix", SessionSocketPath(name))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "There is no session %s\n", name)
+		return 1
+	}
+	defer conn.Close()
+
+	winsize, _ := framebuffertoansi.GetWinsize(os.Stdout.Fd())
+	hello, err := json.Marshal(sessionHello{Winsize: winsize, Env: terminalEnv()})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	if err := writeSessionMessage(conn, SessionMessage_Hello, hello); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to attach to %s: %v\n", name, err)
+		return 1
+	}
+
+	restoreTerminalMode, err := EnableRawModeFD(int(os.Stdin.Fd()))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	defer restoreTerminalMode()
+
+	/**
+	 * Input and resizes are written by one
+	 * goroutine, so messages don't interleave
+	 */
+	messages := make(chan func() error, 16)
+	go func() {
+		for write := range messages {
+			if write() != nil {
+				return
+			}
+		}
+	}()
+
+	resized := make(chan os.Signal, 1)
+	signal.Notify(resized, syscall.SIGWINCH)
+	defer signal.Stop(resized)
+	go func() {
+		for range resized {
+			winsize, err := framebuffertoansi.GetWinsize(os.Stdout.Fd())
+			if err != nil {
+				continue
+			}
+			data, _ := json.Marshal(winsize)
+			messages <- func() error {
+				return writeSessionMessage(conn, SessionMessage_Resize, data)
+			}
+		}
+	}()
+
+	go func() {
+		buf := make([]byte, 4096)
+		for {
+			n, err := os.Stdin.Read(buf)
+			if err != nil || n == 0 {
+				return
+			}
+			chunk := append([]byte(nil), buf[:n]...)
+			messages <- func() error {
+				return writeSessionMessage(conn, SessionMessage_Input, chunk)
+			}
+		}
+	}()
+
+	reader := bufio.NewReaderSize(conn, 1<<16)
+	for {
+		kind, data, err := readSessionMessage(reader)
+		if err != nil {
+			/**
+			 * The session died without
+			 * putting our terminal back
+			 */
+			os.Stdout.WriteString(TerminalRestoreCodes(false))
+			restoreTerminalMode()
+			fmt.Fprintf(os.Stderr, "Lost session %s: %v\n", name, err)
+			return 1
+		}
+		switch kind {
+		case SessionMessage_Output:
+			os.Stdout.Write(data)
+		case SessionMessage_Detach:
+			restoreTerminalMode()
+			fmt.Fprintf(os.Stderr, "Detached from %s, term.everything attach %s to go back.\n", name, name)
+			return 0
+		case SessionMessage_Exit:
+			restoreTerminalMode()
+			code, _ := strconv.Atoi(string(data))
+			return code
+		}
+	}
+}
+
+/**
+ * term.everything --session <name> ... starts the session
+ * server (the same arguments with --session-server) in the
+ * background, then attaches to it.
+ */
+func StartSession(args *CommandLineArgs) int {
+	name := args.Session
+	if err := checkSessionName(name); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 2
+	}
+	if args.Headless {
+		fmt.Fprintf(os.Stderr, "--session can't be used with --headless\n")
+		return 2
+	}
+	if sessionIsRunning(name) {
+		fmt.Fprintf(os.Stderr, "Session %s already exists, use term.everything attach %s\n", name, name)
+		return 1
+	}
+	path := SessionSocketPath(name)
+	if err := os.MkdirAll(SessionsDir(), 0o700); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	_ = os.Remove(path)
+	logPath := path + ".log"
+	log, err := os.Create(logPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	executable, err := os.Executable()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	server := exec.Command(executable, append([]string{"--session-server"}, os.Args[1:]...)...)
+	server.Stdout = log
+	server.Stderr = log
+	/**
+	 * Not killed along with our terminal
+	 */
+	server.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	if err := server.Start(); err != nil {
+		log.Close()
+		fmt.Fprintf(os.Stderr, "Failed to start session %s: %v\n", name, err)
+		return 1
+	}
+	log.Close()
+	exited := make(chan struct{})
+	go func() {
+		server.Wait()
+		close(exited)
+	}()
+
+	deadline := time.After(10 * time.Second)
+	for {
+		if _, err := os.Stat(path); err == nil {
+			return Attach([]string{name})
+		}
+		select {
+		case <-exited:
+			fmt.Fprintf(os.Stderr, "Session %s exited, see %s\n", name, logPath)
+			return 1
+		case <-deadline:
+			fmt.Fprintf(os.Stderr, "Session %s didn't start, see %s\n", name, logPath)
+			return 1
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+}
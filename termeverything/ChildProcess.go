@@ -0,0 +1,159 @@
+package termeverything
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+)
+
+/**
+ * The app given after `--`. Its output goes
+ * to a log file, because the terminal is ours.
+ */
+type ChildProcess struct {
+	Cmd     *exec.Cmd
+	LogPath string
+	Log     *os.File
+	/**
+	 * Gets the exit code once the child exits
+	 */
+	Exited chan int
+}
+
+func ChildLogPath(args *CommandLineArgs, waylandDisplayName string) string {
+	if args.AppLog != "" {
+		return args.AppLog
+	}
+	return filepath.Join(os.TempDir(), fmt.Sprintf("term.everything-%s.log", waylandDisplayName))
+}
+
+func StartChildProcess(command string, shell string, env []string, logPath string) (*ChildProcess, error) {
+	log, err := os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open the app log %s: %w", logPath, err)
+	}
+
+	cmd := exec.Command(shell, "-c", command)
+	cmd.Env = env
+	cmd.Stdout = log
+	cmd.Stderr = log
+
+	if err := cmd.Start(); err != nil {
+		log.Close()
+		return nil, err
+	}
+
+	child := &ChildProcess{
+		Cmd:     cmd,
+		LogPath: logPath,
+		Log:     log,
+		Exited:  make(chan int, 1),
+	}
+	go func() {
+		err := cmd.Wait()
+		log.Close()
+		child.Exited <- ExitCodeFromWaitError(err)
+	}()
+	return child, nil
+}
+
+/**
+ * Same as a shell would report it,
+ * 128 + the signal if it was killed.
+ */
+func ExitCodeFromWaitError(err error) int {
+	if err == nil {
+		return 0
+	}
+	var exitError *exec.ExitError
+	if !errors.As(err, &exitError) {
+		return 1
+	}
+	if status, ok := exitError.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+		return 128 + int(status.Signal())
+	}
+	return exitError.ExitCode()
+}
+
+/**
+ * Tell the user where the app's output went,
+ * if there was any.
+ */
+func (c *ChildProcess) PrintLogLocation() {
+	info, err := os.Stat(c.LogPath)
+	if err != nil || info.Size() == 0 {
+		return
+	}
+	fmt.Fprintf(os.Stderr, "The app's output was saved to %s\n", c.LogPath)
+}
+
+/**
+ * Decides when to exit: once the child has exited
+ * and all the clients it started have disconnected.
+ * Clients keep running after the child if it was
+ * only a launcher (ie a shell script).
+ */
+type AppLifetime struct {
+	/**
+	 * The pid of the client's process
+	 */
+	ClientConnected    chan int
+	ClientDisconnected chan int
+}
+
+func MakeAppLifetime() *AppLifetime {
+	return &AppLifetime{
+		ClientConnected:    make(chan int, 32),
+		ClientDisconnected: make(chan int, 32),
+	}
+}
+
+/**
+ * Blocks until the child has exited and there are
+ * no clients left, then returns the child's exit code.
+ * Clients from ignorePid (ie Xwayland) don't count.
+ */
+func (l *AppLifetime) WaitForExit(child *ChildProcess, ignorePid int) int {
+	clients := make(map[int]int)
+	exited := false
+	exitCode := 0
+	for {
+		select {
+		case pid := <-l.ClientConnected:
+			clients[pid]++
+		case pid := <-l.ClientDisconnected:
+			clients[pid]--
+			if clients[pid] <= 0 {
+				delete(clients, pid)
+			}
+		case exitCode = <-child.Exited:
+			exited = true
+		}
+		delete(clients, ignorePid)
+		if exited && len(clients) == 0 {
+			return exitCode
+		}
+	}
+}
+
+/**
+ * The pid of the process on the other end of conn
+ */
+func PeerPid(conn *net.UnixConn) int {
+	rawConn, err := conn.SyscallConn()
+	if err != nil {
+		return -1
+	}
+	pid := -1
+	_ = rawConn.Control(func(fd uintptr) {
+		cred, err := syscall.GetsockoptUcred(int(fd), syscall.SOL_SOCKET, syscall.SO_PEERCRED)
+		if err == nil {
+			pid = int(cred.Pid)
+		}
+	})
+	return pid
+}
@@ -0,0 +1,86 @@
+package termeverything
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+
+	"github.com/mmulet/term.everything/escapecodes"
+	"github.com/mmulet/term.everything/wayland/protocols"
+)
+
+/**
+ * Text the host terminal pasted into us with
+ * bracketed paste. It becomes the wayland selection,
+ * then we press ctrl+v for the focused client.
+ */
+type Paste struct {
+	Text      []byte
+	Modifiers int
+}
+
+func (*Paste) isXkbdCode() {}
+
+func (p *Paste) OrModifiers(modifiers int) {
+	p.Modifiers |= modifiers
+}
+
+func (p *Paste) GetModifiers() int {
+	return p.Modifiers
+}
+
+/**
+ * Pulls bracketed pastes out of stdin. A paste
+ * can be larger than a single read, so it
+ * remembers if we are in the middle of one.
+ */
+type BracketedPasteReader struct {
+	Pasting bool
+	Pasted  []byte
+}
+
+func (b *BracketedPasteReader) ConvertToCodes(chunk []byte) []XkbdCode {
+	codes := make([]XkbdCode, 0)
+	for len(chunk) > 0 {
+		if !b.Pasting {
+			start := bytes.Index(chunk, []byte(escapecodes.BracketedPasteStart))
+			if start < 0 {
+				return append(codes, ConvertKeycodeToXbdCode(chunk)...)
+			}
+			if start > 0 {
+				codes = append(codes, ConvertKeycodeToXbdCode(chunk[:start])...)
+			}
+			b.Pasting = true
+			b.Pasted = b.Pasted[:0]
+			chunk = chunk[start+len(escapecodes.BracketedPasteStart):]
+			continue
+		}
+		b.Pasted = append(b.Pasted, chunk...)
+		end := bytes.Index(b.Pasted, []byte(escapecodes.BracketedPasteEnd))
+		if end < 0 {
+			return codes
+		}
+		rest := bytes.Clone(b.Pasted[end+len(escapecodes.BracketedPasteEnd):])
+		codes = append(codes, &Paste{
+			Text:      bytes.Clone(b.Pasted[:end]),
+			Modifiers: ModControl,
+		})
+		b.Pasting = false
+		b.Pasted = b.Pasted[:0]
+		chunk = rest
+	}
+	return codes
+}
+
+/**
+ * Put text on the host terminal's clipboard using OSC 52.
+ * Terminals that don't support it will ignore it.
+ */
+func CopyToHostClipboard(terminal io.Writer, text []byte) {
+	if protocols.DebugRequests {
+		return
+	}
+	io.WriteString(terminal, escapecodes.SetClipboard+
+		base64.StdEncoding.EncodeToString(text)+
+		escapecodes.StringTerminator)
+}
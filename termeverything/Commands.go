@@ -0,0 +1,398 @@
+package termeverything
+
+import (
+	"fmt"
+	"image"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mmulet/term.everything/wayland"
+	"github.com/mmulet/term.everything/wayland/protocols"
+)
+
+/**
+ * The commands of --headless-input and the control
+ * socket, one per line, ie "key ctrl+c" or "list".
+ */
+type Commands struct {
+	Window   *TerminalWindow
+	DrawLoop *TerminalDrawLoop
+}
+
+/**
+ * Sent back over the control socket as a line of JSON.
+ * Clients and Windows are pointers so that an
+ * empty list is still sent.
+ */
+type CommandReply struct {
+	OK      bool           `json:"ok"`
+	Error   string         `json:"error,omitempty"`
+	Clients *[]ClientReply `json:"clients,omitempty"`
+	Windows *[]WindowReply `json:"windows,omitempty"`
+}
+
+type ClientReply struct {
+	Pid     int      `json:"pid"`
+	Windows []uint64 `json:"windows"`
+}
+
+type WindowReply struct {
+	ID     uint64 `json:"id"`
+	Pid    int    `json:"pid"`
+	Title  string `json:"title"`
+	AppID  string `json:"app_id"`
+	Active bool   `json:"active"`
+	X      int32  `json:"x"`
+	Y      int32  `json:"y"`
+	Width  int32  `json:"width"`
+	Height int32  `json:"height"`
+}
+
+/**
+ * How long wait-window waits before giving up
+ */
+const waitWindowTimeout = 30 * time.Second
+
+var commandKeyNames = map[string]Linux_Event_Codes{
+	"enter":     KEY_ENTER,
+	"return":    KEY_ENTER,
+	"tab":       KEY_TAB,
+	"esc":       KEY_ESC,
+	"escape":    KEY_ESC,
+	"backspace": KEY_BACKSPACE,
+	"space":     KEY_SPACE,
+	"up":        KEY_UP,
+	"down":      KEY_DOWN,
+	"left":      KEY_LEFT,
+	"right":     KEY_RIGHT,
+	"home":      KEY_HOME,
+	"end":       KEY_END,
+	"pageup":    KEY_PAGEUP,
+	"pagedown":  KEY_PAGEDOWN,
+	"insert":    KEY_INSERT,
+	"delete":    KEY_DELETE,
+	"f11":       KEY_F11,
+	"f12":       KEY_F12,
+}
+
+var commandModifierNames = map[string]int{
+	"shift": ModShift,
+	"ctrl":  ModControl,
+	"alt":   ModAlt,
+	"super": ModSuper,
+}
+
+var commandButtonNames = map[string]LINUX_BUTTON_CODES{
+	"left":   BTN_LEFT,
+	"middle": BTN_MIDDLE,
+	"right":  BTN_RIGHT,
+}
+
+/**
+ * Run f with InputAccess held, after
+ * taking the clients that connected since.
+ */
+func (c *Commands) withInput(f func()) {
+	c.Window.InputAccess.Lock()
+	defer c.Window.InputAccess.Unlock()
+	c.Window.TakeNewClients()
+	f()
+}
+
+/**
+ * Like withInput, with every client locked too
+ */
+func (c *Commands) withClients(f func()) {
+	c.withInput(func() {
+		defer c.Window.LockClients()()
+		f()
+	})
+}
+
+func (c *Commands) Run(command string) (CommandReply, error) {
+	name, rest, _ := strings.Cut(strings.TrimSpace(command), " ")
+	rest = strings.TrimSpace(rest)
+	reply := CommandReply{OK: true}
+	switch name {
+	case "sleep":
+		seconds, err := strconv.ParseFloat(rest, 64)
+		if err != nil {
+			return reply, fmt.Errorf("sleep needs seconds: %v", err)
+		}
+		time.Sleep(time.Duration(seconds * float64(time.Second)))
+	case "list":
+		c.withClients(func() {
+			clients, windows := c.list()
+			reply.Clients = &clients
+			reply.Windows = &windows
+		})
+	case "wait-window":
+		window, err := c.waitForWindow(rest)
+		if err != nil {
+			return reply, err
+		}
+		reply.Windows = &[]WindowReply{window}
+	case "type":
+		c.withInput(func() {
+			c.Window.ProcessCodes(typedTextCodes(rest))
+		})
+	case "key":
+		code, err := parseKeyName(rest)
+		if err != nil {
+			return reply, err
+		}
+		c.withInput(func() {
+			c.Window.ProcessCodes([]XkbdCode{code})
+		})
+	case "move":
+		var x, y float32
+		if _, err := fmt.Sscanf(rest, "%g %g", &x, &y); err != nil {
+			return reply, fmt.Errorf("move needs x y: %v", err)
+		}
+		c.withClients(func() {
+			wayland.SendPointerMotion(x, y)
+		})
+	case "press", "release", "click":
+		if rest == "" {
+			rest = "left"
+		}
+		button, ok := commandButtonNames[rest]
+		if !ok {
+			return reply, fmt.Errorf("unknown button %q", rest)
+		}
+		c.withClients(func() {
+			if name != "release" {
+				wayland.SendPointerButton(uint32(button), true)
+			}
+			if name != "press" {
+				wayland.SendPointerButton(uint32(button), false)
+			}
+		})
+	case "scroll":
+		direction, amount, _ := strings.Cut(rest, " ")
+		pixels := float32(10)
+		if amount != "" {
+			v, err := strconv.ParseFloat(amount, 32)
+			if err != nil {
+				return reply, fmt.Errorf("scroll amount: %v", err)
+			}
+			pixels = float32(v)
+		}
+		switch direction {
+		case "up":
+			pixels = -pixels
+		case "down":
+		default:
+			return reply, fmt.Errorf("scroll up or down, not %q", direction)
+		}
+		c.withClients(func() {
+			wayland.SendPointerAxis(protocols.WlPointerAxis_enum_vertical_scroll, pixels)
+		})
+	case "screenshot":
+		path, window, _ := strings.Cut(rest, " ")
+		if path == "" {
+			return reply, fmt.Errorf("screenshot needs a file name")
+		}
+		return reply, c.screenshot(path, strings.TrimSpace(window))
+	case "activate", "close":
+		id, err := strconv.ParseUint(rest, 10, 64)
+		if err != nil {
+			return reply, fmt.Errorf("%s needs a window id: %v", name, err)
+		}
+		c.withClients(func() {
+			window, ok := findWindow(id)
+			if !ok {
+				err = fmt.Errorf("no window %d", id)
+				return
+			}
+			if name == "activate" {
+				wayland.Focus.ActivateWindow(window.Client, window.ToplevelID)
+				return
+			}
+			protocols.XdgToplevel_close(window.Client, window.ToplevelID)
+		})
+		return reply, err
+	case "quit":
+		code := 0
+		if rest != "" {
+			v, err := strconv.Atoi(rest)
+			if err != nil {
+				return reply, fmt.Errorf("quit exit code: %v", err)
+			}
+			code = v
+		}
+		GlobalExitChan <- code
+	default:
+		return reply, fmt.Errorf("unknown command %q", name)
+	}
+	return reply, nil
+}
+
+/**
+ * Call withClients
+ */
+func (c *Commands) list() ([]ClientReply, []WindowReply) {
+	windows := wayland.Focus.Windows()
+	clients := make([]ClientReply, 0, len(c.Window.Clients))
+	for _, client := range c.Window.Clients {
+		ids := make([]uint64, 0)
+		for _, window := range windows {
+			if window.Client == client {
+				ids = append(ids, window.ID)
+			}
+		}
+		clients = append(clients, ClientReply{
+			Pid:     PeerPid(client.UnixConnection),
+			Windows: ids,
+		})
+	}
+	replies := make([]WindowReply, 0, len(windows))
+	for _, window := range windows {
+		replies = append(replies, makeWindowReply(window))
+	}
+	return clients, replies
+}
+
+/**
+ * Call withClients
+ */
+func makeWindowReply(window wayland.WindowInfo) WindowReply {
+	reply := WindowReply{
+		ID:     window.ID,
+		Pid:    PeerPid(window.Client.UnixConnection),
+		Title:  window.Title,
+		AppID:  window.AppID,
+		Active: window.Active,
+	}
+	if surface := wayland.GetWlSurfaceObject(window.Client, window.SurfaceID); surface != nil {
+		reply.X = surface.Position.X
+		reply.Y = surface.Position.Y
+		reply.Width, reply.Height = surface.Size()
+	}
+	return reply
+}
+
+/**
+ * Call withClients
+ */
+func findWindow(id uint64) (wayland.WindowInfo, bool) {
+	for _, window := range wayland.Focus.Windows() {
+		if window.ID == id {
+			return window, true
+		}
+	}
+	return wayland.WindowInfo{}, false
+}
+
+/**
+ * Until there is a window with name in its title or
+ * app_id (any window if name is empty)
+ */
+func (c *Commands) waitForWindow(name string) (WindowReply, error) {
+	deadline := time.Now().Add(waitWindowTimeout)
+	for time.Now().Before(deadline) {
+		var found *WindowReply
+		c.withClients(func() {
+			for _, window := range wayland.Focus.Windows() {
+				if strings.Contains(window.Title, name) || strings.Contains(window.AppID, name) {
+					reply := makeWindowReply(window)
+					found = &reply
+					return
+				}
+			}
+		})
+		if found != nil {
+			return *found, nil
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	return WindowReply{}, fmt.Errorf("no window %q after %v", name, waitWindowTimeout)
+}
+
+/**
+ * The whole desktop, as last drawn, or a single
+ * window's surface when window is its id.
+ */
+func (c *Commands) screenshot(path string, window string) error {
+	if window == "" {
+		done := make(chan *image.RGBA)
+		c.DrawLoop.DesktopScreenshots <- done
+		return writePNG(path, <-done)
+	}
+	id, err := strconv.ParseUint(window, 10, 64)
+	if err != nil {
+		return fmt.Errorf("screenshot window id: %v", err)
+	}
+	var img *image.RGBA
+	c.withClients(func() {
+		info, ok := findWindow(id)
+		if !ok {
+			err = fmt.Errorf("no window %d", id)
+			return
+		}
+		surface := wayland.GetWlSurfaceObject(info.Client, info.SurfaceID)
+		if surface == nil {
+			err = fmt.Errorf("window %d has no surface", id)
+			return
+		}
+		surfaceImage := surface.SurfaceImage(wayland.DesktopScale)
+		if surfaceImage == nil {
+			err = fmt.Errorf("window %d has not drawn anything", id)
+			return
+		}
+		img = image.NewRGBA(surfaceImage.Rect)
+		wayland.BgraToRgba(img, surfaceImage, false)
+	})
+	if err != nil {
+		return err
+	}
+	return writePNG(path, img)
+}
+
+/**
+ * One key per character, or text for
+ * the ones not on the keymap.
+ */
+func typedTextCodes(text string) []XkbdCode {
+	out := make([]XkbdCode, 0, len(text))
+	for _, r := range text {
+		if r < 128 {
+			if code := KeycodeSingleCodes(int(r)); code != nil {
+				out = append(out, code)
+			}
+			continue
+		}
+		out = append(out, keymapTextCodes(string(r))...)
+	}
+	return out
+}
+
+/**
+ * ie "a", "enter", "f5", "ctrl+c" or "ctrl+shift+tab"
+ */
+func parseKeyName(text string) (*KeyCode, error) {
+	parts := strings.Split(strings.ToLower(text), "+")
+	modifiers := 0
+	for _, part := range parts[:len(parts)-1] {
+		modifier, ok := commandModifierNames[part]
+		if !ok {
+			return nil, fmt.Errorf("unknown modifier %q", part)
+		}
+		modifiers |= modifier
+	}
+	name := parts[len(parts)-1]
+	var code *KeyCode
+	if keyCode, ok := commandKeyNames[name]; ok {
+		code = &KeyCode{KeyCode: keyCode}
+	} else if n, err := strconv.Atoi(strings.TrimPrefix(name, "f")); err == nil && strings.HasPrefix(name, "f") && n >= 1 && n <= 10 {
+		code = &KeyCode{KeyCode: KEY_F1 + Linux_Event_Codes(n-1)}
+	} else if len(name) == 1 {
+		code = KeycodeSingleCodes(int(name[0]))
+	}
+	if code == nil {
+		return nil, fmt.Errorf("unknown key %q", text)
+	}
+	code.Modifiers |= modifiers
+	return code, nil
+}
@@ -0,0 +1,68 @@
+package termeverything
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"os"
+	"strings"
+)
+
+/**
+ * The control socket is next to the wayland socket,
+ * ie $XDG_RUNTIME_DIR/wayland-2.control
+ */
+func ControlSocketPath(waylandSocketPath string) string {
+	return waylandSocketPath + ".control"
+}
+
+/**
+ * Listen on the control socket. It takes the same
+ * commands as --headless-input, one per line, and
+ * answers each with a line of JSON (a CommandReply).
+ * Close the listener to remove the socket.
+ */
+func ListenForControl(path string, commands *Commands) (*net.UnixListener, error) {
+	/**
+	 * The wayland socket name was free,
+	 * so this is left over from a crash.
+	 */
+	_ = os.Remove(path)
+	listener, err := net.ListenUnix("unix", &net.UnixAddr{Name: path, Net: "unix"})
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, 0o600); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	go func() {
+		for {
+			conn, err := listener.AcceptUnix()
+			if err != nil {
+				return
+			}
+			go serveControl(conn, commands)
+		}
+	}()
+	return listener, nil
+}
+
+func serveControl(conn *net.UnixConn, commands *Commands) {
+	defer conn.Close()
+	scanner := bufio.NewScanner(conn)
+	encoder := json.NewEncoder(conn)
+	for scanner.Scan() {
+		command := strings.TrimSpace(scanner.Text())
+		if command == "" || strings.HasPrefix(command, "#") {
+			continue
+		}
+		reply, err := commands.Run(command)
+		if err != nil {
+			reply = CommandReply{Error: err.Error()}
+		}
+		if err := encoder.Encode(reply); err != nil {
+			return
+		}
+	}
+}
@@ -20,6 +20,9 @@ const (
 	ModLock    = 1 << 1
 	ModControl = 1 << 2
 	ModAlt     = 1 << 3
+	ModNumLock = 1 << 4 // Mod2
+	ModSuper   = 1 << 6 // Mod4
+	ModLevel3  = 1 << 7 // Mod5, AltGr
 )
 
 // numericKeys and alphaKeys exported here for KeycodeSingleCodes.go
@@ -73,9 +76,23 @@ type XkbdCode interface {
 
 func (*KeyCode) isXkbdCode() {}
 
+type KeyEventType int
+
+const (
+	/**
+	 * Legacy terminal input only tells us a key
+	 * was typed, so press and release it right away.
+	 */
+	KeyEvent_PressAndRelease KeyEventType = iota
+	KeyEvent_Press
+	KeyEvent_Repeat
+	KeyEvent_Release
+)
+
 type KeyCode struct {
 	KeyCode   Linux_Event_Codes
 	Modifiers int
+	Event     KeyEventType
 }
 
 func (k *KeyCode) OrModifiers(modifiers int) {
@@ -87,6 +104,26 @@ func (k *KeyCode) GetModifiers() int {
 }
 
 func ConvertKeycodeToXbdCode(data []byte) []XkbdCode {
+	if start := nextFocusEvent(data); start != -1 {
+		out := ConvertKeycodeToXbdCode(data[:start])
+		out = append(out, &TerminalFocus{Focused: data[start+2] == 'I'})
+		return append(out, ConvertKeycodeToXbdCode(data[start+3:])...)
+	}
+	if KittyKeyboard.Requested {
+		return ParseKittyKeyboardInput(data)
+	}
+	return convertLegacyKeycodeToXbdCode(data)
+}
+
+func convertLegacyKeycodeToXbdCode(data []byte) []XkbdCode {
+	if len(data) == 0 {
+		return nil
+	}
+	if start, end := nextTextRun(data); start != -1 {
+		out := convertAroundText(data[:start])
+		out = append(out, keymapTextCodes(string(data[start:end]))...)
+		return append(out, convertAroundText(data[end:])...)
+	}
 	if len(data) == 1 {
 		if out := KeycodeSingleCodes(int(data[0])); out != nil {
 			return []XkbdCode{out}
@@ -0,0 +1,78 @@
+package termeverything
+
+import (
+	"github.com/mmulet/term.everything/framebuffertoansi"
+	"github.com/mmulet/term.everything/wayland"
+)
+
+/**
+ * Without --output-scale, the desktop is drawn at the
+ * ratio between the part of the terminal we draw to (in
+ * pixels) and the virtual monitor. Apps that support
+ * wp_fractional_scale_v1 then render at exactly the
+ * resolution the terminal can show.
+ */
+type FollowTerminalScale struct {
+	/**
+	 * From --cell-size, nil means use the
+	 * size of a cell reported by the terminal.
+	 */
+	CellSize *wayland.PixelSize
+
+	StatusBarRows int
+}
+
+/**
+ * nil with --output-scale, or with --follow-terminal-size
+ * (then the virtual monitor follows the terminal instead),
+ * or --headless where there is no terminal.
+ */
+func MakeFollowTerminalScale(args *CommandLineArgs) *FollowTerminalScale {
+	if args == nil || args.OutputScale > 0 || args.FollowTerminalSize || args.Headless {
+		return nil
+	}
+	f := &FollowTerminalScale{}
+	if args.CellSize != "" {
+		cellSize := ParsePixelSize(args.CellSize, "cell size")
+		f.CellSize = &cellSize
+	}
+	if !args.HideStatusBar {
+		f.StatusBarRows = 1
+	}
+	return f
+}
+
+/**
+ * In 120ths, like wayland.DesktopScale. false when
+ * the terminal doesn't tell us its size in pixels.
+ */
+func (f *FollowTerminalScale) DesiredScale() (uint32, bool) {
+	termSize := framebuffertoansi.MakeTermSize()
+	cols := termSize.WidthCells
+	rows := termSize.HeightCells - f.StatusBarRows
+	if cols <= 0 || rows <= 0 {
+		return 0, false
+	}
+	var cellSize wayland.PixelSize
+	if f.CellSize != nil {
+		cellSize = *f.CellSize
+	} else if termSize.WidthOfACellInPixels > 0 && termSize.HeightOfACellInPixels > 0 {
+		cellSize = wayland.PixelSize{
+			Width:  wayland.Pixels(termSize.WidthOfACellInPixels),
+			Height: wayland.Pixels(termSize.HeightOfACellInPixels),
+		}
+	} else {
+		return 0, false
+	}
+	monitor := wayland.VirtualMonitorSize
+	if monitor.Width <= 0 || monitor.Height <= 0 {
+		return 0, false
+	}
+	/**
+	 * The desktop keeps its aspect ratio,
+	 * so the smaller ratio is what fits.
+	 */
+	scaleX := int(cols) * int(cellSize.Width) * 120 / int(monitor.Width)
+	scaleY := int(rows) * int(cellSize.Height) * 120 / int(monitor.Height)
+	return uint32(max(min(scaleX, scaleY), 120)), true
+}
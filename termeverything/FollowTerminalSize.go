@@ -0,0 +1,72 @@
+package termeverything
+
+import (
+	"github.com/mmulet/term.everything/framebuffertoansi"
+	"github.com/mmulet/term.everything/wayland"
+)
+
+/**
+ * Used when the terminal doesn't tell
+ * us its size in pixels.
+ */
+var DefaultCellSize = wayland.PixelSize{
+	Width:  8,
+	Height: 16,
+}
+
+/**
+ * For --follow-terminal-size, makes the virtual monitor
+ * the same size as the part of the terminal we draw to.
+ */
+type FollowTerminalSize struct {
+	/**
+	 * From --cell-size, nil means use the
+	 * size of a cell reported by the terminal.
+	 */
+	CellSize *wayland.PixelSize
+
+	StatusBarRows int
+}
+
+func MakeFollowTerminalSize(args *CommandLineArgs) *FollowTerminalSize {
+	if args == nil || !args.FollowTerminalSize || args.Headless {
+		return nil
+	}
+	f := &FollowTerminalSize{}
+	if args.CellSize != "" {
+		cellSize := ParsePixelSize(args.CellSize, "cell size")
+		f.CellSize = &cellSize
+	}
+	if !args.HideStatusBar {
+		f.StatusBarRows = 1
+	}
+	return f
+}
+
+func (f *FollowTerminalSize) DesiredSize() (wayland.PixelSize, bool) {
+	termSize := framebuffertoansi.MakeTermSize()
+	cols := termSize.WidthCells
+	rows := termSize.HeightCells - f.StatusBarRows
+	if cols <= 0 || rows <= 0 {
+		return wayland.PixelSize{}, false
+	}
+
+	cellSize := DefaultCellSize
+	if f.CellSize != nil {
+		cellSize = *f.CellSize
+	} else if termSize.WidthOfACellInPixels > 0 && termSize.HeightOfACellInPixels > 0 {
+		cellSize = wayland.PixelSize{
+			Width:  wayland.Pixels(termSize.WidthOfACellInPixels),
+			Height: wayland.Pixels(termSize.HeightOfACellInPixels),
+		}
+	}
+	/**
+	 * The desktop is DesktopScale / 120 times the virtual
+	 * monitor, so it is the terminal size in pixels
+	 */
+	scale := wayland.Pixels(wayland.DesktopScale)
+	return wayland.PixelSize{
+		Width:  max(wayland.Pixels(cols)*cellSize.Width*120/scale, 1),
+		Height: max(wayland.Pixels(rows)*cellSize.Height*120/scale, 1),
+	}, true
+}
@@ -0,0 +1,134 @@
+package termeverything
+
+import (
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"syscall"
+
+	"github.com/mmulet/term.everything/wayland"
+)
+
+/**
+ * With --headless frames go here instead of to
+ * the terminal. --headless-output is a directory
+ * (a PNG per frame), or a file, pipe or - (stdout)
+ * for a stream of raw RGBA frames, each one
+ * width * height * 4 bytes.
+ */
+type HeadlessOutput struct {
+	/**
+	 * Write frame-000001.png, ... here, "" if not
+	 */
+	Dir string
+
+	/**
+	 * Raw RGBA frames, nil if not
+	 */
+	Stream io.WriteCloser
+
+	FrameCount int
+
+	/**
+	 * The last frame, as RGBA
+	 */
+	Frame *image.RGBA
+}
+
+func MakeHeadlessOutput(output string) (*HeadlessOutput, error) {
+	h := &HeadlessOutput{}
+	switch output {
+	case "":
+	case "-":
+		stream, err := takeStdout()
+		if err != nil {
+			return nil, err
+		}
+		h.Stream = stream
+	default:
+		if info, err := os.Stat(output); err == nil && info.IsDir() {
+			h.Dir = output
+			break
+		}
+		file, err := os.OpenFile(output, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+		if err != nil {
+			return nil, err
+		}
+		h.Stream = file
+	}
+	return h, nil
+}
+
+/**
+ * Write the desktop if it changed since the last frame
+ */
+func (h *HeadlessOutput) WriteFrame(desktop *wayland.Desktop) {
+	damage := desktop.TakeDamage()
+	if damage != nil && len(damage) == 0 {
+		return
+	}
+	if h.Frame == nil || h.Frame.Rect.Dx() != desktop.Width || h.Frame.Rect.Dy() != desktop.Height {
+		h.Frame = image.NewRGBA(image.Rect(0, 0, desktop.Width, desktop.Height))
+	}
+	wayland.BgraToRgba(h.Frame, desktop.RGBA, true)
+	h.FrameCount++
+
+	if h.Dir != "" {
+		path := filepath.Join(h.Dir, fmt.Sprintf("frame-%06d.png", h.FrameCount))
+		if err := writePNG(path, h.Frame); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to write %s: %v\n", path, err)
+		}
+	}
+	if h.Stream != nil {
+		if _, err := h.Stream.Write(h.Frame.Pix); err != nil {
+			/**
+			 * ie the reader of the pipe went away
+			 */
+			fmt.Fprintf(os.Stderr, "Stopped writing frames: %v\n", err)
+			h.Stream.Close()
+			h.Stream = nil
+		}
+	}
+}
+
+func (h *HeadlessOutput) Close() {
+	if h.Stream != nil {
+		h.Stream.Close()
+	}
+	h.Stream = nil
+}
+
+/**
+ * With --headless-output - stdout is only for frames,
+ * but we (and the wayland package) print diagnostics
+ * there, and one of them would shift every frame after
+ * it. Returns a copy of stdout for the frames, and
+ * points stdout (fd 1) at stderr.
+ */
+func takeStdout() (*os.File, error) {
+	fd, err := syscall.Dup(int(os.Stdout.Fd()))
+	if err != nil {
+		return nil, err
+	}
+	syscall.CloseOnExec(fd)
+	if err := syscall.Dup3(int(os.Stderr.Fd()), int(os.Stdout.Fd()), 0); err != nil {
+		syscall.Close(fd)
+		return nil, err
+	}
+	return os.NewFile(uintptr(fd), "frames"), nil
+}
+
+func writePNG(path string, img image.Image) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := png.Encode(file, img); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
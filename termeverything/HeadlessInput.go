@@ -0,0 +1,52 @@
+package termeverything
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+/**
+ * With --headless input comes from --headless-input
+ * instead of the terminal. Runs the script, then
+ * keeps taking new clients until we exit.
+ */
+func (tw *TerminalWindow) HeadlessInputLoop(commands *Commands) {
+	defer func() {
+		for client := range tw.GetClients {
+			tw.InputAccess.Lock()
+			tw.Clients = append(tw.Clients, client)
+			tw.InputAccess.Unlock()
+		}
+	}()
+	if tw.Args.HeadlessInput == "" {
+		return
+	}
+	var script io.Reader = os.Stdin
+	if tw.Args.HeadlessInput != "-" {
+		file, err := os.Open(tw.Args.HeadlessInput)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to open --headless-input: %v\n", err)
+			GlobalExitChan <- 1
+			return
+		}
+		defer file.Close()
+		script = file
+	}
+	scanner := bufio.NewScanner(script)
+	line := 0
+	for scanner.Scan() {
+		line++
+		command := strings.TrimSpace(scanner.Text())
+		if command == "" || strings.HasPrefix(command, "#") {
+			continue
+		}
+		if _, err := commands.Run(command); err != nil {
+			fmt.Fprintf(os.Stderr, "%s line %d: %v\n", tw.Args.HeadlessInput, line, err)
+			GlobalExitChan <- 1
+			return
+		}
+	}
+}
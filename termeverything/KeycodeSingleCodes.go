@@ -13,6 +13,10 @@ func KeycodeSingleCodes(d int) *KeyCode {
 		case 3, 9, 13:
 			// skip (handled below)
 		default:
+			if code := KeymapKeyCode(rune('a' + d - 1)); code != nil {
+				code.Modifiers |= ModControl
+				return code
+			}
 			return &KeyCode{
 				KeyCode:   alphaKeys[d-1],
 				Modifiers: ModControl,
@@ -20,6 +24,12 @@ func KeycodeSingleCodes(d int) *KeyCode {
 		}
 	}
 
+	if d >= 32 && d <= 126 {
+		if code := KeymapKeyCode(rune(d)); code != nil {
+			return code
+		}
+	}
+
 	if d >= 48 && d <= 57 {
 		return &KeyCode{
 			KeyCode:   numericKeys[d-48],
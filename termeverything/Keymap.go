@@ -0,0 +1,50 @@
+package termeverything
+
+import "github.com/mmulet/term.everything/wayland"
+
+/**
+ * How to type r on the keymap apps were given
+ * (--keymap or XKB_DEFAULT_LAYOUT), nil if we are
+ * using the embedded US keymap or r is not on it.
+ */
+func KeymapKeyCode(r rune) *KeyCode {
+	key, ok := wayland.KeymapKeyForRune(r)
+	if !ok {
+		return nil
+	}
+	modifiers := 0
+	if key.Level&1 != 0 {
+		modifiers |= ModShift
+	}
+	if key.Level&2 != 0 {
+		modifiers |= ModLevel3
+	}
+	return &KeyCode{KeyCode: Linux_Event_Codes(key.Key), Modifiers: modifiers}
+}
+
+/**
+ * Characters on the keymap are typed as keys,
+ * the runs of the others are sent as text.
+ */
+func keymapTextCodes(text string) []XkbdCode {
+	out := make([]XkbdCode, 0)
+	start := -1
+	for i, r := range text {
+		code := KeymapKeyCode(r)
+		if code == nil {
+			if start == -1 {
+				start = i
+			}
+			continue
+		}
+		if start != -1 {
+			out = append(out, &Text{Text: text[start:i]})
+			start = -1
+		}
+		out = append(out, code)
+	}
+	if start != -1 {
+		out = append(out, &Text{Text: text[start:]})
+	}
+	return out
+}
@@ -0,0 +1,290 @@
+package termeverything
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+)
+
+/**
+ * Support for the kitty keyboard protocol
+ * https://sw.kovidgoyal.net/kitty/keyboard-protocol/
+ * which gives us real key release events.
+ */
+type KittyKeyboardState struct {
+	/**
+	 * We pushed the flags (--kitty-keyboard)
+	 */
+	Requested bool
+	/**
+	 * The terminal answered our query, so
+	 * it understood the flags. Until then
+	 * we parse input the legacy way.
+	 */
+	Supported bool
+}
+
+var KittyKeyboard KittyKeyboardState
+
+func ParseKittyKeyboardInput(data []byte) []XkbdCode {
+	if !KittyKeyboard.Supported && !bytes.Contains(data, []byte("\x1b[?")) {
+		return convertLegacyKeycodeToXbdCode(data)
+	}
+	out := make([]XkbdCode, 0)
+	i := 0
+	for i < len(data) {
+		if data[i] != 27 || i+1 >= len(data) || data[i+1] != '[' {
+			/**
+			 * Everything up to the next CSI
+			 */
+			next := bytes.Index(data[i+1:], []byte("\x1b["))
+			end := len(data)
+			if next != -1 {
+				end = i + 1 + next
+			}
+			out = append(out, convertLegacyKeycodeToXbdCode(data[i:end])...)
+			i = end
+			continue
+		}
+		end := i + 2
+		for end < len(data) && (data[end] < 0x40 || data[end] > 0x7e) {
+			end++
+		}
+		if end >= len(data) {
+			out = append(out, convertLegacyKeycodeToXbdCode(data[i:])...)
+			break
+		}
+		sequence := data[i : end+1]
+		i = end + 1
+
+		params := sequence[2 : len(sequence)-1]
+		final := sequence[len(sequence)-1]
+
+		if len(params) > 0 && params[0] == '?' && final == 'u' {
+			/**
+			 * Reply to QueryKittyKeyboardFlags
+			 */
+			KittyKeyboard.Supported = true
+			continue
+		}
+		if len(params) > 0 && params[0] == '<' {
+			out = append(out, ParseSGRMouseSequences(sequence)...)
+			continue
+		}
+		if KittyKeyboard.Supported {
+			if code := parseKittyKey(string(params), final); code != nil {
+				out = append(out, code)
+				continue
+			}
+			if final == 'u' {
+				if text := kittyText(string(params)); text != nil {
+					out = append(out, text)
+				}
+				continue
+			}
+		}
+		out = append(out, convertLegacyKeycodeToXbdCode(sequence)...)
+	}
+	return out
+}
+
+/**
+ * CSI key-code[:alternates] ; modifiers[:event-type] ; text u
+ * CSI number ; modifiers[:event-type] ~
+ * CSI 1 ; modifiers[:event-type] {ABCDEFHPQS}
+ */
+func parseKittyKey(params string, final byte) *KeyCode {
+	fields := strings.Split(params, ";")
+
+	number := 1
+	if first := strings.Split(fields[0], ":")[0]; first != "" {
+		n, err := strconv.Atoi(first)
+		if err != nil {
+			return nil
+		}
+		number = n
+	}
+
+	modifiers := 0
+	event := KeyEvent_Press
+	if len(fields) > 1 {
+		parts := strings.Split(fields[1], ":")
+		if parts[0] != "" {
+			m, err := strconv.Atoi(parts[0])
+			if err != nil {
+				return nil
+			}
+			modifiers = kittyModifiers(m)
+		}
+		if len(parts) > 1 {
+			switch parts[1] {
+			case "2":
+				event = KeyEvent_Repeat
+			case "3":
+				event = KeyEvent_Release
+			}
+		}
+	}
+
+	var code *KeyCode
+	switch final {
+	case 'u':
+		code = kittyKeyFromCodepoint(number)
+	case '~':
+		if keyCode, ok := kittyTildeKeys[number]; ok {
+			code = &KeyCode{KeyCode: keyCode}
+		}
+	default:
+		if keyCode, ok := kittyLetterKeys[final]; ok && number == 1 {
+			code = &KeyCode{KeyCode: keyCode}
+		}
+	}
+	if code == nil {
+		return nil
+	}
+	code.Modifiers |= modifiers
+	code.Event = event
+	return code
+}
+
+/**
+ * kitty sends 1 + a bit field of
+ * shift, alt, ctrl, super, hyper, meta, caps_lock, num_lock
+ */
+func kittyModifiers(encoded int) int {
+	bits := encoded - 1
+	if bits < 0 {
+		return 0
+	}
+	modifiers := 0
+	if bits&1 != 0 {
+		modifiers |= ModShift
+	}
+	if bits&2 != 0 {
+		modifiers |= ModAlt
+	}
+	if bits&4 != 0 {
+		modifiers |= ModControl
+	}
+	if bits&8 != 0 {
+		modifiers |= ModSuper
+	}
+	if bits&64 != 0 {
+		modifiers |= ModLock
+	}
+	if bits&128 != 0 {
+		modifiers |= ModNumLock
+	}
+	return modifiers
+}
+
+func kittyKeyFromCodepoint(codepoint int) *KeyCode {
+	switch codepoint {
+	case 27:
+		return &KeyCode{KeyCode: KEY_ESC}
+	case 13:
+		return &KeyCode{KeyCode: KEY_ENTER}
+	case 9:
+		return &KeyCode{KeyCode: KEY_TAB}
+	case 8, 127:
+		return &KeyCode{KeyCode: KEY_BACKSPACE}
+	}
+	if keyCode, ok := kittyFunctionalKeys[codepoint]; ok {
+		return &KeyCode{KeyCode: keyCode}
+	}
+	if codepoint >= 57376 && codepoint <= 57387 {
+		return &KeyCode{KeyCode: KEY_F13 + Linux_Event_Codes(codepoint-57376)}
+	}
+	if codepoint >= 32 && codepoint < 127 {
+		return KeycodeSingleCodes(codepoint)
+	}
+	/**
+	 * Not on the keymap, it is sent as text
+	 */
+	return KeymapKeyCode(rune(codepoint))
+}
+
+var kittyTildeKeys = map[int]Linux_Event_Codes{
+	2:  KEY_INSERT,
+	3:  KEY_DELETE,
+	5:  KEY_PAGEUP,
+	6:  KEY_PAGEDOWN,
+	7:  KEY_HOME,
+	8:  KEY_END,
+	11: KEY_F1,
+	12: KEY_F2,
+	13: KEY_F3,
+	14: KEY_F4,
+	15: KEY_F5,
+	17: KEY_F6,
+	18: KEY_F7,
+	19: KEY_F8,
+	20: KEY_F9,
+	21: KEY_F10,
+	23: KEY_F11,
+	24: KEY_F12,
+	29: KEY_COMPOSE,
+}
+
+var kittyLetterKeys = map[byte]Linux_Event_Codes{
+	'A': KEY_UP,
+	'B': KEY_DOWN,
+	'C': KEY_RIGHT,
+	'D': KEY_LEFT,
+	'E': KEY_KP5,
+	'F': KEY_END,
+	'H': KEY_HOME,
+	'P': KEY_F1,
+	'Q': KEY_F2,
+	'S': KEY_F4,
+}
+
+/**
+ * kitty's private use area codepoints
+ */
+var kittyFunctionalKeys = map[int]Linux_Event_Codes{
+	57358: KEY_CAPSLOCK,
+	57359: KEY_SCROLLLOCK,
+	57360: KEY_NUMLOCK,
+	57361: KEY_SYSRQ,
+	57362: KEY_PAUSE,
+	57363: KEY_COMPOSE,
+
+	57399: KEY_KP0,
+	57400: KEY_KP1,
+	57401: KEY_KP2,
+	57402: KEY_KP3,
+	57403: KEY_KP4,
+	57404: KEY_KP5,
+	57405: KEY_KP6,
+	57406: KEY_KP7,
+	57407: KEY_KP8,
+	57408: KEY_KP9,
+	57409: KEY_KPDOT,
+	57410: KEY_KPSLASH,
+	57411: KEY_KPASTERISK,
+	57412: KEY_KPMINUS,
+	57413: KEY_KPPLUS,
+	57414: KEY_KPENTER,
+	57415: KEY_KPEQUAL,
+	57417: KEY_KP4,
+	57418: KEY_KP6,
+	57419: KEY_KP8,
+	57420: KEY_KP2,
+	57421: KEY_KP9,
+	57422: KEY_KP3,
+	57423: KEY_KP7,
+	57424: KEY_KP1,
+	57425: KEY_KP0,
+	57426: KEY_KPDOT,
+	57427: KEY_KP5,
+
+	57441: KEY_LEFTSHIFT,
+	57442: KEY_LEFTCTRL,
+	57443: KEY_LEFTALT,
+	57444: KEY_LEFTMETA,
+	57447: KEY_RIGHTSHIFT,
+	57448: KEY_RIGHTCTRL,
+	57449: KEY_RIGHTALT,
+	57450: KEY_RIGHTMETA,
+}
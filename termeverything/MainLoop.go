@@ -2,32 +2,89 @@ package termeverything
 
 import (
 	"fmt"
+	"io"
 	"os"
-	"os/exec"
 	"strings"
 
+	"github.com/mmulet/term.everything/framebuffertoansi"
 	"github.com/mmulet/term.everything/wayland"
 )
 
 func MainLoop() {
+	if len(os.Args) > 1 && os.Args[1] == "play" {
+		os.Exit(Play(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "attach" {
+		os.Exit(Attach(os.Args[2:]))
+	}
 	args := ParseArgs()
+	if args.Session != "" && !args.SessionServer {
+		os.Exit(StartSession(&args))
+	}
 	SetVirtualMonitorSize(args.VirtualMonitorSize)
+	wayland.ZeroCopyBuffers = args.ZeroCopyBuffers
+	if args.OutputScale > 0 {
+		wayland.OutputScale = int32(args.OutputScale)
+		wayland.DesktopScale = uint32(args.OutputScale) * 120
+	}
+	if err := wayland.LoadKeymap(args.Keymap); err != nil {
+		if args.Keymap != "" {
+			fmt.Fprintf(os.Stderr, "Failed to load keymap %s: %v\n", args.Keymap, err)
+			os.Exit(1)
+		}
+		fmt.Fprintf(os.Stderr, "Failed to load the keymap from XKB_DEFAULT_LAYOUT, using US: %v\n", err)
+	}
 	listener, err := wayland.MakeSocketListener(&args)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Failed to create socket listener: %v\n", err)
 		os.Exit(1)
 	}
 
-	displaySize := wayland.Size{
-		Width:  uint32(wayland.VirtualMonitorSize.Width),
-		Height: uint32(wayland.VirtualMonitorSize.Height),
-	}
+	displaySize := wayland.DesktopSizeForMonitor(wayland.VirtualMonitorSize)
 
 	terminalWindow := MakeTerminalWindow(listener,
-		displaySize,
 		&args,
 	)
 
+	var headless *HeadlessOutput
+	if args.Headless {
+		headless, err = MakeHeadlessOutput(args.HeadlessOutput)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to open --headless-output: %v\n", err)
+			os.Exit(1)
+		}
+		terminalWindow.OnExitCall(headless.Close)
+		fmt.Fprintf(os.Stderr, "Headless, frames are %dx%d\n", displaySize.Width, displaySize.Height)
+	}
+
+	var recorder *CastRecorder
+	if args.Record != "" && !args.Headless {
+		/**
+		 * Shared memory and temp files
+		 * can't be replayed somewhere else
+		 */
+		if os.Getenv("TERM_EVERYTHING_KITTY_TRANSMISSION") == "" {
+			os.Setenv("TERM_EVERYTHING_KITTY_TRANSMISSION", "DIRECT")
+		}
+		recorder, err = MakeCastRecorder(args.Record, args.RecordInput)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to create --record file: %v\n", err)
+			os.Exit(1)
+		}
+		terminalWindow.OnExitCall(recorder.Close)
+		terminalWindow.Recorder = recorder
+	}
+
+	var videoRecorder *VideoRecorder
+	if args.RecordVideo != "" {
+		videoRecorder, err = MakeVideoRecorder(args.RecordVideo, args.RecordVideoFps)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to create --record-video file: %v\n", err)
+			os.Exit(1)
+		}
+		terminalWindow.OnExitCall(videoRecorder.Close)
+	}
+
 	terminanDrawLoop := MakeTerminalDrawLoop(
 		displaySize,
 		args.HideStatusBar,
@@ -37,65 +94,143 @@ func MainLoop() {
 		&args,
 	)
 
+	terminanDrawLoop.Headless = headless
+	terminanDrawLoop.VideoRecorder = videoRecorder
+
+	commands := &Commands{Window: terminalWindow, DrawLoop: terminanDrawLoop}
+
+	if args.SessionServer {
+		session, err := ListenForSession(args.Session, commands)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to create the session socket: %v\n", err)
+			os.Exit(1)
+		}
+		terminalWindow.OnExitCall(func() { session.Close(terminalWindow.ExitCode) })
+		framebuffertoansi.TerminalWinsize = session.GetWinsize
+		terminalWindow.Session = session
+		terminanDrawLoop.Session = session
+		terminanDrawLoop.Terminal = session
+		terminanDrawLoop.DrawState.Output = session
+		terminanDrawLoop.StatusLine.Detach = &StatusLineButton{
+			Button: LineButton{
+				String: "[Detach]",
+				Callback: func() {
+					/**
+					 * Detach locks the clients
+					 */
+					go session.Detach()
+				},
+			},
+		}
+	}
+	if recorder != nil {
+		terminanDrawLoop.Recorder = recorder
+		terminanDrawLoop.DrawState.Output = io.MultiWriter(terminanDrawLoop.Terminal, recorder)
+	}
+	controlSocketPath := ControlSocketPath(listener.SocketPath)
+	if control, err := ListenForControl(controlSocketPath, commands); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to create the control socket: %v\n", err)
+		controlSocketPath = ""
+	} else {
+		terminalWindow.OnExitCall(func() { control.Close() })
+	}
+
 	go listener.MainLoopThenClose()
-	go terminalWindow.InputLoop()
+	if headless != nil {
+		go terminalWindow.HeadlessInputLoop(commands)
+	} else if !args.SessionServer {
+		/**
+		 * A session's input comes from
+		 * the attached terminal
+		 */
+		go terminalWindow.InputLoop()
+	}
 	go terminanDrawLoop.MainLoop()
 
-	done := make(chan struct{})
+	/**
+	 * nil when we run until we are told to quit
+	 */
+	var lifetime *AppLifetime
+	if len(args.Positionals) > 0 && !args.KeepRunning {
+		lifetime = MakeAppLifetime()
+	}
 	go func() {
 		for {
 			conn := <-listener.OnConnection
 			client := wayland.MakeClient(conn)
 			terminalWindow.GetClients <- client
 			terminanDrawLoop.GetClients <- client
-			go client.MainLoop()
+			if lifetime == nil {
+				go client.MainLoop()
+				continue
+			}
+			pid := PeerPid(conn)
+			lifetime.ClientConnected <- pid
+			go func() {
+				_ = client.MainLoop()
+				lifetime.ClientDisconnected <- pid
+			}()
 		}
 	}()
 
-	if len(args.Positionals) > 0 {
-		cmdStr := strings.Join(args.Positionals, " ")
-		shell := args.Shell
-		cmd := exec.Command(shell, "-c", cmdStr)
+	/**
+	 * Xwayland connects to us, so it has to
+	 * start after we are accepting clients.
+	 */
+	xwayland, err := StartXwayland(&args, listener.WaylandDisplayName)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to start Xwayland: %v\n", err)
+	}
+	xwaylandPid := -1
+	if xwayland != nil {
+		terminalWindow.OnExitCall(xwayland.Stop)
+		xwaylandPid = xwayland.Server.Process.Pid
+	}
 
-		baseEnv := os.Environ()
-		filtered := make([]string, 0, len(baseEnv))
-		for _, e := range baseEnv {
-			if strings.HasPrefix(e, "DISPLAY=") {
-				continue
-			}
+	if len(args.Positionals) == 0 {
+		select {}
+	}
 
-			if !args.SupportOldApps && strings.HasPrefix(e, "XDG_SESSION_TYPE=") {
-				continue
-			}
-			filtered = append(filtered, e)
-		}
-		filtered = append(filtered, fmt.Sprintf("WAYLAND_DISPLAY=%s", listener.WaylandDisplayName))
-		if !args.SupportOldApps {
-			filtered = append(filtered, "XDG_SESSION_TYPE=wayland")
+	filtered := make([]string, 0)
+	for _, e := range os.Environ() {
+		if strings.HasPrefix(e, "DISPLAY=") {
+			continue
 		}
 
-		cmd.Env = filtered
-		// cmd.Stdout = os.Stdout
-		// cmd.Stderr = os.Stderr
-		// cmd.Stdin = os.Stdin
-
-		if err := cmd.Start(); err != nil {
-			fmt.Fprintf(os.Stderr, "Failed to start command: %v\n", err)
-		} else {
-			go func() {
-				_ = cmd.Wait()
-			}()
+		if !args.SupportOldApps && strings.HasPrefix(e, "XDG_SESSION_TYPE=") {
+			continue
 		}
+		filtered = append(filtered, e)
+	}
+	filtered = append(filtered, fmt.Sprintf("WAYLAND_DISPLAY=%s", listener.WaylandDisplayName))
+	if controlSocketPath != "" {
+		filtered = append(filtered, fmt.Sprintf("TERM_EVERYTHING_CONTROL_SOCKET=%s", controlSocketPath))
+	}
+	if xwayland != nil {
+		filtered = append(filtered, fmt.Sprintf("DISPLAY=%s", xwayland.Display))
+	}
+	if !args.SupportOldApps {
+		filtered = append(filtered, "XDG_SESSION_TYPE=wayland")
 	}
 
-	<-done
-
-	//TODO start xwaylnd_if_neccessary
+	child, err := StartChildProcess(
+		strings.Join(args.Positionals, " "),
+		args.Shell,
+		filtered,
+		ChildLogPath(&args, listener.WaylandDisplayName),
+	)
+	if err != nil {
+		terminalWindow.OnExitCall(func() {
+			fmt.Fprintf(os.Stderr, "Failed to start command: %v\n", err)
+		})
+		GlobalExitChan <- 127
+		select {}
+	}
+	terminalWindow.OnExitCall(child.PrintLogLocation)
 
-	// // Wait for SigInt, TODO something different
-	// sig := make(chan os.Signal, 1)
-	// signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
-	// <-sig
-	// _ = listener.Close()
-	// fmt.Println("Shutdown complete")
+	if lifetime == nil {
+		select {}
+	}
+	GlobalExitChan <- lifetime.WaitForExit(child, xwaylandPid)
+	select {}
 }
@@ -27,13 +27,43 @@ type CommandLineArgs struct {
 	DebugLog              bool
 	ReverseScroll         bool
 	MaxFrameRate          string
-	Positionals           []string
+	KittyKeyboard         bool
+	FollowTerminalSize    bool
+	CellSize              string
+	KeepRunning           bool
+	AppLog                string
+	ZeroCopyBuffers       bool
+	OutputScale           int
+	Keymap                string
+	Headless              bool
+	HeadlessOutput        string
+	HeadlessInput         string
+	Record                string
+	RecordInput           bool
+	RecordVideo           string
+	RecordVideoFps        float64
+	ScreenshotDir         string
+	Session               string
+	/**
+	 * The process --session starts in the
+	 * background, not in the help
+	 */
+	SessionServer bool
+	Positionals   []string
 }
 
 func (args *CommandLineArgs) WaylandDisplayName() string {
 	return args.WaylandDisplayNameArg
 }
 
+/**
+ * False with --headless (no terminal) and in a
+ * session server (the terminal is attached later)
+ */
+func (args *CommandLineArgs) OwnsTerminal() bool {
+	return !args.Headless && !args.SessionServer
+}
+
 func ParseArgs() CommandLineArgs {
 	var args CommandLineArgs
 
@@ -51,6 +81,24 @@ func ParseArgs() CommandLineArgs {
 	licensesFlag := flag.Bool("licenses", false, "")
 	flag.BoolVar(&args.ReverseScroll, "reverse-scroll", false, "")
 	flag.StringVar(&args.MaxFrameRate, "max-frame-rate", "", "")
+	flag.BoolVar(&args.KittyKeyboard, "kitty-keyboard", false, "")
+	flag.BoolVar(&args.FollowTerminalSize, "follow-terminal-size", false, "")
+	flag.StringVar(&args.CellSize, "cell-size", "", "")
+	flag.BoolVar(&args.KeepRunning, "keep-running", false, "")
+	flag.StringVar(&args.AppLog, "app-log", "", "")
+	flag.BoolVar(&args.ZeroCopyBuffers, "zero-copy-buffers", false, "")
+	flag.IntVar(&args.OutputScale, "output-scale", 0, "")
+	flag.StringVar(&args.Keymap, "keymap", "", "")
+	flag.BoolVar(&args.Headless, "headless", false, "")
+	flag.StringVar(&args.HeadlessOutput, "headless-output", "", "")
+	flag.StringVar(&args.HeadlessInput, "headless-input", "", "")
+	flag.StringVar(&args.Record, "record", "", "")
+	flag.BoolVar(&args.RecordInput, "record-input", false, "")
+	flag.StringVar(&args.RecordVideo, "record-video", "", "")
+	flag.Float64Var(&args.RecordVideoFps, "record-video-fps", 10, "")
+	flag.StringVar(&args.ScreenshotDir, "screenshot-dir", "", "")
+	flag.StringVar(&args.Session, "session", "", "")
+	flag.BoolVar(&args.SessionServer, "session-server", false, "")
 
 	flag.Parse()
 
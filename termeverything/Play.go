@@ -0,0 +1,124 @@
+package termeverything
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/mmulet/term.everything/escapecodes"
+	"github.com/mmulet/term.everything/framebuffertoansi"
+)
+
+/**
+ * term.everything play [--speed N] file.cast
+ * Replays a --record file (or any asciicast v2)
+ * in the terminal.
+ */
+func Play(arguments []string) int {
+	flags := flag.NewFlagSet("play", flag.ExitOnError)
+	speed := flags.Float64("speed", 1, "")
+	flags.Parse(arguments)
+	if flags.NArg() != 1 || *speed <= 0 {
+		fmt.Fprintf(os.Stderr, "Usage: term.everything play [--speed N] file.cast\n")
+		return 2
+	}
+	file, err := os.Open(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	/**
+	 * A frame of sixels or kitty graphics
+	 * is one (very long) line
+	 */
+	scanner.Buffer(make([]byte, 0, 1<<20), 1<<30)
+	if !scanner.Scan() {
+		fmt.Fprintf(os.Stderr, "%s is empty\n", flags.Arg(0))
+		return 1
+	}
+	var header struct {
+		Version       int     `json:"version"`
+		Width         int     `json:"width"`
+		Height        int     `json:"height"`
+		IdleTimeLimit float64 `json:"idle_time_limit"`
+	}
+	if err := json.Unmarshal(scanner.Bytes(), &header); err != nil || header.Version != 2 {
+		fmt.Fprintf(os.Stderr, "%s is not an asciicast v2 file\n", flags.Arg(0))
+		return 1
+	}
+	if winsize, err := framebuffertoansi.GetWinsize(os.Stdout.Fd()); err == nil &&
+		(int(winsize.Col) < header.Width || int(winsize.Row) < header.Height) {
+		fmt.Fprintf(os.Stderr, "It was recorded in a %dx%d terminal, this one is %dx%d, it may not look right.\n",
+			header.Width, header.Height, winsize.Col, winsize.Row)
+		time.Sleep(2 * time.Second)
+	}
+
+	restore := func() {
+		os.Stdout.WriteString(escapecodes.DisableAlternativeScreenBuffer)
+		os.Stdout.WriteString(escapecodes.ShowCursor)
+	}
+	os.Stdout.WriteString(escapecodes.EnableAlternativeScreenBuffer)
+	os.Stdout.WriteString(escapecodes.HideCursor)
+	os.Stdout.WriteString(escapecodes.ClearScreen)
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-sigCh
+		restore()
+		os.Exit(130)
+	}()
+
+	start := time.Now()
+	/**
+	 * Where we are in the recording, pauses longer
+	 * than idle_time_limit are cut short
+	 */
+	var played float64
+	var last float64
+	for scanner.Scan() {
+		var event []json.RawMessage
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil || len(event) != 3 {
+			continue
+		}
+		var seconds float64
+		var kind, data string
+		if json.Unmarshal(event[0], &seconds) != nil ||
+			json.Unmarshal(event[1], &kind) != nil ||
+			json.Unmarshal(event[2], &data) != nil {
+			continue
+		}
+		pause := seconds - last
+		if header.IdleTimeLimit > 0 {
+			pause = min(pause, header.IdleTimeLimit)
+		}
+		last = seconds
+		played += max(pause, 0)
+		if kind != "o" {
+			continue
+		}
+		if wait := time.Duration(played / *speed * float64(time.Second)) - time.Since(start); wait > 0 {
+			time.Sleep(wait)
+		}
+		os.Stdout.WriteString(data)
+	}
+	if err := scanner.Err(); err != nil {
+		restore()
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+
+	/**
+	 * Keep the last frame up until enter
+	 */
+	bufio.NewReader(os.Stdin).ReadString('\n')
+	restore()
+	return 0
+}
@@ -0,0 +1,117 @@
+package termeverything
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/mmulet/term.everything/framebuffertoansi"
+)
+
+/**
+ * --record writes an asciicast v2 file
+ * https://docs.asciinema.org/manual/asciicast/v2/
+ * a header line, then a JSON array per event:
+ * [seconds since start, "o" (output) | "i" (input) | "r" (resize), data]
+ */
+type CastRecorder struct {
+	Access sync.Mutex
+	File   *os.File
+	Start  time.Time
+	/**
+	 * --record-input, also record what was typed
+	 */
+	RecordInput bool
+}
+
+type castHeader struct {
+	Version   int               `json:"version"`
+	Width     int               `json:"width"`
+	Height    int               `json:"height"`
+	Timestamp int64             `json:"timestamp"`
+	Title     string            `json:"title,omitempty"`
+	Env       map[string]string `json:"env,omitempty"`
+}
+
+func MakeCastRecorder(path string, recordInput bool) (*CastRecorder, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	width, height := 80, 24
+	if winsize, err := framebuffertoansi.GetTerminalWinsize(); err == nil && winsize.Col > 0 && winsize.Row > 0 {
+		width, height = int(winsize.Col), int(winsize.Row)
+	}
+	r := &CastRecorder{
+		File:        file,
+		Start:       time.Now(),
+		RecordInput: recordInput,
+	}
+	header, err := json.Marshal(castHeader{
+		Version:   2,
+		Width:     width,
+		Height:    height,
+		Timestamp: r.Start.Unix(),
+		Title:     "term.everything",
+		Env: map[string]string{
+			"TERM":  os.Getenv("TERM"),
+			"SHELL": os.Getenv("SHELL"),
+		},
+	})
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	if _, err := fmt.Fprintf(file, "%s\n", header); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *CastRecorder) event(kind string, data string) {
+	r.Access.Lock()
+	defer r.Access.Unlock()
+	if r.File == nil {
+		return
+	}
+	seconds := float64(time.Since(r.Start).Microseconds()) / 1e6
+	line, err := json.Marshal([]any{seconds, kind, data})
+	if err != nil {
+		return
+	}
+	if _, err := fmt.Fprintf(r.File, "%s\n", line); err != nil {
+		fmt.Fprintf(os.Stderr, "Stopped recording: %v\n", err)
+		r.File.Close()
+		r.File = nil
+	}
+}
+
+/**
+ * Output, ie what DrawState writes to the terminal
+ */
+func (r *CastRecorder) Write(p []byte) (int, error) {
+	r.event("o", string(p))
+	return len(p), nil
+}
+
+func (r *CastRecorder) Input(p []byte) {
+	if r.RecordInput {
+		r.event("i", string(p))
+	}
+}
+
+func (r *CastRecorder) Resize(cols int, rows int) {
+	r.event("r", fmt.Sprintf("%dx%d", cols, rows))
+}
+
+func (r *CastRecorder) Close() {
+	r.Access.Lock()
+	defer r.Access.Unlock()
+	if r.File != nil {
+		r.File.Close()
+		r.File = nil
+	}
+}
@@ -0,0 +1,205 @@
+package termeverything
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mmulet/term.everything/wayland"
+)
+
+/**
+ * A streaming encoder for --record-video. The
+ * delay of each frame is only known when the next
+ * one comes, so frames are written one behind.
+ */
+type videoEncoder interface {
+	/**
+	 * frame is the whole video frame, only
+	 * changed (which is inside frame) is new.
+	 */
+	WriteFrame(frame *image.RGBA, changed image.Rectangle, delay time.Duration) error
+	Close() error
+}
+
+type videoSample struct {
+	Frame *image.RGBA
+	Time  time.Time
+}
+
+/**
+ * --record-video samples the desktop --record-video-fps
+ * times a second (whatever is drawn to the terminal),
+ * skips frames that did not change, and encodes
+ * them as an animated GIF or APNG.
+ */
+type VideoRecorder struct {
+	Encoder        videoEncoder
+	FrameTime      time.Duration
+	TimeLastSample time.Time
+
+	/**
+	 * The video is the size of the desktop when
+	 * recording started, later frames are cropped.
+	 */
+	Size image.Rectangle
+
+	LastSample *image.RGBA
+
+	/**
+	 * Close comes from the exit callbacks, not the draw loop
+	 */
+	Access  sync.Mutex
+	Closed  bool
+	Samples chan videoSample
+	Done    chan struct{}
+}
+
+func MakeVideoRecorder(path string, fps float64) (*VideoRecorder, error) {
+	if fps <= 0 {
+		return nil, fmt.Errorf("--record-video-fps must be more than 0")
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	var encoder videoEncoder
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".gif":
+		encoder = &gifEncoder{File: file}
+	case ".apng", ".png":
+		encoder = &apngEncoder{File: file}
+	default:
+		file.Close()
+		os.Remove(path)
+		return nil, fmt.Errorf("%s should end in .gif or .apng", path)
+	}
+	r := &VideoRecorder{
+		Encoder:   encoder,
+		FrameTime: time.Duration(float64(time.Second) / fps),
+		Samples:   make(chan videoSample, 8),
+		Done:      make(chan struct{}),
+	}
+	go r.encodeLoop()
+	return r, nil
+}
+
+/**
+ * Called by the draw loop after every draw
+ */
+func (r *VideoRecorder) Sample(desktop *wayland.Desktop) {
+	now := time.Now()
+	if now.Sub(r.TimeLastSample) < r.FrameTime {
+		return
+	}
+	r.TimeLastSample = now
+	if r.Size.Empty() {
+		r.Size = desktop.RGBA.Rect
+	}
+	frame := image.NewRGBA(r.Size)
+	both := r.Size.Intersect(desktop.RGBA.Rect)
+	wayland.BgraToRgba(frame.SubImage(both).(*image.RGBA), desktop.RGBA.SubImage(both).(*image.RGBA), true)
+	if r.LastSample != nil && bytes.Equal(frame.Pix, r.LastSample.Pix) {
+		return
+	}
+	r.LastSample = frame
+	r.Access.Lock()
+	defer r.Access.Unlock()
+	if r.Closed {
+		return
+	}
+	select {
+	case r.Samples <- videoSample{Frame: frame, Time: now}:
+	default:
+		/**
+		 * The encoder is behind, the next
+		 * sample will have this change too.
+		 */
+		r.LastSample = nil
+	}
+}
+
+func (r *VideoRecorder) encodeLoop() {
+	defer close(r.Done)
+	var pending *videoSample
+	var pendingChanged image.Rectangle
+	var previous *image.RGBA
+	failed := false
+	write := func(sample *videoSample, changed image.Rectangle, delay time.Duration) {
+		if failed {
+			return
+		}
+		if err := r.Encoder.WriteFrame(sample.Frame, changed, delay); err != nil {
+			fmt.Fprintf(os.Stderr, "Stopped recording video: %v\n", err)
+			failed = true
+		}
+	}
+	for sample := range r.Samples {
+		changed := sample.Frame.Rect
+		if previous != nil {
+			changed = changedRect(previous, sample.Frame)
+		}
+		previous = sample.Frame
+		if pending != nil {
+			write(pending, pendingChanged, sample.Time.Sub(pending.Time))
+		}
+		pending = &sample
+		pendingChanged = changed
+	}
+	if pending != nil {
+		write(pending, pendingChanged, max(time.Since(pending.Time), r.FrameTime))
+	}
+	if err := r.Encoder.Close(); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to finish --record-video: %v\n", err)
+	}
+}
+
+/**
+ * Stop sampling and finish the file
+ */
+func (r *VideoRecorder) Close() {
+	r.Access.Lock()
+	if !r.Closed {
+		r.Closed = true
+		close(r.Samples)
+	}
+	r.Access.Unlock()
+	<-r.Done
+}
+
+/**
+ * The smallest rectangle with every
+ * pixel that differs, a and b are the same size.
+ */
+func changedRect(a *image.RGBA, b *image.RGBA) image.Rectangle {
+	changed := image.Rectangle{}
+	width := a.Rect.Dx()
+	for y := range a.Rect.Dy() {
+		rowA := a.Pix[y*a.Stride : y*a.Stride+width*4]
+		rowB := b.Pix[y*b.Stride : y*b.Stride+width*4]
+		if bytes.Equal(rowA, rowB) {
+			continue
+		}
+		first := 0
+		for first < width && bytes.Equal(rowA[first*4:first*4+4], rowB[first*4:first*4+4]) {
+			first++
+		}
+		last := width - 1
+		for last > first && bytes.Equal(rowA[last*4:last*4+4], rowB[last*4:last*4+4]) {
+			last--
+		}
+		changed = changed.Union(image.Rect(first, y, last+1, y+1).Add(a.Rect.Min))
+	}
+	if changed.Empty() {
+		/**
+		 * Formats want at least a pixel
+		 */
+		return image.Rect(0, 0, 1, 1).Add(a.Rect.Min)
+	}
+	return changed
+}
@@ -0,0 +1,199 @@
+package termeverything
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/png"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+/**
+ * Three frames: a full one, then two that
+ * only change part of it.
+ */
+func testVideoFrames() ([]*image.RGBA, []image.Rectangle, []time.Duration) {
+	bounds := image.Rect(0, 0, 32, 24)
+	fill := func(img *image.RGBA, r image.Rectangle, c color.RGBA) {
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			for x := r.Min.X; x < r.Max.X; x++ {
+				img.SetRGBA(x, y, c)
+			}
+		}
+	}
+	first := image.NewRGBA(bounds)
+	fill(first, bounds, color.RGBA{0x20, 0x40, 0x60, 0xff})
+	second := image.NewRGBA(bounds)
+	copy(second.Pix, first.Pix)
+	fill(second, image.Rect(8, 4, 20, 12), color.RGBA{0xff, 0, 0, 0xff})
+	third := image.NewRGBA(bounds)
+	copy(third.Pix, second.Pix)
+	fill(third, image.Rect(2, 18, 6, 22), color.RGBA{0, 0xff, 0, 0xff})
+
+	frames := []*image.RGBA{first, second, third}
+	changed := []image.Rectangle{
+		bounds,
+		image.Rect(8, 4, 20, 12),
+		image.Rect(2, 18, 6, 22),
+	}
+	delays := []time.Duration{100 * time.Millisecond, 50 * time.Millisecond, 200 * time.Millisecond}
+	return frames, changed, delays
+}
+
+func writeTestVideo(t *testing.T, encoder videoEncoder) {
+	frames, changed, delays := testVideoFrames()
+	for i := 1; i < len(frames); i++ {
+		if got := changedRect(frames[i-1], frames[i]); got != changed[i] {
+			t.Fatalf("changedRect of frame %d is %v, want %v", i, got, changed[i])
+		}
+	}
+	for i := range frames {
+		if err := encoder.WriteFrame(frames[i], changed[i], delays[i]); err != nil {
+			t.Fatalf("frame %d: %v", i, err)
+		}
+	}
+	if err := encoder.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGifEncoderRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "video.gif")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeTestVideo(t, &gifEncoder{File: file})
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := gif.DecodeAll(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	frames, changed, delays := testVideoFrames()
+	if len(decoded.Image) != len(frames) {
+		t.Fatalf("%d frames, want %d", len(decoded.Image), len(frames))
+	}
+	if decoded.Config.Width != 32 || decoded.Config.Height != 24 {
+		t.Errorf("size %dx%d, want 32x24", decoded.Config.Width, decoded.Config.Height)
+	}
+	for i, frame := range decoded.Image {
+		if frame.Bounds() != changed[i] {
+			t.Errorf("frame %d bounds %v, want %v", i, frame.Bounds(), changed[i])
+		}
+		if want := int(delays[i].Milliseconds() / 10); decoded.Delay[i] != want {
+			t.Errorf("frame %d delay %d, want %d", i, decoded.Delay[i], want)
+		}
+		if decoded.Disposal[i] != gif.DisposalNone {
+			t.Errorf("frame %d disposal %d, want none", i, decoded.Disposal[i])
+		}
+		for y := changed[i].Min.Y; y < changed[i].Max.Y; y++ {
+			for x := changed[i].Min.X; x < changed[i].Max.X; x++ {
+				r, g, b, _ := frame.At(x, y).RGBA()
+				want := frames[i].RGBAAt(x, y)
+				if uint8(r>>8) != want.R || uint8(g>>8) != want.G || uint8(b>>8) != want.B {
+					t.Fatalf("frame %d pixel %d,%d is %d,%d,%d, want %v", i, x, y, r>>8, g>>8, b>>8, want)
+				}
+			}
+		}
+	}
+}
+
+func TestApngEncoderRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "video.apng")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeTestVideo(t, &apngEncoder{File: file})
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signature := []byte("\x89PNG\r\n\x1a\n")
+	if !bytes.HasPrefix(data, signature) {
+		t.Fatal("no PNG signature")
+	}
+	frames, changed, delays := testVideoFrames()
+
+	kinds := make([]string, 0)
+	sequence := uint32(0)
+	controls := 0
+	rest := data[len(signature):]
+	for len(rest) > 0 {
+		if len(rest) < 12 {
+			t.Fatalf("%d bytes left over", len(rest))
+		}
+		length := binary.BigEndian.Uint32(rest)
+		if int(length)+12 > len(rest) {
+			t.Fatalf("chunk of %d bytes, only %d left", length, len(rest)-12)
+		}
+		kind := string(rest[4:8])
+		chunk := rest[8 : 8+length]
+		crc := binary.BigEndian.Uint32(rest[8+length:])
+		if want := crc32.ChecksumIEEE(rest[4 : 8+length]); crc != want {
+			t.Errorf("%s CRC %08x, want %08x", kind, crc, want)
+		}
+		kinds = append(kinds, kind)
+		switch kind {
+		case "acTL":
+			if frameCount := binary.BigEndian.Uint32(chunk); frameCount != uint32(len(frames)) {
+				t.Errorf("acTL has %d frames, want %d", frameCount, len(frames))
+			}
+		case "fcTL", "fdAT":
+			if got := binary.BigEndian.Uint32(chunk); got != sequence {
+				t.Errorf("%s sequence %d, want %d", kind, got, sequence)
+			}
+			sequence++
+		}
+		if kind == "fcTL" {
+			r := changed[controls]
+			width := binary.BigEndian.Uint32(chunk[4:])
+			height := binary.BigEndian.Uint32(chunk[8:])
+			x := binary.BigEndian.Uint32(chunk[12:])
+			y := binary.BigEndian.Uint32(chunk[16:])
+			if image.Rect(int(x), int(y), int(x+width), int(y+height)) != r {
+				t.Errorf("fcTL %d is %dx%d at %d,%d, want %v", controls, width, height, x, y, r)
+			}
+			numerator := binary.BigEndian.Uint16(chunk[20:])
+			denominator := binary.BigEndian.Uint16(chunk[22:])
+			if int64(numerator)*1000/int64(denominator) != delays[controls].Milliseconds() {
+				t.Errorf("fcTL %d delay %d/%d, want %v", controls, numerator, denominator, delays[controls])
+			}
+			controls++
+		}
+		rest = rest[12+length:]
+	}
+	want := []string{"IHDR", "acTL", "fcTL", "IDAT", "fcTL", "fdAT", "fcTL", "fdAT", "IEND"}
+	if !slices.Equal(kinds, want) {
+		t.Errorf("chunks %v, want %v", kinds, want)
+	}
+
+	/**
+	 * Viewers without APNG show the first frame
+	 */
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for y := range 24 {
+		for x := range 32 {
+			r, g, b, a := img.At(x, y).RGBA()
+			want := frames[0].RGBAAt(x, y)
+			if uint8(r>>8) != want.R || uint8(g>>8) != want.G || uint8(b>>8) != want.B || uint8(a>>8) != want.A {
+				t.Fatalf("default image pixel %d,%d is %d,%d,%d,%d, want %v", x, y, r>>8, g>>8, b>>8, a>>8, want)
+			}
+		}
+	}
+}
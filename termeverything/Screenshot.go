@@ -0,0 +1,102 @@
+package termeverything
+
+import (
+	"fmt"
+	"image"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/mmulet/term.everything/wayland"
+)
+
+type ScreenshotKind int
+
+const (
+	ScreenshotNone ScreenshotKind = iota
+	/**
+	 * Desktop.Buffer, everything at full resolution
+	 */
+	ScreenshotDesktop
+	/**
+	 * Only the active window (with its
+	 * subsurfaces and popups)
+	 */
+	ScreenshotWindow
+)
+
+/**
+ * Alt+p saves a screenshot of the desktop,
+ * Alt+Shift+p of the active window.
+ */
+func ScreenshotKeyKind(code XkbdCode) ScreenshotKind {
+	key, ok := code.(*KeyCode)
+	if !ok || key.KeyCode != KEY_P || key.Modifiers&ModAlt == 0 {
+		return ScreenshotNone
+	}
+	if key.Modifiers&ModShift != 0 {
+		return ScreenshotWindow
+	}
+	return ScreenshotDesktop
+}
+
+/**
+ * Saves a PNG in --screenshot-dir (or the current
+ * directory), call with the clients locked. Only the
+ * copy of the pixels is made with them locked, the PNG
+ * is written in the background and where it was saved
+ * (or the error) comes back on ScreenshotNotices.
+ */
+func (tw *TerminalDrawLoop) SaveScreenshot(kind ScreenshotKind) {
+	screenshot, path, err := tw.copyScreenshot(kind)
+	if err != nil {
+		tw.ShowScreenshotNotice("Screenshot failed: " + err.Error())
+		return
+	}
+	if screenshot == nil {
+		return
+	}
+	go func() {
+		notice := "Saved " + path
+		if err := writePNG(path, screenshot); err != nil {
+			notice = "Screenshot failed: " + err.Error()
+		}
+		tw.ScreenshotNotices <- notice
+	}()
+}
+
+func (tw *TerminalDrawLoop) copyScreenshot(kind ScreenshotKind) (*image.RGBA, string, error) {
+	var screenshot *image.RGBA
+	name := "term.everything-" + time.Now().Format("20060102-150405.000")
+	switch kind {
+	case ScreenshotDesktop:
+		screenshot = image.NewRGBA(tw.Desktop.RGBA.Rect)
+		wayland.BgraToRgba(screenshot, tw.Desktop.RGBA, true)
+	case ScreenshotWindow:
+		window := wayland.Focus.ActiveWindowImage()
+		if window == nil {
+			return nil, "", fmt.Errorf("there is no window")
+		}
+		/**
+		 * Keep the transparency around the
+		 * window (ie its shadow)
+		 */
+		screenshot = image.NewRGBA(window.Rect)
+		wayland.BgraToRgba(screenshot, window, false)
+		name += "-window"
+	default:
+		return nil, "", nil
+	}
+	return screenshot, filepath.Join(tw.ScreenshotDir, name+".png"), nil
+}
+
+/**
+ * In the status line, or on stderr with --headless
+ */
+func (tw *TerminalDrawLoop) ShowScreenshotNotice(notice string) {
+	if tw.Headless != nil {
+		fmt.Fprintln(os.Stderr, notice)
+		return
+	}
+	tw.StatusLine.ShowNotice(notice)
+}
@@ -0,0 +1,414 @@
+package termeverything
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mmulet/term.everything/framebuffertoansi"
+	"github.com/mmulet/term.everything/wayland"
+)
+
+/**
+ * With --session, the wayland server, the apps and the
+ * desktop live in a process in the background (the
+ * session server) and a terminal attaches to it with
+ * term.everything attach <session>. Closing the terminal
+ * (or the ssh connection) only detaches it.
+ *
+ * They talk over a unix socket in messages of
+ * a kind byte, a big endian uint32 length, then the data.
+ */
+type SessionMessage byte
+
+const (
+	/**
+	 * Attach to session, a sessionHello
+	 */
+	SessionMessage_Hello SessionMessage = 'h'
+	/**
+	 * Attach to session, bytes read from the terminal
+	 */
+	SessionMessage_Input SessionMessage = 'i'
+	/**
+	 * Attach to session, the terminal's WinSize as JSON
+	 */
+	SessionMessage_Resize SessionMessage = 'r'
+	/**
+	 * Session to attach, bytes to write to the terminal
+	 */
+	SessionMessage_Output SessionMessage = 'o'
+	/**
+	 * Session to attach, you are detached, the session
+	 * keeps going
+	 */
+	SessionMessage_Detach SessionMessage = 'd'
+	/**
+	 * Session to attach, the session ended, the data
+	 * is the exit code
+	 */
+	SessionMessage_Exit SessionMessage = 'x'
+)
+
+/**
+ * Not a real limit, a bad message shouldn't
+ * make us allocate gigabytes
+ */
+const maxSessionMessageLength = 1 << 28
+
+func writeSessionMessage(w io.Writer, kind SessionMessage, data []byte) error {
+	message := make([]byte, 0, 5+len(data))
+	message = append(message, byte(kind))
+	message = binary.BigEndian.AppendUint32(message, uint32(len(data)))
+	message = append(message, data...)
+	_, err := w.Write(message)
+	return err
+}
+
+func readSessionMessage(r *bufio.Reader) (SessionMessage, []byte, error) {
+	var header [5]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return 0, nil, err
+	}
+	length := binary.BigEndian.Uint32(header[1:])
+	if length > maxSessionMessageLength {
+		return 0, nil, fmt.Errorf("session message is too long (%d bytes)", length)
+	}
+	data := make([]byte, length)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return 0, nil, err
+	}
+	return SessionMessage(header[0]), data, nil
+}
+
+type sessionHello struct {
+	Winsize framebuffertoansi.WinSize
+	/**
+	 * The terminal's environment (see terminalEnv),
+	 * it picks how we draw.
+	 */
+	Env []string
+}
+
+/**
+ * Environment variables that say what kind of terminal
+ * it is, and if it is over ssh. They come from the
+ * attached terminal, not from where the session started.
+ * TERM_EVERYTHING_* are options of the session, so they stay.
+ */
+var terminalEnvPrefixes = []string{
+	"TERM=", "TERM_", "COLORTERM=", "VTE_", "KITTY_", "WEZTERM_",
+	"KONSOLE_", "ITERM_", "LC_TERMINAL", "ALACRITTY_", "WT_", "MLTERM",
+	"TERMINOLOGY", "TMUX", "STY=", "SSH_CONNECTION=", "SSH_CLIENT=", "SSH_TTY=",
+}
+
+func isTerminalEnv(entry string) bool {
+	if strings.HasPrefix(entry, "TERM_EVERYTHING_") {
+		return false
+	}
+	for _, prefix := range terminalEnvPrefixes {
+		if strings.HasPrefix(entry, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func terminalEnv() []string {
+	env := make([]string, 0)
+	for _, entry := range os.Environ() {
+		if isTerminalEnv(entry) {
+			env = append(env, entry)
+		}
+	}
+	return env
+}
+
+/**
+ * Replace our terminal environment with the attached one's
+ */
+func useTerminalEnv(env []string) {
+	for _, entry := range os.Environ() {
+		if isTerminalEnv(entry) {
+			name, _, _ := strings.Cut(entry, "=")
+			os.Unsetenv(name)
+		}
+	}
+	for _, entry := range env {
+		if !isTerminalEnv(entry) {
+			continue
+		}
+		name, value, _ := strings.Cut(entry, "=")
+		os.Setenv(name, value)
+	}
+}
+
+/**
+ * $XDG_RUNTIME_DIR/term.everything-sessions
+ */
+func SessionsDir() string {
+	return wayland.GetSocketPathFromName("term.everything-sessions")
+}
+
+func SessionSocketPath(name string) string {
+	return filepath.Join(SessionsDir(), name)
+}
+
+func checkSessionName(name string) error {
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, "/\x00") || strings.HasSuffix(name, ".log") {
+		return fmt.Errorf("%q can't be a session name", name)
+	}
+	return nil
+}
+
+/**
+ * The session server's side
+ */
+type Session struct {
+	Name     string
+	Listener *net.UnixListener
+	Commands *Commands
+
+	/**
+	 * Held while writing to Conn too,
+	 * so messages don't interleave.
+	 */
+	Access sync.Mutex
+	/**
+	 * The attached terminal, nil while detached
+	 */
+	Conn *net.UnixConn
+	/**
+	 * Of the attached terminal, or the last one
+	 * while detached (so the desktop keeps its size)
+	 */
+	Winsize framebuffertoansi.WinSize
+	Closed  bool
+}
+
+func ListenForSession(name string, commands *Commands) (*Session, error) {
+	path := SessionSocketPath(name)
+	if err := os.MkdirAll(SessionsDir(), 0o700); err != nil {
+		return nil, err
+	}
+	/**
+	 * StartSession checked that no one is
+	 * listening, so this is left over from a crash.
+	 */
+	_ = os.Remove(path)
+	listener, err := net.ListenUnix("unix", &net.UnixAddr{Name: path, Net: "unix"})
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, 0o600); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	s := &Session{
+		Name:     name,
+		Listener: listener,
+		Commands: commands,
+	}
+	go func() {
+		for {
+			conn, err := listener.AcceptUnix()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s, nil
+}
+
+func (s *Session) Attached() bool {
+	s.Access.Lock()
+	defer s.Access.Unlock()
+	return s.Conn != nil
+}
+
+/**
+ * For framebuffertoansi.TerminalWinsize
+ */
+func (s *Session) GetWinsize() (framebuffertoansi.WinSize, error) {
+	s.Access.Lock()
+	defer s.Access.Unlock()
+	if s.Winsize.Col == 0 || s.Winsize.Row == 0 {
+		return s.Winsize, fmt.Errorf("no terminal has attached yet")
+	}
+	return s.Winsize, nil
+}
+
+/**
+ * Output for the attached terminal, it is
+ * dropped while detached.
+ */
+func (s *Session) Write(p []byte) (int, error) {
+	s.Access.Lock()
+	defer s.Access.Unlock()
+	if s.Conn == nil {
+		return len(p), nil
+	}
+	/**
+	 * A terminal that stopped reading
+	 * (ie a dead ssh connection) gets detached
+	 */
+	s.Conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	if err := writeSessionMessage(s.Conn, SessionMessage_Output, p); err != nil {
+		go s.detach(s.Conn, false)
+	}
+	return len(p), nil
+}
+
+func (s *Session) serve(conn *net.UnixConn) {
+	reader := bufio.NewReader(conn)
+	kind, data, err := readSessionMessage(reader)
+	var hello sessionHello
+	if err != nil || kind != SessionMessage_Hello || json.Unmarshal(data, &hello) != nil {
+		conn.Close()
+		return
+	}
+
+	s.Access.Lock()
+	if s.Closed {
+		s.Access.Unlock()
+		conn.Close()
+		return
+	}
+	previous := s.Conn
+	s.Access.Unlock()
+	if previous != nil {
+		/**
+		 * Like tmux attach -d, the
+		 * new terminal takes over
+		 */
+		s.detach(previous, true)
+	}
+
+	useTerminalEnv(hello.Env)
+	window := s.Commands.Window
+	window.InputAccess.Lock()
+	KittyKeyboard.Requested = window.Args.KittyKeyboard
+	KittyKeyboard.Supported = false
+	window.BracketedPaste = BracketedPasteReader{}
+	window.InputAccess.Unlock()
+
+	s.Access.Lock()
+	s.Conn = conn
+	s.Winsize = hello.Winsize
+	writeSessionMessage(conn, SessionMessage_Output, []byte(TerminalSetupCodes(window.Args.KittyKeyboard)))
+	s.Access.Unlock()
+
+	select {
+	case s.Commands.DrawLoop.TerminalAttached <- struct{}{}:
+	default:
+	}
+	s.setTerminalFocused(true)
+
+	for {
+		kind, data, err := readSessionMessage(reader)
+		if err != nil {
+			s.detach(conn, false)
+			return
+		}
+		switch kind {
+		case SessionMessage_Input:
+			s.Access.Lock()
+			attached := s.Conn == conn
+			s.Access.Unlock()
+			if !attached {
+				return
+			}
+			window.HandleInput(data)
+		case SessionMessage_Resize:
+			var winsize framebuffertoansi.WinSize
+			if json.Unmarshal(data, &winsize) == nil {
+				s.Access.Lock()
+				if s.Conn == conn {
+					s.Winsize = winsize
+				}
+				s.Access.Unlock()
+			}
+		}
+	}
+}
+
+/**
+ * Apps see the session like an unfocused
+ * terminal while detached
+ */
+func (s *Session) setTerminalFocused(focused bool) {
+	s.Commands.withClients(func() {
+		wayland.SetTerminalFocused(focused)
+	})
+}
+
+/**
+ * notify to tell the terminal (it puts itself back
+ * to normal and exits), otherwise it is gone already.
+ */
+func (s *Session) detach(conn *net.UnixConn, notify bool) {
+	s.Access.Lock()
+	if s.Conn != conn {
+		s.Access.Unlock()
+		return
+	}
+	s.Conn = nil
+	if notify {
+		conn.SetWriteDeadline(time.Now().Add(time.Second))
+		writeSessionMessage(conn, SessionMessage_Output, []byte(TerminalRestoreCodes(KittyKeyboard.Requested)))
+		writeSessionMessage(conn, SessionMessage_Detach, nil)
+	}
+	s.Access.Unlock()
+	conn.Close()
+	s.setTerminalFocused(false)
+}
+
+/**
+ * Detach the attached terminal, if any. Ctrl+Alt+d
+ * or [Detach] in the status bar.
+ */
+func (s *Session) Detach() {
+	s.Access.Lock()
+	conn := s.Conn
+	s.Access.Unlock()
+	if conn != nil {
+		s.detach(conn, true)
+	}
+}
+
+/**
+ * The session is over, the attached terminal exits too
+ */
+func (s *Session) Close(exitCode int) {
+	s.Access.Lock()
+	defer s.Access.Unlock()
+	s.Closed = true
+	s.Listener.Close()
+	if s.Conn == nil {
+		return
+	}
+	s.Conn.SetWriteDeadline(time.Now().Add(time.Second))
+	writeSessionMessage(s.Conn, SessionMessage_Output, []byte(TerminalRestoreCodes(KittyKeyboard.Requested)))
+	writeSessionMessage(s.Conn, SessionMessage_Exit, []byte(strconv.Itoa(exitCode)))
+	s.Conn.Close()
+	s.Conn = nil
+}
+
+/**
+ * Ctrl+Alt+d detaches from a session
+ */
+func IsDetachKey(code XkbdCode) bool {
+	key, ok := code.(*KeyCode)
+	return ok && key.KeyCode == KEY_D &&
+		key.Modifiers&ModAlt != 0 && key.Modifiers&ModControl != 0
+}
@@ -9,25 +9,35 @@ import (
 	"github.com/mmulet/term.everything/wayland"
 )
 
-func SetVirtualMonitorSize(newVirtualMonitorSize string) {
-	if newVirtualMonitorSize == "" {
-		return
-	}
-	parts := strings.Split(newVirtualMonitorSize, "x")
+/**
+ * Parse <width>x<height>, exits on invalid input.
+ * flagName is only used for the error message.
+ */
+func ParsePixelSize(size string, flagName string) wayland.PixelSize {
+	parts := strings.Split(size, "x")
 	if len(parts) != 2 {
-		fmt.Fprintf(os.Stderr, "Invalid virtual monitor size %s, expected <width>x<height>\n", newVirtualMonitorSize)
+		fmt.Fprintf(os.Stderr, "Invalid %s %s, expected <width>x<height>\n", flagName, size)
 		os.Exit(1)
 	}
 	width, err1 := strconv.Atoi(parts[0])
 	height, err2 := strconv.Atoi(parts[1])
 	if err1 != nil || err2 != nil {
-		fmt.Fprintf(os.Stderr, "Invalid virtual monitor size %s, expected <width>x<height>\n", newVirtualMonitorSize)
+		fmt.Fprintf(os.Stderr, "Invalid %s %s, expected <width>x<height>\n", flagName, size)
 		os.Exit(1)
 	}
 	if width <= 0 || height <= 0 {
-		fmt.Fprintf(os.Stderr, "Invalid virtual monitor size %s, expected <width>x<height>\n", newVirtualMonitorSize)
+		fmt.Fprintf(os.Stderr, "Invalid %s %s, expected <width>x<height>\n", flagName, size)
 		os.Exit(1)
 	}
-	wayland.VirtualMonitorSize.Width = wayland.Pixels(width)
-	wayland.VirtualMonitorSize.Height = wayland.Pixels(height)
+	return wayland.PixelSize{
+		Width:  wayland.Pixels(width),
+		Height: wayland.Pixels(height),
+	}
+}
+
+func SetVirtualMonitorSize(newVirtualMonitorSize string) {
+	if newVirtualMonitorSize == "" {
+		return
+	}
+	wayland.VirtualMonitorSize = ParsePixelSize(newVirtualMonitorSize, "virtual monitor size")
 }
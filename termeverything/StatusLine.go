@@ -9,6 +9,7 @@ import (
 
 	"github.com/mmulet/term.everything/escapecodes"
 	"github.com/mmulet/term.everything/framebuffertoansi"
+	"github.com/mmulet/term.everything/wayland"
 )
 
 type LineButton struct {
@@ -48,9 +49,34 @@ type Status_Line struct {
 		frame_held_time float64
 	}
 
-	b       map[string]*StatusLineButton
-	Sponsor *StatusLineButton
-	Bugs    *StatusLineButton
+	b          map[string]*StatusLineButton
+	Sponsor    *StatusLineButton
+	Bugs       *StatusLineButton
+	Screenshot *StatusLineButton
+	/**
+	 * nil unless this is a session (--session)
+	 */
+	Detach *StatusLineButton
+
+	/**
+	 * The draw loop saves the screenshot
+	 * (and sets this back to false)
+	 */
+	ScreenshotClicked bool
+
+	/**
+	 * Shown at the end of the line for
+	 * NoticeTimeLeft seconds, ie "Saved file.png"
+	 */
+	Notice         string
+	NoticeTimeLeft float64
+}
+
+const noticeSeconds = 4
+
+func (s *Status_Line) ShowNotice(notice string) {
+	s.Notice = notice
+	s.NoticeTimeLeft = noticeSeconds
 }
 
 func (s *Status_Line) UpdateMousePosition(code *PointerMove) {
@@ -121,6 +147,15 @@ func MakeStatusLine() *Status_Line {
 		},
 	}
 
+	sl.Screenshot = &StatusLineButton{
+		Button: LineButton{
+			String: "[Screenshot]",
+			Callback: func() {
+				sl.ScreenshotClicked = true
+			},
+		},
+	}
+
 	sl.Bugs = &StatusLineButton{
 		Button: LineButton{
 			String: "[Report bugs here]",
@@ -136,25 +171,37 @@ func MakeStatusLine() *Status_Line {
 	return sl
 }
 
-func (s *Status_Line) Draw(delta_time float64, app_title *string, keys_pressed_this_frame map[Linux_Event_Codes]bool) string {
+func (s *Status_Line) Draw(delta_time float64, windows []wayland.WindowInfo, keys_pressed_this_frame map[Linux_Event_Codes]bool) string {
 	if !s.ShowStatusLine {
 		return ""
 	}
 
-	text := s.Line(keys_pressed_this_frame,
+	parts := []StatusLineTextOrButton{
 		s.b["escape"], &StatusLineText{" "},
+	}
+	if s.Detach != nil {
+		parts = append(parts, s.Detach, &StatusLineText{" "})
+	}
+	parts = append(parts,
+		s.Screenshot, &StatusLineText{" "},
 		s.Sponsor, &StatusLineText{" | "},
-		s.ChooseAppTitle(app_title), &StatusLineText{" | "},
 	)
+	parts = append(parts, s.WindowList(windows)...)
+	parts = append(parts, &StatusLineText{" | "})
+	if s.NoticeTimeLeft > 0 {
+		s.NoticeTimeLeft -= delta_time
+		parts = append(parts, &StatusLineText{s.Notice})
+	}
+	text := s.Line(keys_pressed_this_frame, parts...)
 
 	s.TextLoopTime += delta_time
 
 	width := 0
-	if winsize, err := framebuffertoansi.GetWinsize(os.Stdout.Fd()); err == nil {
+	if winsize, err := framebuffertoansi.GetTerminalWinsize(); err == nil {
 		width = int(winsize.Col)
 	}
-	if width > 1 && len(text) >= width {
-		return text[:width-1]
+	if width > 1 && textWidth(text) >= width {
+		return truncateToWidth(text, width-1)
 	}
 	return text
 }
@@ -220,11 +267,45 @@ func getEnvOr(k, def string) string {
 	return v
 }
 
-func (s *Status_Line) ChooseAppTitle(appTitle *string) StatusLineTextOrButton {
-	if appTitle == nil || *appTitle == "" {
-		return s.Bugs
+/**
+ * The max columns of a title in the window list
+ */
+const maxWindowTitleLength = 20
+
+/**
+ * A button for each window, click to raise it.
+ * The active window is marked with a *
+ */
+func (s *Status_Line) WindowList(windows []wayland.WindowInfo) []StatusLineTextOrButton {
+	if len(windows) == 0 {
+		return []StatusLineTextOrButton{s.Bugs}
+	}
+	parts := make([]StatusLineTextOrButton, 0, len(windows)*2)
+	for i, w := range windows {
+		if i > 0 {
+			parts = append(parts, &StatusLineText{" "})
+		}
+		title := withoutControlCharacters(w.Title)
+		if textWidth(title) > maxWindowTitleLength {
+			title = truncateToWidth(title, maxWindowTitleLength-3) + "..."
+		}
+		if title == "" {
+			title = "untitled"
+		}
+		marker := ""
+		if w.Active {
+			marker = "*"
+		}
+		parts = append(parts, &StatusLineButton{
+			Button: LineButton{
+				String: "[" + marker + title + "]",
+				Callback: func() {
+					wayland.Focus.ActivateWindow(w.Client, w.ToplevelID)
+				},
+			},
+		})
 	}
-	return &StatusLineText{*appTitle}
+	return parts
 }
 
 func (s *Status_Line) KeyboardKeyHitButton(button LineButton, keys_pressed_this_frame map[Linux_Event_Codes]bool) LineButton {
@@ -248,7 +329,7 @@ func (s *Status_Line) Line(keys_pressed_this_frame map[Linux_Event_Codes]bool, p
 		switch it := v.(type) {
 		case *StatusLineText:
 			out.WriteString(it.String)
-			position += len(it.String)
+			position += textWidth(it.String)
 		case *StatusLineButton:
 			btn := s.KeyboardKeyHitButton(it.Button, keys_pressed_this_frame)
 			nextString := btn.String
@@ -260,7 +341,7 @@ func (s *Status_Line) Line(keys_pressed_this_frame map[Linux_Event_Codes]bool, p
 			already_called_callback := false
 			if s.TerminalMousePosition.y == 0 &&
 				int(s.TerminalMousePosition.x) >= position &&
-				int(s.TerminalMousePosition.x) < position+len(nextString) {
+				int(s.TerminalMousePosition.x) < position+textWidth(nextString) {
 				out.WriteString(escapecodes.BgWhite + escapecodes.FgBlack + nextString + escapecodes.Reset)
 				if s.TerminalMouseButton.pressed &&
 					s.TerminalMouseButton.frame_held_time == 0 {
@@ -271,7 +352,7 @@ func (s *Status_Line) Line(keys_pressed_this_frame map[Linux_Event_Codes]bool, p
 			} else {
 				out.WriteString(nextString)
 			}
-			position += len(nextString)
+			position += textWidth(nextString)
 		}
 	}
 	return out.String()
@@ -2,6 +2,8 @@ package termeverything
 
 import (
 	_ "embed"
+	"image"
+	"io"
 	"os"
 	"slices"
 	"strconv"
@@ -28,8 +30,6 @@ func MakeFrameInputState() FrameInputState {
 }
 
 type TerminalDrawLoop struct {
-	VirtualMonitorSize wayland.Size
-
 	Clients []*wayland.Client
 
 	TimeOfLastTerminalDraw *float64
@@ -57,12 +57,83 @@ type TerminalDrawLoop struct {
 
 	DesiredFrameTimeSeconds float64
 
+	/**
+	 * While the terminal is unfocused, apps only get
+	 * wl_callback.done this often, so they don't
+	 * animate at full speed where no one is looking.
+	 */
+	UnfocusedFrameTimeSeconds float64
+
+	TimeOfLastFrameCallbacks float64
+
 	StatusLine *Status_Line
 
 	GetClients      chan *wayland.Client
 	FirstDrawDone   bool
 	LastDrawSize    framebuffertoansi.WinSize
 	FrameInputState FrameInputState
+
+	/**
+	 * nil unless --follow-terminal-size
+	 */
+	FollowTerminalSize *FollowTerminalSize
+
+	/**
+	 * nil with --output-scale or --follow-terminal-size
+	 */
+	FollowTerminalScale *FollowTerminalScale
+
+	/**
+	 * Not nil with --headless, frames go
+	 * here instead of to the terminal.
+	 */
+	Headless *HeadlessOutput
+
+	/**
+	 * Send a channel, get back a copy of the desktop
+	 * as last drawn (for the screenshot command)
+	 */
+	DesktopScreenshots chan chan *image.RGBA
+
+	/**
+	 * nil unless --record
+	 */
+	Recorder *CastRecorder
+
+	/**
+	 * nil unless --record-video
+	 */
+	VideoRecorder *VideoRecorder
+
+	/**
+	 * --screenshot-dir, "" is the current directory
+	 */
+	ScreenshotDir string
+	/**
+	 * From the hotkeys, saved on the next draw
+	 */
+	PendingScreenshot ScreenshotKind
+	/**
+	 * Where a screenshot was saved, or why it
+	 * wasn't, once it has been written
+	 */
+	ScreenshotNotices chan string
+
+	/**
+	 * Where escape codes that aren't frames (ie the
+	 * clipboard) go, os.Stdout or the session
+	 */
+	Terminal io.Writer
+
+	/**
+	 * nil unless this is a session (--session)
+	 */
+	Session *Session
+	/**
+	 * A terminal attached to the session, start
+	 * drawing to it from scratch
+	 */
+	TerminalAttached chan struct{}
 }
 
 func MakeTerminalDrawLoop(desktop_size wayland.Size,
@@ -82,19 +153,27 @@ func MakeTerminalDrawLoop(desktop_size wayland.Size,
 		DrawState: framebuffertoansi.MakeDrawState(
 			DisplayServerType() == DisplayServerTypeX11,
 		),
-		VirtualMonitorSize: desktop_size,
-
 		Desktop: wayland.MakeDesktop(wayland.Size{
 			Width:  desktop_size.Width,
 			Height: desktop_size.Height,
 		}, willShowAppRightAtStartup, iconPNG),
 
-		TimeOfStartOfLastFrame:  nil,
-		DesiredFrameTimeSeconds: 0.016, // ~60 FPS
-		StatusLine:              MakeStatusLine(),
-		FrameEvents:             frameEvents,
-		GetClients:              make(chan *wayland.Client, 32),
-		FrameInputState:         MakeFrameInputState(),
+		TimeOfStartOfLastFrame:    nil,
+		DesiredFrameTimeSeconds:   0.016, // ~60 FPS
+		UnfocusedFrameTimeSeconds: 1,
+		StatusLine:                MakeStatusLine(),
+		FrameEvents:               frameEvents,
+		GetClients:                make(chan *wayland.Client, 32),
+		DesktopScreenshots:        make(chan chan *image.RGBA),
+		ScreenshotNotices:         make(chan string, 8),
+		FrameInputState:           MakeFrameInputState(),
+		FollowTerminalSize:        MakeFollowTerminalSize(args),
+		FollowTerminalScale:       MakeFollowTerminalScale(args),
+		Terminal:                  os.Stdout,
+		TerminalAttached:          make(chan struct{}, 1),
+	}
+	if args != nil {
+		tw.ScreenshotDir = args.ScreenshotDir
 	}
 	if args != nil && args.MaxFrameRate != "" {
 		if fps, err := strconv.ParseFloat(args.MaxFrameRate, 64); err == nil && fps > 0 {
@@ -106,19 +185,6 @@ func MakeTerminalDrawLoop(desktop_size wayland.Size,
 	return tw
 }
 
-func (tw *TerminalDrawLoop) GetAppTitle() *string {
-	for _, s := range tw.Clients {
-		for topLevelID := range s.TopLevelSurfaces() {
-			top_level := wayland.GetXdgToplevelObject(s, topLevelID)
-			if top_level == nil {
-				continue
-			}
-			return top_level.Title
-		}
-	}
-	return nil
-}
-
 func (tw *TerminalDrawLoop) DrawToTerminal(status_line string) {
 
 	// if protocols.DebugRequests {
@@ -134,9 +200,10 @@ func (tw *TerminalDrawLoop) DrawToTerminal(status_line string) {
 
 	widthCells, heightCells := tw.DrawState.DrawDesktop(
 		tw.Desktop.Buffer,
-		tw.VirtualMonitorSize.Width,
-		tw.VirtualMonitorSize.Height,
+		uint32(tw.Desktop.Width),
+		uint32(tw.Desktop.Height),
 		statusLine,
+		tw.Desktop.TakeDamage(),
 	)
 	tw.SharedRenderedScreenSize.WidthCells = &widthCells
 	tw.SharedRenderedScreenSize.HeightCells = &heightCells
@@ -153,7 +220,12 @@ func (tw *TerminalDrawLoop) MainLoop() {
 			case code := <-tw.FrameEvents:
 				switch c := code.(type) {
 				case *KeyCode:
-					tw.FrameInputState.KeysPressedThisFrame[c.KeyCode] = true
+					if c.Event == KeyEvent_Press || c.Event == KeyEvent_PressAndRelease {
+						tw.FrameInputState.KeysPressedThisFrame[c.KeyCode] = true
+						if kind := ScreenshotKeyKind(c); kind != ScreenshotNone {
+							tw.PendingScreenshot = kind
+						}
+					}
 				case *PointerMove:
 					tw.StatusLine.UpdateMousePosition(c)
 					tw.FrameInputState.MouseMoveThisFrame = true
@@ -163,9 +235,25 @@ func (tw *TerminalDrawLoop) MainLoop() {
 					tw.StatusLine.HandleTerminalMousePress(false)
 				case *PointerWheel:
 				}
+			case done := <-tw.DesktopScreenshots:
+				screenshot := image.NewRGBA(tw.Desktop.RGBA.Rect)
+				wayland.BgraToRgba(screenshot, tw.Desktop.RGBA, true)
+				done <- screenshot
+			case notice := <-tw.ScreenshotNotices:
+				tw.ShowScreenshotNotice(notice)
+			case <-tw.TerminalAttached:
+				tw.ResetDrawState()
 			case client := <-tw.GetClients:
 				//TODO removing clients
 				tw.Clients = append(tw.Clients, client)
+			case text := <-wayland.Selection.CopiedText:
+				/**
+				 * No terminal to copy to, and stdout
+				 * may be the frames
+				 */
+				if tw.Headless == nil {
+					CopyToHostClipboard(tw.Terminal, text)
+				}
 			case <-timeout:
 				goto KeyReadLoop
 			}
@@ -179,15 +267,17 @@ func (tw *TerminalDrawLoop) MainLoop() {
 	}
 }
 
-func (tw *TerminalDrawLoop) DrawClients() {
-	defer tw.ResetFrameState()
-	start_of_frame := float64(time.Now().UnixMilli()) / 1000.0
-	var delta_time float64
-	if tw.TimeOfStartOfLastFrame != nil {
-		delta_time = start_of_frame - *tw.TimeOfStartOfLastFrame
-	} else {
-		delta_time = tw.DesiredFrameTimeSeconds
+/**
+ * Answer the apps' frame callbacks, at most once every
+ * UnfocusedFrameTimeSeconds while the terminal is unfocused.
+ * Returns how many were answered.
+ */
+func (tw *TerminalDrawLoop) SendFrameCallbacks(now float64) int {
+	if !wayland.Focus.TerminalFocused() &&
+		now-tw.TimeOfLastFrameCallbacks < tw.UnfocusedFrameTimeSeconds {
+		return 0
 	}
+	tw.TimeOfLastFrameCallbacks = now
 	num_draw_requests := 0
 	for _, s := range tw.Clients {
 		for {
@@ -201,6 +291,19 @@ func (tw *TerminalDrawLoop) DrawClients() {
 		}
 	DoneCallbacks:
 	}
+	return num_draw_requests
+}
+
+func (tw *TerminalDrawLoop) DrawClients() {
+	defer tw.ResetFrameState()
+	start_of_frame := float64(time.Now().UnixMilli()) / 1000.0
+	var delta_time float64
+	if tw.TimeOfStartOfLastFrame != nil {
+		delta_time = start_of_frame - *tw.TimeOfStartOfLastFrame
+	} else {
+		delta_time = tw.DesiredFrameTimeSeconds
+	}
+	num_draw_requests := tw.SendFrameCallbacks(start_of_frame)
 	clients_to_delete := make([]int, 0)
 	for i, s := range tw.Clients {
 		s.Access.Lock()
@@ -217,6 +320,20 @@ func (tw *TerminalDrawLoop) DrawClients() {
 		tw.Clients = slices.Delete(tw.Clients, index, index+1)
 	}
 
+	if tw.FollowTerminalScale != nil {
+		if scale, ok := tw.FollowTerminalScale.DesiredScale(); ok && scale != wayland.DesktopScale {
+			wayland.SetDesktopScale(tw.Clients, scale)
+			tw.Desktop.Resize(wayland.DesktopSizeForMonitor(wayland.VirtualMonitorSize))
+			tw.Desktop.FullDamage = true
+		}
+	}
+	if tw.FollowTerminalSize != nil {
+		if size, ok := tw.FollowTerminalSize.DesiredSize(); ok && size != wayland.VirtualMonitorSize {
+			wayland.ResizeVirtualMonitor(tw.Clients, size)
+			tw.Desktop.Resize(wayland.DesktopSizeForMonitor(size))
+		}
+	}
+
 	for _, s := range tw.Clients {
 		pointer_surface_id := wayland.Pointer.PointerSurfaceID[s]
 		if pointer_surface_id == nil {
@@ -233,10 +350,30 @@ func (tw *TerminalDrawLoop) DrawClients() {
 	}
 
 	tw.Desktop.DrawClients(tw.Clients)
+	if tw.VideoRecorder != nil {
+		tw.VideoRecorder.Sample(tw.Desktop)
+	}
 
-	status_line := tw.StatusLine.Draw(delta_time, tw.GetAppTitle(), tw.FrameInputState.KeysPressedThisFrame)
+	status_line := tw.StatusLine.Draw(delta_time, wayland.Focus.Windows(), tw.FrameInputState.KeysPressedThisFrame)
 
-	if tw.ShouldDrawFrame(start_of_frame, num_draw_requests) {
+	if tw.StatusLine.ScreenshotClicked {
+		tw.StatusLine.ScreenshotClicked = false
+		tw.PendingScreenshot = ScreenshotDesktop
+	}
+	if tw.PendingScreenshot != ScreenshotNone {
+		tw.SaveScreenshot(tw.PendingScreenshot)
+		tw.PendingScreenshot = ScreenshotNone
+	}
+
+	if tw.Headless != nil {
+		if tw.FrameRateAllowsDraw(start_of_frame) {
+			tw.Headless.WriteFrame(tw.Desktop)
+		}
+	} else if tw.Session != nil && !tw.Session.Attached() {
+		/**
+		 * Nowhere to draw to
+		 */
+	} else if tw.ShouldDrawFrame(start_of_frame, num_draw_requests) {
 		tw.DrawToTerminal(status_line)
 	}
 
@@ -253,36 +390,67 @@ func (tw *TerminalDrawLoop) DrawClients() {
 
 }
 
+/**
+ * Forget what we drew, the terminal is a new one
+ * (and may be a different kind of terminal)
+ */
+func (tw *TerminalDrawLoop) ResetDrawState() {
+	output := tw.DrawState.Output
+	tw.DrawState.Destroy()
+	tw.DrawState = framebuffertoansi.MakeDrawState(
+		DisplayServerType() == DisplayServerTypeX11,
+	)
+	tw.DrawState.Output = output
+	tw.Desktop.FullDamage = true
+	tw.FirstDrawDone = false
+	tw.LastDrawSize = framebuffertoansi.WinSize{}
+}
+
 func (tw *TerminalDrawLoop) ResetFrameState() {
 	tw.FrameInputState.MouseMoveThisFrame = false
 	clear(tw.FrameInputState.KeysPressedThisFrame)
 }
 
+/**
+ * False if the last frame was drawn less
+ * than MinTerminalTimeSeconds ago (--max-frame-rate)
+ */
+func (tw *TerminalDrawLoop) FrameRateAllowsDraw(start_of_frame float64) bool {
+	if tw.MinTerminalTimeSeconds == nil {
+		return true
+	}
+	last := 0.0
+	if tw.TimeOfLastTerminalDraw != nil {
+		last = *tw.TimeOfLastTerminalDraw
+	}
+	if start_of_frame-last < *tw.MinTerminalTimeSeconds {
+		return false
+	}
+	tw.TimeOfLastTerminalDraw = &start_of_frame
+	return true
+}
+
 func (tw *TerminalDrawLoop) ShouldDrawFrame(start_of_frame float64, num_draw_requests int) (should_draw bool) {
 	defer func() {
 		if should_draw {
 			tw.FirstDrawDone = true
 		}
 	}()
-	if tw.MinTerminalTimeSeconds != nil {
-		last := 0.0
-		if tw.TimeOfLastTerminalDraw != nil {
-			last = *tw.TimeOfLastTerminalDraw
-		}
-		if start_of_frame-last < *tw.MinTerminalTimeSeconds {
-			return false
-		}
-		tw.TimeOfLastTerminalDraw = &start_of_frame
+	if !tw.FrameRateAllowsDraw(start_of_frame) {
+		return false
 	}
 	if protocols.DebugRequests {
 		return false
 	}
 
-	if winsize, err := framebuffertoansi.GetWinsize(os.Stdout.Fd()); err == nil {
+	if winsize, err := framebuffertoansi.GetTerminalWinsize(); err == nil {
 		defer func() {
 			tw.LastDrawSize = winsize
 		}()
 		if winsize != tw.LastDrawSize {
+			if tw.Recorder != nil && tw.LastDrawSize.Col != 0 && (winsize.Col != tw.LastDrawSize.Col || winsize.Row != tw.LastDrawSize.Row) {
+				tw.Recorder.Resize(int(winsize.Col), int(winsize.Row))
+			}
 			return true
 		}
 	}
@@ -0,0 +1,39 @@
+package termeverything
+
+import (
+	"bytes"
+
+	"github.com/mmulet/term.everything/escapecodes"
+)
+
+/**
+ * The terminal window (or tab) gained or lost
+ * focus, sent because of EnableFocusReporting.
+ * Apps are deactivated while it is unfocused.
+ */
+type TerminalFocus struct {
+	Focused   bool
+	Modifiers int
+}
+
+func (*TerminalFocus) isXkbdCode() {}
+
+func (t *TerminalFocus) OrModifiers(modifiers int) {
+	t.Modifiers |= modifiers
+}
+
+func (t *TerminalFocus) GetModifiers() int {
+	return t.Modifiers
+}
+
+/**
+ * Index of the first FocusIn or FocusOut in data, or -1
+ */
+func nextFocusEvent(data []byte) int {
+	in := bytes.Index(data, []byte(escapecodes.FocusIn))
+	out := bytes.Index(data, []byte(escapecodes.FocusOut))
+	if in == -1 || (out != -1 && out < in) {
+		return out
+	}
+	return in
+}
@@ -5,6 +5,8 @@ import (
 	"os"
 	"os/signal"
 	"slices"
+	"strings"
+	"sync"
 	"syscall"
 
 	"github.com/mmulet/term.everything/escapecodes"
@@ -28,8 +30,7 @@ const (
 var GlobalExitChan = make(chan int)
 
 type TerminalWindow struct {
-	SocketListener     *wayland.SocketListener
-	VirtualMonitorSize wayland.Size
+	SocketListener *wayland.SocketListener
 
 	Mode WindowMode
 
@@ -43,26 +44,76 @@ type TerminalWindow struct {
 
 	GetClients chan *wayland.Client
 
+	/**
+	 * Held while sending input to apps. It comes from
+	 * the terminal, --headless-input and the control socket.
+	 */
+	InputAccess sync.Mutex
+
+	/**
+	 * nil unless --record
+	 */
+	Recorder *CastRecorder
+
+	/**
+	 * nil unless this is a session (--session)
+	 */
+	Session *Session
+
 	SharedRenderedScreenSize *RenderedScreenSize
 
 	RestoreTerminalMode func() error
+
+	BracketedPaste BracketedPasteReader
+
+	/**
+	 * What we exit with, set before OnExit
+	 */
+	ExitCode int
+
+	/**
+	 * Run in OnExit, ie to stop Xwayland
+	 */
+	ExitCallbacks       []func()
+	ExitCallbacksAccess sync.Mutex
+}
+
+func (tw *TerminalWindow) OnExitCall(callback func()) {
+	tw.ExitCallbacksAccess.Lock()
+	defer tw.ExitCallbacksAccess.Unlock()
+	tw.ExitCallbacks = append(tw.ExitCallbacks, callback)
 }
 
 func MakeTerminalWindow(
 	socket_listener *wayland.SocketListener,
-	desktop_size wayland.Size,
 	args *CommandLineArgs,
 
 ) *TerminalWindow {
 
-	restoreTerminalMode, err := EnableRawModeFD(int(os.Stdin.Fd()))
-	if err != nil {
-		panic(err)
+	/**
+	 * --headless has no terminal, stdin may be
+	 * the input script and stdout the frames.
+	 * A session's terminal is the attached one.
+	 */
+	restoreTerminalMode := func() error { return nil }
+	if args.OwnsTerminal() {
+		var err error
+		restoreTerminalMode, err = EnableRawModeFD(int(os.Stdin.Fd()))
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	if args.KittyKeyboard {
+		/**
+		 * The terminal repeats held keys (see
+		 * KeyEvent_Repeat), apps shouldn't as well
+		 */
+		wayland.KeyRepeatRate = 0
 	}
 
 	tw := &TerminalWindow{
 		SocketListener:           socket_listener,
-		VirtualMonitorSize:       desktop_size,
 		Mode:                     WindowMode_Passthrough,
 		FrameEvents:              make(chan XkbdCode, 8192),
 		Args:                     args,
@@ -74,12 +125,9 @@ func MakeTerminalWindow(
 		GetClients:          make(chan *wayland.Client, 32),
 	}
 
-	if !protocols.DebugRequests {
-		os.Stdout.WriteString(escapecodes.EnableAlternativeScreenBuffer)
-		os.Stdout.WriteString(escapecodes.EnableMouseTracking)
-		os.Stdout.WriteString(escapecodes.EnableSGR)
-
-		os.Stdout.WriteString(escapecodes.HideCursor)
+	if !protocols.DebugRequests && args.OwnsTerminal() {
+		KittyKeyboard.Requested = args.KittyKeyboard
+		os.Stdout.WriteString(TerminalSetupCodes(args.KittyKeyboard))
 	}
 
 	sigCh := make(chan os.Signal, 1)
@@ -96,6 +144,7 @@ func MakeTerminalWindow(
 		case exit_code = <-GlobalExitChan:
 		case <-sigCh:
 		}
+		tw.ExitCode = exit_code
 		tw.OnExit()
 		os.Exit(exit_code)
 	}()
@@ -111,13 +160,52 @@ func (tw *TerminalWindow) OnExit() {
 	}
 	tw.RestoreTerminalMode()
 
-	os.Stdout.WriteString(escapecodes.DisableAlternativeScreenBuffer)
-	os.Stdout.WriteString(escapecodes.ShowCursor)
+	if tw.Args.OwnsTerminal() {
+		os.Stdout.WriteString(TerminalRestoreCodes(KittyKeyboard.Requested))
+	}
+
+	tw.ExitCallbacksAccess.Lock()
+	defer tw.ExitCallbacksAccess.Unlock()
+	for _, callback := range tw.ExitCallbacks {
+		callback()
+	}
+}
 
-	// TODO re-enable if enabled above
-	// os.Stdout.WriteString(escapecodes.DisableNormalMouseTracking)
-	os.Stdout.WriteString(escapecodes.DisableMouseTracking)
+/**
+ * Put the terminal in the mode we draw and read input in
+ */
+func TerminalSetupCodes(kittyKeyboard bool) string {
+	var sb strings.Builder
+	sb.WriteString(escapecodes.EnableAlternativeScreenBuffer)
+	sb.WriteString(escapecodes.EnableMouseTracking)
+	sb.WriteString(escapecodes.EnableSGR)
+	sb.WriteString(escapecodes.EnableBracketedPaste)
+	sb.WriteString(escapecodes.EnableFocusReporting)
+	if kittyKeyboard {
+		sb.WriteString(escapecodes.PushKittyKeyboardFlags)
+		sb.WriteString(escapecodes.QueryKittyKeyboardFlags)
+	}
+	sb.WriteString(escapecodes.HideCursor)
+	return sb.String()
+}
 
+/**
+ * Undo TerminalSetupCodes
+ */
+func TerminalRestoreCodes(kittyKeyboard bool) string {
+	var sb strings.Builder
+	sb.WriteString(escapecodes.DisableAlternativeScreenBuffer)
+	sb.WriteString(escapecodes.ShowCursor)
+
+	// TODO re-enable if enabled above
+	// sb.WriteString(escapecodes.DisableNormalMouseTracking)
+	sb.WriteString(escapecodes.DisableMouseTracking)
+	sb.WriteString(escapecodes.DisableBracketedPaste)
+	sb.WriteString(escapecodes.DisableFocusReporting)
+	if kittyKeyboard {
+		sb.WriteString(escapecodes.PopKittyKeyboardFlags)
+	}
+	return sb.String()
 }
 
 func (tw *TerminalWindow) InputLoop() {
@@ -130,80 +218,163 @@ func (tw *TerminalWindow) InputLoop() {
 			fmt.Printf("Error reading stdin: %v\n", err)
 			return
 		}
-		chunk := buf[:n]
-		for {
-			select {
-			case client := <-tw.GetClients:
-				//TODO removing client
-				tw.Clients = append(tw.Clients, client)
-			default:
-				goto GotData
-			}
+		tw.HandleInput(buf[:n])
+	}
+}
+
+/**
+ * What was typed in the terminal (or the
+ * terminal attached to a session)
+ */
+func (tw *TerminalWindow) HandleInput(chunk []byte) {
+	if tw.Recorder != nil {
+		tw.Recorder.Input(chunk)
+	}
+	tw.InputAccess.Lock()
+	defer tw.InputAccess.Unlock()
+	tw.TakeNewClients()
+	chunk = framebuffertoansi.TakeKittyGraphicsReplies(chunk)
+	codes := tw.BracketedPaste.ConvertToCodes(chunk)
+	tw.ProcessCodes(codes)
+}
+
+/**
+ * Call with InputAccess held
+ */
+func (tw *TerminalWindow) TakeNewClients() {
+	for {
+		select {
+		case client := <-tw.GetClients:
+			//TODO removing client
+			tw.Clients = append(tw.Clients, client)
+		default:
+			return
 		}
-	GotData:
-		codes := ConvertKeycodeToXbdCode(chunk)
-		tw.ProcessCodes(codes)
 	}
 }
 
-func (tw *TerminalWindow) ProcessCodes(codes []XkbdCode) {
+/**
+ * Alt+` raises the next window, Alt+~ the previous one.
+ * Returns true if the code was used, so it should not
+ * be sent on to the app.
+ */
+func HandleWindowSwitchKey(code XkbdCode) bool {
+	key, ok := code.(*KeyCode)
+	if !ok || key.KeyCode != KEY_GRAVE || key.Modifiers&ModAlt == 0 {
+		return false
+	}
+	switch key.Event {
+	case KeyEvent_Press, KeyEvent_PressAndRelease:
+		wayland.Focus.CycleWindows(key.Modifiers&ModShift == 0)
+	}
+	return true
+}
+
+/**
+ * Lock every connected client (and forget the
+ * disconnected ones), call the returned func to unlock.
+ */
+func (tw *TerminalWindow) LockClients() (unlock func()) {
 	clients_to_delete := make([]int, 0)
+	locked := make([]*wayland.Client, 0, len(tw.Clients))
 	for i, s := range tw.Clients {
 		s.Access.Lock()
 		if s.Status != wayland.ClientStatus_Connected {
 			s.Access.Unlock()
 			clients_to_delete = append(clients_to_delete, i)
 			continue
-		} else {
-			defer s.Access.Unlock()
 		}
+		locked = append(locked, s)
 	}
 	for i := len(clients_to_delete) - 1; i >= 0; i-- {
 		index := clients_to_delete[i]
 		tw.Clients = slices.Delete(tw.Clients, index, index+1)
 	}
+	return func() {
+		for i := len(locked) - 1; i >= 0; i-- {
+			locked[i].Access.Unlock()
+		}
+	}
+}
+
+func (tw *TerminalWindow) ProcessCodes(codes []XkbdCode) {
+	defer tw.LockClients()()
 
 	for _, code := range codes {
 		tw.FrameEvents <- code
 
-		for _, s := range tw.Clients {
-			if keyboard_map := protocols.GetGlobalWlKeyboardBinds(s); keyboard_map != nil {
-				modifiers := code.GetModifiers()
-				ser := wayland.GetNextEventSerial()
-				for keyboardID := range keyboard_map {
-					protocols.WlKeyboard_modifiers(
-						s,
-						keyboardID,
-						ser,
-						uint32(modifiers),
-						0, 0, 0,
-					)
-				}
-			}
+		if HandleWindowSwitchKey(code) || ScreenshotKeyKind(code) != ScreenshotNone {
+			continue
 		}
+		if tw.Session != nil && IsDetachKey(code) {
+			/**
+			 * Detach locks the clients
+			 */
+			go tw.Session.Detach()
+			continue
+		}
+
+		wayland.SendKeyboardModifiers(uint32(code.GetModifiers()))
 		switch c := code.(type) {
 		case *KeyCode:
-			wayland.SendKeyboardKey(tw.Clients, uint32(c.KeyCode), true)
-			// Send key released immediately
-			wayland.SendKeyboardKey(tw.Clients, uint32(c.KeyCode), false)
+			switch c.Event {
+			case KeyEvent_Press:
+				wayland.SendKeyboardKey(uint32(c.KeyCode), true)
+			case KeyEvent_Release:
+				wayland.SendKeyboardKey(uint32(c.KeyCode), false)
+			case KeyEvent_Repeat:
+				/**
+				 * The key is still held down. Apps don't
+				 * repeat keys with --kitty-keyboard (rate 0),
+				 * so the terminal's repeats are pressed again.
+				 */
+				wayland.SendKeyboardKey(uint32(c.KeyCode), true)
+			default:
+				wayland.SendKeyboardKey(uint32(c.KeyCode), true)
+				// Send key released immediately
+				wayland.SendKeyboardKey(uint32(c.KeyCode), false)
+			}
+
+		case *Text:
+			/**
+			 * Apps without zwp_text_input_v3 can't
+			 * get it, there is no key to press.
+			 */
+			wayland.SendText(c.Text)
+
+		case *Paste:
+			wayland.Selection.SetHostText(c.Text)
+			/**
+			 * Text inputs take the paste directly,
+			 * otherwise press ctrl+v.
+			 */
+			if !wayland.SendText(string(c.Text)) {
+				wayland.SendKeyboardKey(uint32(KEY_V), true)
+				wayland.SendKeyboardKey(uint32(KEY_V), false)
+			}
+			// Let go of ctrl, so it doesn't look stuck
+			wayland.SendKeyboardModifiers(0)
+
+		case *TerminalFocus:
+			wayland.SetTerminalFocused(c.Focused)
 
 		case *PointerMove:
 			cols, rows := tw.CurrentTerminalSize()
 			x := float32(c.Col) *
-				(float32(tw.VirtualMonitorSize.Width) /
+				(float32(wayland.VirtualMonitorSize.Width) /
 					float32(cols))
 			y := float32(c.Row) *
-				(float32(tw.VirtualMonitorSize.Height) /
+				(float32(wayland.VirtualMonitorSize.Height) /
 					float32(rows))
 
-			wayland.SendPointerMotion(tw.Clients, x, y)
+			wayland.SendPointerMotion(x, y)
 
 		case *PointerButtonPress:
 
 			release := tw.GetButtonToReleaseAndUpdatePressedMouseButton(c.Button)
-			wayland.SendPointerButton(tw.Clients, uint32(c.Button), true)
+			wayland.SendPointerButton(uint32(c.Button), true)
 			if c.NeedToReleaseOtherButtons && release != nil {
-				wayland.SendPointerButton(tw.Clients, uint32(*release), false)
+				wayland.SendPointerButton(uint32(*release), false)
 			}
 
 		case *PointerButtonRelease:
@@ -216,7 +387,7 @@ func (tw *TerminalWindow) ProcessCodes(codes []XkbdCode) {
 				tw.PressedMouseButton = nil
 			}
 
-			wayland.SendPointerButton(tw.Clients, uint32(buttonToRelease), false)
+			wayland.SendPointerButton(uint32(buttonToRelease), false)
 
 		case *PointerWheel:
 			_, rows := tw.CurrentTerminalSize()
@@ -225,8 +396,8 @@ func (tw *TerminalWindow) ProcessCodes(codes []XkbdCode) {
 			if (c.Modifiers & ModAlt) != 0 {
 				scale = 1
 			}
-			amount := scale * float32(tw.ScrollDirection(c.Up)) * float32(tw.VirtualMonitorSize.Height) / float32(rows)
-			wayland.SendPointerAxis(tw.Clients, protocols.WlPointerAxis_enum_vertical_scroll, amount)
+			amount := scale * float32(tw.ScrollDirection(c.Up)) * float32(wayland.VirtualMonitorSize.Height) / float32(rows)
+			wayland.SendPointerAxis(protocols.WlPointerAxis_enum_vertical_scroll, amount)
 		default:
 			// literal never_default(code) equivalent: do nothing
 		}
@@ -265,7 +436,7 @@ func (tw *TerminalWindow) CurrentTerminalSize() (cols, rows int) {
 	if tw.SharedRenderedScreenSize != nil && tw.SharedRenderedScreenSize.WidthCells != nil && tw.SharedRenderedScreenSize.HeightCells != nil {
 		return *tw.SharedRenderedScreenSize.WidthCells, *tw.SharedRenderedScreenSize.HeightCells
 	}
-	ws, err := framebuffertoansi.GetWinsize(1)
+	ws, err := framebuffertoansi.GetTerminalWinsize()
 	if err != nil || ws.Col <= 0 || ws.Row <= 0 {
 		return 80, 24
 	}
@@ -0,0 +1,122 @@
+package termeverything
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+/**
+ * Typed text that has no key in our keymap (ie é,
+ * CJK or emoji). It goes to the focused app with
+ * zwp_text_input_v3, if the app has enabled it.
+ */
+type Text struct {
+	Text      string
+	Modifiers int
+}
+
+func (*Text) isXkbdCode() {}
+
+func (t *Text) OrModifiers(modifiers int) {
+	t.Modifiers |= modifiers
+}
+
+func (t *Text) GetModifiers() int {
+	return t.Modifiers
+}
+
+/**
+ * The first run of multi-byte UTF-8 characters in
+ * data, start is -1 if there is none. Legacy (X10)
+ * mouse reports are skipped, their bytes can be >= 128.
+ */
+func nextTextRun(data []byte) (start int, end int) {
+	start = -1
+	i := 0
+	for i < len(data) {
+		if data[i] == 27 && i+2 < len(data) && data[i+1] == '[' && data[i+2] == 'M' {
+			if start != -1 {
+				return start, i
+			}
+			i += 6
+			continue
+		}
+		r, size := utf8.DecodeRune(data[i:])
+		if size > 1 && r != utf8.RuneError && unicode.IsPrint(r) {
+			if start == -1 {
+				start = i
+			}
+			i += size
+			continue
+		}
+		if start != -1 {
+			return start, i
+		}
+		i++
+	}
+	if start == -1 {
+		return -1, -1
+	}
+	return start, len(data)
+}
+
+/**
+ * Plain ASCII typed along with text (ie from
+ * an input method on the host) is one key per
+ * byte, anything else is parsed as usual.
+ */
+func convertAroundText(data []byte) []XkbdCode {
+	for _, b := range data {
+		if b < 32 || b > 126 {
+			return convertLegacyKeycodeToXbdCode(data)
+		}
+	}
+	out := make([]XkbdCode, 0, len(data))
+	for _, b := range data {
+		if code := KeycodeSingleCodes(int(b)); code != nil {
+			out = append(out, code)
+		}
+	}
+	return out
+}
+
+/**
+ * With the kitty keyboard protocol a key that is not
+ * on our keymap comes as CSI codepoint u. Presses and
+ * repeats of printable characters become text.
+ */
+func kittyText(params string) *Text {
+	fields := strings.Split(params, ";")
+	codepoint, err := strconv.Atoi(strings.Split(fields[0], ":")[0])
+	if err != nil || codepoint < 128 || !unicode.IsPrint(rune(codepoint)) {
+		return nil
+	}
+	modifiers := 0
+	if len(fields) > 1 {
+		parts := strings.Split(fields[1], ":")
+		if parts[0] != "" {
+			m, err := strconv.Atoi(parts[0])
+			if err != nil {
+				return nil
+			}
+			modifiers = kittyModifiers(m)
+		}
+		if len(parts) > 1 && parts[1] == "3" {
+			return nil
+		}
+	}
+	if modifiers&(ModControl|ModAlt|ModSuper) != 0 {
+		return nil
+	}
+	r := rune(codepoint)
+	/**
+	 * We don't ask for the shifted key,
+	 * kitty reports the unshifted one.
+	 */
+	if modifiers&ModShift != 0 {
+		r = unicode.ToUpper(r)
+	}
+	return &Text{Text: string(r)}
+}
@@ -0,0 +1,181 @@
+package termeverything
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/mmulet/term.everything/escapecodes"
+)
+
+/**
+ * Ranges of East Asian Wide and Fullwidth characters
+ * (and emoji), which take two columns in a terminal.
+ */
+var wideRunes = []struct{ First, Last rune }{
+	{0x1100, 0x115f},
+	{0x231a, 0x231b},
+	{0x2329, 0x232a},
+	{0x23e9, 0x23ec},
+	{0x23f0, 0x23f0},
+	{0x23f3, 0x23f3},
+	{0x25fd, 0x25fe},
+	{0x2614, 0x2615},
+	{0x2648, 0x2653},
+	{0x267f, 0x267f},
+	{0x2693, 0x2693},
+	{0x26a1, 0x26a1},
+	{0x26aa, 0x26ab},
+	{0x26bd, 0x26be},
+	{0x26c4, 0x26c5},
+	{0x26ce, 0x26ce},
+	{0x26d4, 0x26d4},
+	{0x26ea, 0x26ea},
+	{0x26f2, 0x26f3},
+	{0x26f5, 0x26f5},
+	{0x26fa, 0x26fa},
+	{0x26fd, 0x26fd},
+	{0x2705, 0x2705},
+	{0x270a, 0x270b},
+	{0x2728, 0x2728},
+	{0x274c, 0x274c},
+	{0x274e, 0x274e},
+	{0x2753, 0x2755},
+	{0x2757, 0x2757},
+	{0x2795, 0x2797},
+	{0x27b0, 0x27b0},
+	{0x27bf, 0x27bf},
+	{0x2b1b, 0x2b1c},
+	{0x2b50, 0x2b50},
+	{0x2b55, 0x2b55},
+	{0x2e80, 0x303e},
+	{0x3041, 0x33ff},
+	{0x3400, 0x4dbf},
+	{0x4e00, 0x9fff},
+	{0xa000, 0xa4cf},
+	{0xa960, 0xa97f},
+	{0xac00, 0xd7a3},
+	{0xf900, 0xfaff},
+	{0xfe10, 0xfe19},
+	{0xfe30, 0xfe6f},
+	{0xff00, 0xff60},
+	{0xffe0, 0xffe6},
+	{0x16fe0, 0x18cff},
+	{0x1b000, 0x1b2ff},
+	{0x1f004, 0x1f004},
+	{0x1f0cf, 0x1f0cf},
+	{0x1f18e, 0x1f18e},
+	{0x1f191, 0x1f19a},
+	{0x1f200, 0x1f251},
+	{0x1f300, 0x1f64f},
+	{0x1f680, 0x1f6ff},
+	{0x1f7e0, 0x1f7eb},
+	{0x1f90c, 0x1f9ff},
+	{0x1fa70, 0x1faff},
+	{0x20000, 0x3fffd},
+}
+
+/**
+ * How many terminal columns r takes: 0 for combining
+ * marks and control characters, 2 for wide ones.
+ */
+func runeWidth(r rune) int {
+	if r < 0x20 || (r >= 0x7f && r < 0xa0) ||
+		r == 0x200b || r == 0x200d ||
+		unicode.Is(unicode.Mn, r) || unicode.Is(unicode.Me, r) ||
+		(r >= 0xfe00 && r <= 0xfe0f) {
+		return 0
+	}
+	if r < 0x1100 {
+		return 1
+	}
+	for _, wide := range wideRunes {
+		if r < wide.First {
+			return 1
+		}
+		if r <= wide.Last {
+			return 2
+		}
+	}
+	return 1
+}
+
+/**
+ * The length of an escape sequence at the start
+ * of text (ie escapecodes.Reset), 0 if there isn't one.
+ */
+func escapeSequenceLength(text string) int {
+	if len(text) < 2 || text[0] != 0x1b {
+		return 0
+	}
+	if text[1] != '[' {
+		return 2
+	}
+	for i := 2; i < len(text); i++ {
+		if text[i] >= 0x40 && text[i] <= 0x7e {
+			return i + 1
+		}
+	}
+	return len(text)
+}
+
+/**
+ * The columns text takes in the terminal,
+ * escape sequences take none.
+ */
+func textWidth(text string) int {
+	width := 0
+	for i := 0; i < len(text); {
+		if n := escapeSequenceLength(text[i:]); n > 0 {
+			i += n
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(text[i:])
+		width += runeWidth(r)
+		i += size
+	}
+	return width
+}
+
+/**
+ * Cut text to at most width columns, between characters
+ * and never inside an escape sequence. The colors are
+ * reset when it was cut after one.
+ */
+func truncateToWidth(text string, width int) string {
+	var out strings.Builder
+	used := 0
+	escaped := false
+	for i := 0; i < len(text); {
+		if n := escapeSequenceLength(text[i:]); n > 0 {
+			out.WriteString(text[i : i+n])
+			escaped = true
+			i += n
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(text[i:])
+		used += runeWidth(r)
+		if used > width {
+			if escaped {
+				out.WriteString(escapecodes.Reset)
+			}
+			return out.String()
+		}
+		out.WriteString(text[i : i+size])
+		i += size
+	}
+	return out.String()
+}
+
+/**
+ * Window titles come from apps, keep
+ * them from writing escape codes.
+ */
+func withoutControlCharacters(text string) string {
+	return strings.Map(func(r rune) rune {
+		if r < 0x20 || (r >= 0x7f && r < 0xa0) {
+			return -1
+		}
+		return r
+	}, text)
+}
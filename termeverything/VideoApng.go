@@ -0,0 +1,138 @@
+package termeverything
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"io"
+	"os"
+	"time"
+)
+
+/**
+ * Writes an animated PNG one frame at a time. Each
+ * frame after the first is only the part that changed.
+ * https://wiki.mozilla.org/APNG_Specification
+ */
+type apngEncoder struct {
+	File       *os.File
+	FrameCount uint32
+	/**
+	 * Every fcTL and fdAT has the next number
+	 */
+	Sequence uint32
+	/**
+	 * Where acTL is, it gets the frame count at the end
+	 */
+	acTLOffset int64
+}
+
+func (a *apngEncoder) writeChunk(kind string, data []byte) error {
+	chunk := binary.BigEndian.AppendUint32(nil, uint32(len(data)))
+	chunk = append(chunk, kind...)
+	chunk = append(chunk, data...)
+	chunk = binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(chunk[4:]))
+	_, err := a.File.Write(chunk)
+	return err
+}
+
+func (a *apngEncoder) WriteFrame(frame *image.RGBA, changed image.Rectangle, delay time.Duration) error {
+	if a.FrameCount == 0 {
+		if _, err := a.File.Write([]byte("\x89PNG\r\n\x1a\n")); err != nil {
+			return err
+		}
+		header := binary.BigEndian.AppendUint32(nil, uint32(frame.Rect.Dx()))
+		header = binary.BigEndian.AppendUint32(header, uint32(frame.Rect.Dy()))
+		/**
+		 * 8 bit RGBA
+		 */
+		header = append(header, 8, 6, 0, 0, 0)
+		if err := a.writeChunk("IHDR", header); err != nil {
+			return err
+		}
+		offset, err := a.File.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return err
+		}
+		a.acTLOffset = offset
+		if err := a.writeChunk("acTL", make([]byte, 8)); err != nil {
+			return err
+		}
+		/**
+		 * The default image (IDAT) is the first frame
+		 */
+		changed = frame.Rect
+	}
+
+	offset := changed.Min.Sub(frame.Rect.Min)
+	milliseconds := min(max(delay.Milliseconds(), 1), 0xffff)
+	control := binary.BigEndian.AppendUint32(nil, a.Sequence)
+	control = binary.BigEndian.AppendUint32(control, uint32(changed.Dx()))
+	control = binary.BigEndian.AppendUint32(control, uint32(changed.Dy()))
+	control = binary.BigEndian.AppendUint32(control, uint32(offset.X))
+	control = binary.BigEndian.AppendUint32(control, uint32(offset.Y))
+	control = binary.BigEndian.AppendUint16(control, uint16(milliseconds))
+	control = binary.BigEndian.AppendUint16(control, 1000)
+	/**
+	 * dispose_op none, blend_op source
+	 */
+	control = append(control, 0, 0)
+	a.Sequence++
+	if err := a.writeChunk("fcTL", control); err != nil {
+		return err
+	}
+
+	var compressed bytes.Buffer
+	writer := zlib.NewWriter(&compressed)
+	sub := frame.SubImage(changed).(*image.RGBA)
+	width := sub.Rect.Dx()
+	for y := range sub.Rect.Dy() {
+		/**
+		 * Filter type none
+		 */
+		writer.Write([]byte{0})
+		writer.Write(sub.Pix[y*sub.Stride : y*sub.Stride+width*4])
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+
+	var err error
+	if a.FrameCount == 0 {
+		err = a.writeChunk("IDAT", compressed.Bytes())
+	} else {
+		data := binary.BigEndian.AppendUint32(nil, a.Sequence)
+		a.Sequence++
+		err = a.writeChunk("fdAT", append(data, compressed.Bytes()...))
+	}
+	if err != nil {
+		return err
+	}
+	a.FrameCount++
+	return nil
+}
+
+func (a *apngEncoder) Close() error {
+	if a.FrameCount == 0 {
+		return a.File.Close()
+	}
+	if err := a.writeChunk("IEND", nil); err != nil {
+		a.File.Close()
+		return err
+	}
+	/**
+	 * Now we know how many frames there are,
+	 * num_plays 0 is loop forever
+	 */
+	if _, err := a.File.Seek(a.acTLOffset, io.SeekStart); err != nil {
+		a.File.Close()
+		return err
+	}
+	if err := a.writeChunk("acTL", append(binary.BigEndian.AppendUint32(nil, a.FrameCount), 0, 0, 0, 0)); err != nil {
+		a.File.Close()
+		return err
+	}
+	return a.File.Close()
+}
@@ -0,0 +1,231 @@
+package termeverything
+
+import (
+	"bufio"
+	"cmp"
+	"compress/lzw"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"os"
+	"slices"
+	"time"
+)
+
+/**
+ * Writes an animated GIF one frame at a time (image/gif
+ * needs every frame at once). Each frame is only the part
+ * that changed, with its own palette.
+ */
+type gifEncoder struct {
+	File    *os.File
+	Out     *bufio.Writer
+	started bool
+}
+
+func (g *gifEncoder) WriteFrame(frame *image.RGBA, changed image.Rectangle, delay time.Duration) error {
+	if !g.started {
+		g.started = true
+		g.Out = bufio.NewWriter(g.File)
+		g.Out.WriteString("GIF89a")
+		/**
+		 * Logical screen descriptor, no global color table
+		 */
+		g.writeUint16(uint16(frame.Rect.Dx()), uint16(frame.Rect.Dy()))
+		g.Out.Write([]byte{0, 0, 0})
+		/**
+		 * Loop forever
+		 */
+		g.Out.Write([]byte{0x21, 0xff, 0x0b})
+		g.Out.WriteString("NETSCAPE2.0")
+		g.Out.Write([]byte{0x03, 0x01, 0x00, 0x00, 0x00})
+	}
+	paletted := quantize(frame.SubImage(changed).(*image.RGBA))
+
+	/**
+	 * Graphic control extension: don't dispose
+	 * (later frames draw over this one) and the delay
+	 */
+	centiseconds := min(max(delay.Milliseconds()/10, 1), 0xffff)
+	g.Out.Write([]byte{0x21, 0xf9, 0x04, 0x04})
+	g.writeUint16(uint16(centiseconds))
+	g.Out.Write([]byte{0x00, 0x00})
+
+	bits := 1
+	for 1<<bits < len(paletted.Palette) {
+		bits++
+	}
+	offset := changed.Min.Sub(frame.Rect.Min)
+	g.Out.WriteByte(0x2c)
+	g.writeUint16(uint16(offset.X), uint16(offset.Y), uint16(changed.Dx()), uint16(changed.Dy()))
+	g.Out.WriteByte(0x80 | byte(bits-1))
+	for i := range 1 << bits {
+		var r, gr, b uint32
+		if i < len(paletted.Palette) {
+			r, gr, b, _ = paletted.Palette[i].RGBA()
+		}
+		g.Out.Write([]byte{byte(r >> 8), byte(gr >> 8), byte(b >> 8)})
+	}
+
+	litWidth := max(bits, 2)
+	g.Out.WriteByte(byte(litWidth))
+	blocks := &gifBlockWriter{Out: g.Out}
+	compressor := lzw.NewWriter(blocks, lzw.LSB, litWidth)
+	width := paletted.Rect.Dx()
+	for y := range paletted.Rect.Dy() {
+		if _, err := compressor.Write(paletted.Pix[y*paletted.Stride : y*paletted.Stride+width]); err != nil {
+			return err
+		}
+	}
+	if err := compressor.Close(); err != nil {
+		return err
+	}
+	blocks.Flush()
+	_, err := g.Out.Write([]byte{0x00})
+	return err
+}
+
+func (g *gifEncoder) writeUint16(values ...uint16) {
+	for _, v := range values {
+		g.Out.Write(binary.LittleEndian.AppendUint16(nil, v))
+	}
+}
+
+func (g *gifEncoder) Close() error {
+	if g.started {
+		g.Out.WriteByte(0x3b)
+		if err := g.Out.Flush(); err != nil {
+			g.File.Close()
+			return err
+		}
+	}
+	return g.File.Close()
+}
+
+/**
+ * GIF image data is in blocks of up to 255 bytes
+ */
+type gifBlockWriter struct {
+	Out    *bufio.Writer
+	buffer [255]byte
+	length int
+}
+
+func (b *gifBlockWriter) Write(p []byte) (int, error) {
+	for _, c := range p {
+		b.buffer[b.length] = c
+		b.length++
+		if b.length == len(b.buffer) {
+			b.Flush()
+		}
+	}
+	return len(p), nil
+}
+
+func (b *gifBlockWriter) Flush() {
+	if b.length == 0 {
+		return
+	}
+	b.Out.WriteByte(byte(b.length))
+	b.Out.Write(b.buffer[:b.length])
+	b.length = 0
+}
+
+/**
+ * Up to 256 colors. Apps usually use fewer, then the
+ * colors are exact. Otherwise the most common colors
+ * (at 5 bits a channel) are used.
+ */
+func quantize(img *image.RGBA) *image.Paletted {
+	width := img.Rect.Dx()
+	height := img.Rect.Dy()
+	out := image.NewPaletted(img.Rect, nil)
+	exact := make(map[[3]byte]uint8)
+	for y := range height {
+		row := img.Pix[y*img.Stride : y*img.Stride+width*4]
+		for x := range width {
+			c := [3]byte{row[x*4], row[x*4+1], row[x*4+2]}
+			index, ok := exact[c]
+			if !ok {
+				if len(exact) == 256 {
+					return quantizePopular(img)
+				}
+				index = uint8(len(exact))
+				exact[c] = index
+				out.Palette = append(out.Palette, color.RGBA{c[0], c[1], c[2], 0xff})
+			}
+			out.Pix[y*out.Stride+x] = index
+		}
+	}
+	return out
+}
+
+func quantizeBucket(r, g, b byte) int {
+	return int(r>>3)<<10 | int(g>>3)<<5 | int(b>>3)
+}
+
+func quantizePopular(img *image.RGBA) *image.Paletted {
+	width := img.Rect.Dx()
+	height := img.Rect.Dy()
+	type bucket struct {
+		Index   int
+		Count   int
+		R, G, B int
+	}
+	buckets := make([]bucket, 1<<15)
+	for y := range height {
+		row := img.Pix[y*img.Stride : y*img.Stride+width*4]
+		for x := range width {
+			r, g, b := row[x*4], row[x*4+1], row[x*4+2]
+			it := &buckets[quantizeBucket(r, g, b)]
+			it.Count++
+			it.R += int(r)
+			it.G += int(g)
+			it.B += int(b)
+		}
+	}
+	used := make([]bucket, 0)
+	for i, it := range buckets {
+		if it.Count > 0 {
+			it.Index = i
+			used = append(used, it)
+		}
+	}
+	slices.SortFunc(used, func(a, b bucket) int {
+		return cmp.Compare(b.Count, a.Count)
+	})
+	used = used[:min(len(used), 256)]
+	palette := make(color.Palette, 0, len(used))
+	for _, it := range used {
+		palette = append(palette, color.RGBA{
+			uint8(it.R / it.Count),
+			uint8(it.G / it.Count),
+			uint8(it.B / it.Count),
+			0xff,
+		})
+	}
+	/**
+	 * Nearest palette color for every bucket, so
+	 * each pixel is a lookup instead of a search
+	 */
+	lookup := make([]uint8, 1<<15)
+	for i, it := range buckets {
+		if it.Count == 0 {
+			continue
+		}
+		lookup[i] = uint8(palette.Index(color.RGBA{
+			uint8(it.R / it.Count),
+			uint8(it.G / it.Count),
+			uint8(it.B / it.Count),
+			0xff,
+		}))
+	}
+	out := image.NewPaletted(img.Rect, palette)
+	for y := range height {
+		row := img.Pix[y*img.Stride : y*img.Stride+width*4]
+		for x := range width {
+			out.Pix[y*out.Stride+x] = lookup[quantizeBucket(row[x*4], row[x*4+1], row[x*4+2])]
+		}
+	}
+	return out
+}
@@ -0,0 +1,186 @@
+package termeverything
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+	"time"
+)
+
+/**
+ * How long to wait for Xwayland to say it is ready
+ */
+const xwaylandStartupTimeout = 10 * time.Second
+
+/**
+ * A rootful Xwayland server connected to our wayland
+ * socket, and the X11 window manager that runs in it.
+ */
+type Xwayland struct {
+	/**
+	 * ie ":5"
+	 */
+	Display string
+
+	Server        *exec.Cmd
+	WindowManager *exec.Cmd
+}
+
+/**
+ * Returns the Xwayland options and the window manager
+ * command to use, or "" if we shouldn't start Xwayland.
+ */
+func XwaylandCommandsFromArgs(args *CommandLineArgs) (xwaylandArgs string, windowManager string) {
+	xwaylandArgs = args.Xwayland
+	windowManager = args.XwaylandWM
+	if args.SupportOldApps && xwaylandArgs == "" {
+		xwaylandArgs = ":5 -retro"
+	}
+	if xwaylandArgs == "" {
+		return "", ""
+	}
+	if windowManager == "" {
+		windowManager = "matchbox-window-manager"
+		if display := displayFromXwaylandArgs(xwaylandArgs); display != "" {
+			windowManager += " -display " + display
+		}
+	}
+	return xwaylandArgs, windowManager
+}
+
+func displayFromXwaylandArgs(xwaylandArgs string) string {
+	for _, field := range strings.Fields(xwaylandArgs) {
+		if strings.HasPrefix(field, ":") {
+			return field
+		}
+	}
+	return ""
+}
+
+/**
+ * Start Xwayland and wait until it is ready to
+ * accept X11 clients, then start the window manager.
+ */
+func StartXwayland(args *CommandLineArgs, waylandDisplayName string) (*Xwayland, error) {
+	xwaylandArgs, windowManager := XwaylandCommandsFromArgs(args)
+	if xwaylandArgs == "" {
+		return nil, nil
+	}
+
+	if _, err := exec.LookPath("Xwayland"); err != nil {
+		return nil, fmt.Errorf("Xwayland is not installed or not on the PATH: %w", err)
+	}
+
+	/**
+	 * Xwayland writes the display number to
+	 * -displayfd once it is ready for clients.
+	 */
+	ready, readyWriter, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	defer ready.Close()
+
+	server := exec.Command(args.Shell, "-c", "exec Xwayland "+xwaylandArgs+" -displayfd 3")
+	server.Env = append(environmentWithout("DISPLAY", "WAYLAND_DISPLAY"),
+		fmt.Sprintf("WAYLAND_DISPLAY=%s", waylandDisplayName),
+	)
+	server.ExtraFiles = []*os.File{readyWriter}
+	server.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	if err := server.Start(); err != nil {
+		readyWriter.Close()
+		return nil, fmt.Errorf("failed to start Xwayland: %w", err)
+	}
+	readyWriter.Close()
+
+	x := &Xwayland{Server: server}
+
+	displayNumber := make(chan string, 1)
+	go func() {
+		line, _ := bufio.NewReader(ready).ReadString('\n')
+		displayNumber <- strings.TrimSpace(line)
+	}()
+	select {
+	case number := <-displayNumber:
+		if number == "" {
+			x.Stop()
+			return nil, fmt.Errorf("Xwayland exited before it was ready")
+		}
+		x.Display = ":" + number
+	case <-time.After(xwaylandStartupTimeout):
+		x.Stop()
+		return nil, fmt.Errorf("timed out waiting for Xwayland to start")
+	}
+
+	wm := exec.Command(args.Shell, "-c", windowManager)
+	wm.Env = append(environmentWithout("DISPLAY", "WAYLAND_DISPLAY"),
+		fmt.Sprintf("DISPLAY=%s", x.Display),
+	)
+	wm.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	if err := wm.Start(); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to start the X11 window manager: %v\n", err)
+	} else {
+		x.WindowManager = wm
+	}
+
+	return x, nil
+}
+
+/**
+ * Stop the window manager, then Xwayland.
+ */
+func (x *Xwayland) Stop() {
+	if x == nil {
+		return
+	}
+	stopProcessGroup(x.WindowManager)
+	stopProcessGroup(x.Server)
+}
+
+/**
+ * SIGTERM, then SIGKILL if it is still around
+ * after a second.
+ */
+func stopProcessGroup(cmd *exec.Cmd) {
+	if cmd == nil || cmd.Process == nil {
+		return
+	}
+	pid := cmd.Process.Pid
+	_ = syscall.Kill(-pid, syscall.SIGTERM)
+
+	exited := make(chan struct{})
+	go func() {
+		_ = cmd.Wait()
+		close(exited)
+	}()
+	select {
+	case <-exited:
+	case <-time.After(time.Second):
+		_ = syscall.Kill(-pid, syscall.SIGKILL)
+		<-exited
+	}
+}
+
+/**
+ * os.Environ() without the given variables
+ */
+func environmentWithout(names ...string) []string {
+	baseEnv := os.Environ()
+	filtered := make([]string, 0, len(baseEnv))
+	for _, e := range baseEnv {
+		skip := false
+		for _, name := range names {
+			if strings.HasPrefix(e, name+"=") {
+				skip = true
+				break
+			}
+		}
+		if !skip {
+			filtered = append(filtered, e)
+		}
+	}
+	return filtered
+}
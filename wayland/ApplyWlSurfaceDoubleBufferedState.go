@@ -1,6 +1,8 @@
 package wayland
 
 import (
+	"image"
+
 	"github.com/mmulet/term.everything/wayland/pointerslices"
 	"github.com/mmulet/term.everything/wayland/protocols"
 )
@@ -37,16 +39,37 @@ func ApplyWlSurfaceDoubleBufferedState(
 
 	if update.BufferScale != nil {
 		surface.BufferScale = *update.BufferScale
+		surface.scaled = nil
 	}
 
 	if update.BufferTransform != nil {
 		surface.BufferTransform = *update.BufferTransform
+		surface.scaled = nil
+	}
+
+	if update.ViewportSourceSet {
+		surface.ViewportSource = update.ViewportSource
+		surface.scaled = nil
 	}
 
-	if update.Damage != nil || update.DamageBuffer != nil {
-		surface.Damaged = true
-	} else {
-		surface.Damaged = false
+	if update.ViewportDestinationSet {
+		surface.ViewportDestination = update.ViewportDestination
+		surface.scaled = nil
+	}
+
+	surface.Damage = append(surface.Damage, update.Damage...)
+	for _, damage := range update.DamageBuffer {
+		surface.Damage = append(surface.Damage, surface.BufferRectToSurface(damage))
+	}
+	if len(surface.Damage) > maxDamageRects {
+		/**
+		 * Not drawn in a while (or ever), don't let it grow forever
+		 */
+		union := image.Rectangle{}
+		for _, damage := range surface.Damage {
+			union = union.Union(damage.ToRectangle())
+		}
+		surface.Damage = []Rect{RectFromRectangle(union)}
 	}
 
 	// offset: add to current offset (doc semantics)
@@ -83,6 +106,9 @@ func ApplyWlSurfaceDoubleBufferedState(
 		}
 		surface.InputRegion = update.InputRegion
 	}
+	if update.InputRegionSet {
+		surface.InputRegionShape = update.InputRegionShape
+	}
 
 	if update.OpaqueRegion != nil {
 		if surface.OpaqueRegion != nil && !AreSame(surface.OpaqueRegion, update.OpaqueRegion) {
@@ -178,6 +204,12 @@ func ApplyWlSurfaceDoubleBufferedState(
 		}
 	}
 
+	if role, ok := surface.Role.(*SurfaceRoleXdgPopup); ok && role.Data != nil {
+		if popup := GetXdgPopupObject(s, *role.Data); popup != nil {
+			popup.applyPendingGeometry(s, surface)
+		}
+	}
+
 	// if (
 	//   surface.has_role_data_of_type("xdg_toplevel") &&
 	//   surface.role.data.pending_state
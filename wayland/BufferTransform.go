@@ -0,0 +1,301 @@
+package wayland
+
+import (
+	"image"
+	"math"
+
+	"github.com/mmulet/term.everything/wayland/protocols"
+)
+
+/**
+ * wl_output.scale, DesktopScale rounded up, for
+ * apps that only know about integer scales.
+ */
+var OutputScale int32 = 1
+
+/**
+ * The desktop is drawn at DesktopScale / 120 times
+ * the virtual monitor size, so apps that support it
+ * can render at a higher resolution (sharper text
+ * with sixels or kitty). Sent to apps as
+ * wp_fractional_scale_v1.preferred_scale.
+ */
+var DesktopScale uint32 = 120
+
+/**
+ * n surface pixels to pixels at scale (in 120ths),
+ * rounded half away from zero like fractional-scale-v1.
+ */
+func scalePixels(n int, scale uint32) int {
+	return int(math.Round(float64(n) * float64(scale) / 120))
+}
+
+/**
+ * A rectangle in surface pixels to desktop pixels,
+ * grown to cover every pixel it touches.
+ */
+func scaleRect(r image.Rectangle, scale uint32) image.Rectangle {
+	s := float64(scale) / 120
+	return image.Rect(
+		int(math.Floor(float64(r.Min.X)*s)),
+		int(math.Floor(float64(r.Min.Y)*s)),
+		int(math.Ceil(float64(r.Max.X)*s)),
+		int(math.Ceil(float64(r.Max.Y)*s)),
+	)
+}
+
+/**
+ * The size of the desktop in pixels for a virtual monitor
+ */
+func DesktopSizeForMonitor(size PixelSize) Size {
+	return Size{
+		Width:  uint32(max(scalePixels(int(size.Width), DesktopScale), 1)),
+		Height: uint32(max(scalePixels(int(size.Height), DesktopScale), 1)),
+	}
+}
+
+/**
+ * Change DesktopScale (never below 1, which is 120) and
+ * tell every client: wl_output.scale and the mode to all,
+ * preferred_scale to the ones with wp_fractional_scale_v1.
+ * Call with all the clients locked, then resize the
+ * desktop to DesktopSizeForMonitor.
+ */
+func SetDesktopScale(clients []*Client, scale uint32) {
+	scale = max(scale, 120)
+	if scale == DesktopScale {
+		return
+	}
+	DesktopScale = scale
+	OutputScale = int32((scale + 119) / 120)
+	for _, client := range clients {
+		if client.Status != ClientStatus_Connected {
+			continue
+		}
+		for outputID, version := range protocols.GetGlobalWlOutputBinds(client) {
+			protocols.WlOutput_scale(client, uint32(version), outputID, OutputScale)
+			sendOutputMode(client, outputID)
+			protocols.WlOutput_done(client, uint32(version), outputID)
+		}
+		sendPreferredScale(client)
+	}
+}
+
+/**
+ * The surface, as drawn at some desktop scale
+ */
+type scaledTexture struct {
+	TextureVersion uint64
+	Scale          uint32
+	Image          *image.RGBA
+}
+
+func transformSwapsAxes(transform protocols.WlOutputTransform_enum) bool {
+	switch transform {
+	case protocols.WlOutputTransform_enum__90,
+		protocols.WlOutputTransform_enum__270,
+		protocols.WlOutputTransform_enum_flipped_90,
+		protocols.WlOutputTransform_enum_flipped_270:
+		return true
+	}
+	return false
+}
+
+/**
+ * The buffer size divided by the buffer scale,
+ * rotated by the buffer transform. This is the
+ * surface size, unless there is a wp_viewport.
+ */
+func (w *WlSurface) bufferSurfaceSize() (int32, int32) {
+	if w.Texture == nil {
+		return 0, 0
+	}
+	scale := max(w.BufferScale, 1)
+	width := int32(w.Texture.Width) / scale
+	height := int32(w.Texture.Height) / scale
+	if transformSwapsAxes(w.BufferTransform) {
+		return height, width
+	}
+	return width, height
+}
+
+/**
+ * The part of bufferSurfaceSize that is shown,
+ * all of it unless cropped with wp_viewport.set_source
+ */
+func (w *WlSurface) viewportSource() ViewportSource {
+	if w.ViewportSource != nil {
+		return *w.ViewportSource
+	}
+	width, height := w.bufferSurfaceSize()
+	return ViewportSource{Width: float64(width), Height: float64(height)}
+}
+
+/**
+ * Surface local size, after the buffer scale and
+ * transform, and the wp_viewport crop and scale.
+ */
+func (w *WlSurface) Size() (int32, int32) {
+	if w.Texture == nil {
+		return 0, 0
+	}
+	if w.ViewportDestination != nil {
+		return w.ViewportDestination.Width, w.ViewportDestination.Height
+	}
+	if w.ViewportSource != nil {
+		return max(int32(w.ViewportSource.Width), 1), max(int32(w.ViewportSource.Height), 1)
+	}
+	return w.bufferSurfaceSize()
+}
+
+/**
+ * A point in surface coordinates (of a surface width x height)
+ * to the same point in the buffer, before the buffer scale.
+ * Works for pixel edges, for the center of
+ * the pixel at x pass x + 0.5.
+ */
+func surfaceToBuffer(transform protocols.WlOutputTransform_enum, width, height, x, y float64) (float64, float64) {
+	switch transform {
+	case protocols.WlOutputTransform_enum_flipped:
+		return width - x, y
+	case protocols.WlOutputTransform_enum__90:
+		return y, width - x
+	case protocols.WlOutputTransform_enum_flipped_90:
+		return y, x
+	case protocols.WlOutputTransform_enum__180:
+		return width - x, height - y
+	case protocols.WlOutputTransform_enum_flipped_180:
+		return x, height - y
+	case protocols.WlOutputTransform_enum__270:
+		return height - y, x
+	case protocols.WlOutputTransform_enum_flipped_270:
+		return height - y, width - x
+	}
+	return x, y
+}
+
+/**
+ * The inverse of surfaceToBuffer
+ */
+func bufferToSurface(transform protocols.WlOutputTransform_enum, width, height, x, y float64) (float64, float64) {
+	switch transform {
+	case protocols.WlOutputTransform_enum_flipped:
+		return width - x, y
+	case protocols.WlOutputTransform_enum__90:
+		return width - y, x
+	case protocols.WlOutputTransform_enum_flipped_90:
+		return y, x
+	case protocols.WlOutputTransform_enum__180:
+		return width - x, height - y
+	case protocols.WlOutputTransform_enum_flipped_180:
+		return x, height - y
+	case protocols.WlOutputTransform_enum__270:
+		return y, height - x
+	case protocols.WlOutputTransform_enum_flipped_270:
+		return width - y, height - x
+	}
+	return x, y
+}
+
+/**
+ * The texture as it should be drawn on a desktop
+ * with scale (in 120ths): cropped, scaled and transformed.
+ * Only makes a copy when it has to, and keeps it
+ * until the texture changes.
+ */
+func (w *WlSurface) SurfaceImage(scale uint32) *image.RGBA {
+	texture := w.Texture.AsRGBA()
+	if texture == nil {
+		return nil
+	}
+	bufferScale := max(w.BufferScale, 1)
+	surfaceWidth, surfaceHeight := w.Size()
+	width := scalePixels(int(surfaceWidth), scale)
+	height := scalePixels(int(surfaceHeight), scale)
+	if width <= 0 || height <= 0 {
+		return nil
+	}
+	source := w.viewportSource()
+
+	/**
+	 * The buffer is already the right size, ie an
+	 * app using wp_fractional_scale_v1 at our scale
+	 */
+	if w.BufferTransform == protocols.WlOutputTransform_enum_normal &&
+		width == int(w.Texture.Width) &&
+		height == int(w.Texture.Height) &&
+		source.X == 0 && source.Y == 0 &&
+		source.Width*float64(bufferScale) == float64(width) &&
+		source.Height*float64(bufferScale) == float64(height) {
+		return texture
+	}
+	if w.scaled != nil &&
+		w.scaled.TextureVersion == w.textureVersion &&
+		w.scaled.Scale == scale &&
+		w.scaled.Image.Bounds().Dx() == width &&
+		w.scaled.Image.Bounds().Dy() == height {
+		return w.scaled.Image
+	}
+	var out *image.RGBA
+	if w.scaled != nil && w.scaled.Image.Bounds().Dx() == width && w.scaled.Image.Bounds().Dy() == height {
+		out = w.scaled.Image
+	} else {
+		out = image.NewRGBA(image.Rect(0, 0, width, height))
+	}
+
+	/**
+	 * "oriented" is the buffer after the transform,
+	 * but before the scale (ie in buffer pixels).
+	 */
+	orientedWidth, orientedHeight := w.bufferSurfaceSize()
+	orientedWidth *= bufferScale
+	orientedHeight *= bufferScale
+	sourceX := source.X * float64(bufferScale)
+	sourceY := source.Y * float64(bufferScale)
+	/**
+	 * Buffer pixels per output pixel
+	 */
+	ratioX := source.Width * float64(bufferScale) / float64(width)
+	ratioY := source.Height * float64(bufferScale) / float64(height)
+
+	/**
+	 * Each output pixel is the average of the
+	 * buffer pixels it covers (a box filter),
+	 * so text stays readable when scaling down.
+	 */
+	spanX := max(int(ratioX), 1)
+	spanY := max(int(ratioY), 1)
+	bufferWidth := int(w.Texture.Width)
+	bufferHeight := int(w.Texture.Height)
+	for y := range height {
+		for x := range width {
+			var sum [4]int
+			for oy := range spanY {
+				orientedY := sourceY + float64(y)*ratioY + (float64(oy)+0.5)*ratioY/float64(spanY)
+				for ox := range spanX {
+					orientedX := sourceX + float64(x)*ratioX + (float64(ox)+0.5)*ratioX/float64(spanX)
+					bx, by := surfaceToBuffer(w.BufferTransform, float64(orientedWidth), float64(orientedHeight), orientedX, orientedY)
+					px := min(max(int(bx), 0), bufferWidth-1)
+					py := min(max(int(by), 0), bufferHeight-1)
+					i := py*texture.Stride + px*4
+					sum[0] += int(texture.Pix[i])
+					sum[1] += int(texture.Pix[i+1])
+					sum[2] += int(texture.Pix[i+2])
+					sum[3] += int(texture.Pix[i+3])
+				}
+			}
+			count := spanX * spanY
+			o := y*out.Stride + x*4
+			out.Pix[o] = byte(sum[0] / count)
+			out.Pix[o+1] = byte(sum[1] / count)
+			out.Pix[o+2] = byte(sum[2] / count)
+			out.Pix[o+3] = byte(sum[3] / count)
+		}
+	}
+	w.scaled = &scaledTexture{
+		TextureVersion: w.textureVersion,
+		Scale:          scale,
+		Image:          out,
+	}
+	return out
+}
@@ -7,6 +7,8 @@ import (
 	"net"
 	"slices"
 	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/mmulet/term.everything/wayland/protocols"
@@ -49,9 +51,58 @@ type Client struct {
 
 	LastGetMessageTime time.Time
 
+	/**
+	 * Objects created by the compositor (like wl_data_offer)
+	 * get ids from the server range, which starts at 0xff000000
+	 */
+	nextServerObjectID atomic.Uint32
+
+	/**
+	 * Server created objects can be made from any goroutine
+	 * (ie the selection changing because of terminal input),
+	 * so they are queued here and added to Objects
+	 * the next time this client parses messages.
+	 * The client can't refer to them before then anyway
+	 * because it has not received the event that created them.
+	 * A slice, not a channel, so that adding one never blocks
+	 * (ie while holding Selection.Access) on a client that
+	 * isn't sending requests.
+	 */
+	pendingServerObjects       []serverObject
+	pendingServerObjectsAccess sync.Mutex
+
 	Access sync.Mutex
 }
 
+type serverObject struct {
+	ID     protocols.AnyObjectID
+	Object any
+}
+
+const firstServerObjectID = 0xff000000
+
+func (c *Client) NextServerObjectID() protocols.AnyObjectID {
+	id := firstServerObjectID + c.nextServerObjectID.Add(1) - 1
+	return protocols.AnyObjectID(id)
+}
+
+// Safe to call from any goroutine, see pendingServerObjects
+func (c *Client) AddServerObject(id protocols.AnyObjectID, v any) {
+	c.pendingServerObjectsAccess.Lock()
+	defer c.pendingServerObjectsAccess.Unlock()
+	c.pendingServerObjects = append(c.pendingServerObjects, serverObject{ID: id, Object: v})
+}
+
+func (c *Client) addPendingServerObjects() {
+	c.pendingServerObjectsAccess.Lock()
+	pending := c.pendingServerObjects
+	c.pendingServerObjects = nil
+	c.pendingServerObjectsAccess.Unlock()
+	for _, o := range pending {
+		c.AddObject(o.ID, o.Object)
+	}
+}
+
 func (c *Client) AddFrameDrawRequest(cb protocols.ObjectID[protocols.WlCallback]) {
 	c.FrameDrawRequests <- cb
 }
@@ -198,6 +249,12 @@ func (c *Client) GetGlobalObjectByID(globalID uint32) any {
 		return Global_WlTouch
 	case uint32(protocols.GlobalID_ZxdgDecorationManagerV1):
 		return Global_ZxdgDecorationManagerV1
+	case uint32(protocols.GlobalID_WpViewporter):
+		return Global_WpViewporter
+	case uint32(protocols.GlobalID_WpFractionalScaleManagerV1):
+		return Global_WpFractionalScaleManagerV1
+	case uint32(protocols.GlobalID_ZwpTextInputManagerV3):
+		return Global_ZwpTextInputManagerV3
 	}
 	return nil
 }
@@ -229,6 +286,7 @@ func MakeClient(conn *net.UnixConn) *Client {
 func (c *Client) MainLoop() error {
 	defer func() {
 		c.Status = ClientStatus_Disconnected
+		Focus.ClientDisconnected(c)
 		if c.UnixConnection != nil {
 			if err := c.UnixConnection.Close(); err != nil {
 			}
@@ -303,6 +361,9 @@ func (c *Client) SendPendingMessage(ev protocols.OutgoingEvent) error {
 	var fds []int
 	if ev.FileDescriptor != nil {
 		fds = []int{int(*ev.FileDescriptor)}
+		if ev.CloseFileDescriptorAfterSend {
+			defer syscall.Close(int(*ev.FileDescriptor))
+		}
 	}
 	return SendMessageAndFileDescriptors(c.UnixConnection, buf, fds)
 	// re
@@ -328,6 +389,8 @@ func (c *Client) ParseMessages(n int, fds []int) error {
 		c.UnclaimedFDs = append(c.UnclaimedFDs, protocols.FileDescriptor(fd))
 	}
 
+	c.addPendingServerObjects()
+
 	if n < 0 {
 		return fmt.Errorf("negative byte count received: %d", n)
 	}
@@ -6,12 +6,16 @@ import (
 	"github.com/mmulet/term.everything/wayland/protocols"
 )
 
+/**
+ * Returns true if the surface is holding on to the buffer
+ * (see ZeroCopyBuffers), otherwise the caller should release it.
+ */
 func CopyBufferToWlSurfaceTexture(
 	s protocols.ClientState,
 	surfaceID protocols.ObjectID[protocols.WlSurface],
 	zIndex int,
 	maybebufferID *protocols.ObjectID[protocols.WlBuffer],
-) {
+) bool {
 	surface := GetWlSurfaceObject(s, surfaceID)
 	if maybebufferID == nil {
 		delete(s.DrawableSurfaces(), surfaceID)
@@ -19,44 +23,54 @@ func CopyBufferToWlSurfaceTexture(
 		 * Time to remove the texture from the surface
 		 */
 		if surface == nil {
-			return
+			return false
 		}
+		surface.releaseReplacedBuffer(s)
 		surface.Texture = nil
-		return
+		return false
 	}
 	bufferId := *maybebufferID
 	if surface == nil {
-		return
+		return false
 	}
 
 	pool := GetWlPoolObject_FromBuffer(s, bufferId)
 	if pool == nil {
 		fmt.Println("Could not get pool delegate; can't commit")
-		return
+		return false
 	}
 
 	if pool.MapState == MapStateDestroyed {
 		fmt.Printf("Could not get pool.buffer_pointer; can't commit! pool %d buffer %d\n",
 			pool.WlShmPoolObjectID, bufferId)
-		return
+		return false
 	}
 
 	bufferInfo, ok := pool.Buffers[bufferId]
 	if !ok {
 		fmt.Println("Could not get buffer_info; can't commit")
-		return
+		return false
 	}
 
 	x := surface.Offset.X
 	y := surface.Offset.Y
 
 	if surface.Role == nil {
-		return
+		return false
 	}
 
 	switch role := surface.Role.(type) {
 	case *SurfaceRoleXdgPopup:
-		return
+		if !role.HasData() {
+			return false
+		}
+		popup := GetXdgPopupObject(s, *role.Data)
+		if popup == nil {
+			return false
+		}
+		position := popup.surfacePosition(s, surface)
+		x = position.X
+		y = position.Y
 	case *SurfaceRoleSubSurface:
 		if role.Data != nil {
 			sub_surface := GetWlSubsurfaceObject(s, *role.Data)
@@ -76,6 +90,22 @@ func CopyBufferToWlSurfaceTexture(
 	case *SurfaceRoleXdgToplevel:
 		if surface.XdgSurfaceState != nil {
 			xdg_surface_state := GetXdgSurfaceObject(s, *surface.XdgSurfaceState)
+			var toplevel *XdgToplevel
+			if role.Data != nil {
+				toplevel = GetXdgToplevelObject(s, *role.Data)
+			}
+			if xdg_surface_state != nil && toplevel != nil && !toplevel.Maximized && !toplevel.Fullscreen {
+				/**
+				 * Center windows that picked their own size (ie dialogs)
+				 */
+				geometry := xdg_surface_state.WindowGeometry
+				if geometry.Width <= 0 || geometry.Height <= 0 {
+					scale := max(surface.BufferScale, 1)
+					geometry = XdgWindowGeometry{Width: bufferInfo.Width / scale, Height: bufferInfo.Height / scale}
+				}
+				x = (int32(VirtualMonitorSize.Width)-geometry.Width)/2 - geometry.X
+				y = (int32(VirtualMonitorSize.Height)-geometry.Height)/2 - geometry.Y
+			}
 			if xdg_surface_state != nil {
 				// x = surface.xdg_surface_state.window_geometry.x;
 				// y = surface.xdg_surface_state.window_geometry.y;
@@ -100,7 +130,7 @@ func CopyBufferToWlSurfaceTexture(
 			 * So I think that means if it isn't a cursor anymore,
 			 * we should not draw it
 			 */
-			return
+			return false
 		}
 		x += int32(Pointer.WindowX) + role.Data.Hotspot.X
 		y += int32(Pointer.WindowY) + role.Data.Hotspot.Y
@@ -110,6 +140,33 @@ func CopyBufferToWlSurfaceTexture(
 	surface.Position.Y = y
 	surface.Position.Z = int32(zIndex)
 
+	/**
+	 * Only argb8888 is the same as the desktop,
+	 * everything else has to be converted.
+	 */
+	if bufferInfo.Format != protocols.WlShmFormat_enum_argb8888 {
+		return copyConvertedBuffer(s, surfaceID, surface, pool, bufferInfo)
+	}
+
+	if ZeroCopyBuffers {
+		memMap, ok := pool.MemMaps[pool.WlShmPoolObjectID]
+		total := int(bufferInfo.Stride) * int(bufferInfo.Height)
+		offset := int(bufferInfo.Offset)
+		if !ok || total < 0 || offset < 0 || offset+total > len(memMap.Bytes) {
+			fmt.Println("Pool memory bounds error; can't commit")
+			return false
+		}
+		surface.holdBuffer(s, pool, bufferId, &Texture{
+			Stride: uint32(bufferInfo.Stride),
+			Width:  uint32(bufferInfo.Width),
+			Height: uint32(bufferInfo.Height),
+			Data:   memMap.Bytes[offset : offset+total],
+		})
+		surface.textureVersion++
+		s.DrawableSurfaces()[surfaceID] = true
+		return true
+	}
+
 	if surface.Texture != nil {
 		if surface.Texture.Stride != uint32(bufferInfo.Stride) ||
 			surface.Texture.Width != uint32(bufferInfo.Width) ||
@@ -122,7 +179,7 @@ func CopyBufferToWlSurfaceTexture(
 		size := int(bufferInfo.Stride) * int(bufferInfo.Height)
 		if size < 0 {
 			fmt.Println("Invalid buffer size; can't commit")
-			return
+			return false
 		}
 		surface.Texture = &Texture{
 			Stride: uint32(bufferInfo.Stride),
@@ -135,13 +192,13 @@ func CopyBufferToWlSurfaceTexture(
 	memMap, ok := pool.MemMaps[pool.WlShmPoolObjectID]
 	if !ok {
 		fmt.Println("No memmap for pool; can't commit")
-		return
+		return false
 	}
 
 	total := int(bufferInfo.Stride) * int(bufferInfo.Height)
 	if total < 0 || total > len(surface.Texture.Data) {
 		fmt.Println("Computed copy size out of bounds; can't commit")
-		return
+		return false
 	}
 
 	offset := int(bufferInfo.Offset)
@@ -149,11 +206,70 @@ func CopyBufferToWlSurfaceTexture(
 	src := memMap.Bytes
 	if offset < 0 || offset+total > len(src) {
 		fmt.Println("Pool memory bounds error during copy; can't commit")
-		return
+		return false
 
 	}
 
 	copy(surface.Texture.Data, src[offset:offset+total])
 
+	surface.textureVersion++
+	s.DrawableSurfaces()[surfaceID] = true
+	return false
+}
+
+/**
+ * Like the copy at the end of CopyBufferToWlSurfaceTexture,
+ * but converts to argb8888 on the way.
+ */
+func copyConvertedBuffer(
+	s protocols.ClientState,
+	surfaceID protocols.ObjectID[protocols.WlSurface],
+	surface *WlSurface,
+	pool *WlShmPool,
+	bufferInfo BufferInfo,
+) bool {
+	width := int(bufferInfo.Width)
+	height := int(bufferInfo.Height)
+	stride := int(bufferInfo.Stride)
+	if width <= 0 || height <= 0 || stride < width*ShmFormatBytesPerPixel(bufferInfo.Format) {
+		fmt.Println("Invalid buffer size; can't commit")
+		return false
+	}
+
+	memMap, ok := pool.MemMaps[pool.WlShmPoolObjectID]
+	if !ok {
+		fmt.Println("No memmap for pool; can't commit")
+		return false
+	}
+	offset := int(bufferInfo.Offset)
+	total := stride * height
+	if offset < 0 || offset+total > len(memMap.Bytes) {
+		fmt.Println("Pool memory bounds error during copy; can't commit")
+		return false
+	}
+
+	/**
+	 * A converted texture never points into the
+	 * pool, don't convert into the held buffer.
+	 */
+	if surface.HeldBuffer != nil {
+		surface.releaseReplacedBuffer(s)
+		surface.Texture = nil
+	}
+	if surface.Texture == nil ||
+		surface.Texture.Stride != uint32(width*4) ||
+		surface.Texture.Width != uint32(width) ||
+		surface.Texture.Height != uint32(height) {
+		surface.Texture = &Texture{
+			Stride: uint32(width * 4),
+			Width:  uint32(width),
+			Height: uint32(height),
+			Data:   make([]byte, width*4*height),
+		}
+	}
+	ConvertShmToBGRA(surface.Texture.Data, memMap.Bytes[offset:offset+total], width, height, stride, bufferInfo.Format)
+
+	surface.textureVersion++
 	s.DrawableSurfaces()[surfaceID] = true
+	return false
 }
@@ -0,0 +1,116 @@
+package wayland
+
+import (
+	"image"
+)
+
+/**
+ * If a frame has more damage rectangles than this
+ * we just redraw their bounding box.
+ */
+const maxDamageRects = 32
+
+/**
+ * Where a surface was drawn on the desktop
+ */
+type surfacePlacement struct {
+	Key  clientSurfaceID
+	Rect image.Rectangle
+}
+
+func (r Rect) ToRectangle() image.Rectangle {
+	return image.Rect(
+		int(r.X),
+		int(r.Y),
+		int(r.X)+int(r.Width),
+		int(r.Y)+int(r.Height),
+	)
+}
+
+func RectFromRectangle(r image.Rectangle) Rect {
+	return Rect{
+		X:      int32(r.Min.X),
+		Y:      int32(r.Min.Y),
+		Width:  int32(r.Dx()),
+		Height: int32(r.Dy()),
+	}
+}
+
+/**
+ * Compare where surfaces were drawn last frame to this frame,
+ * anything that appeared, disappeared, moved or changed its
+ * place in the stack is damaged where it was and where it is.
+ */
+func placementDamage(before, after []surfacePlacement) []image.Rectangle {
+	damage := make([]image.Rectangle, 0)
+
+	beforeByKey := make(map[clientSurfaceID]image.Rectangle, len(before))
+	for _, p := range before {
+		beforeByKey[p.Key] = p.Rect
+	}
+	afterByKey := make(map[clientSurfaceID]image.Rectangle, len(after))
+	for _, p := range after {
+		afterByKey[p.Key] = p.Rect
+	}
+
+	for _, p := range before {
+		if _, ok := afterByKey[p.Key]; !ok {
+			damage = append(damage, p.Rect)
+		}
+	}
+	for _, p := range after {
+		old, ok := beforeByKey[p.Key]
+		if !ok {
+			damage = append(damage, p.Rect)
+			continue
+		}
+		if old != p.Rect {
+			damage = append(damage, old, p.Rect)
+		}
+	}
+
+	/**
+	 * Surfaces that are in both, but in a different order
+	 */
+	commonBefore := make([]surfacePlacement, 0, len(before))
+	for _, p := range before {
+		if _, ok := afterByKey[p.Key]; ok {
+			commonBefore = append(commonBefore, p)
+		}
+	}
+	commonAfter := make([]surfacePlacement, 0, len(after))
+	for _, p := range after {
+		if _, ok := beforeByKey[p.Key]; ok {
+			commonAfter = append(commonAfter, p)
+		}
+	}
+	for i := range commonAfter {
+		if commonAfter[i].Key != commonBefore[i].Key {
+			damage = append(damage, commonAfter[i].Rect, commonBefore[i].Rect)
+		}
+	}
+	return damage
+}
+
+/**
+ * Clip to bounds, drop the empty ones, and
+ * if there are too many, use their bounding box.
+ */
+func normalizeDamage(damage []image.Rectangle, bounds image.Rectangle) []image.Rectangle {
+	out := make([]image.Rectangle, 0, len(damage))
+	for _, r := range damage {
+		r = r.Intersect(bounds)
+		if r.Empty() {
+			continue
+		}
+		out = append(out, r)
+	}
+	if len(out) <= maxDamageRects {
+		return out
+	}
+	union := image.Rectangle{}
+	for _, r := range out {
+		union = union.Union(r)
+	}
+	return []image.Rectangle{union}
+}
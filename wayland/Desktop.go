@@ -24,6 +24,19 @@ type Desktop struct {
 
 	CreatedAt                 time.Time
 	WillShowAppRightAtStartup bool
+
+	/**
+	 * Parts of Buffer that changed since the last
+	 * TakeDamage, in desktop pixels.
+	 */
+	Damage     []image.Rectangle
+	FullDamage bool
+
+	/**
+	 * Where every surface was drawn last frame
+	 */
+	placements  []surfacePlacement
+	showingIcon bool
 }
 
 func MakeDesktop(size Size, willShowAppRightAtStartup bool, iconPNG []byte) *Desktop {
@@ -43,35 +56,88 @@ func MakeDesktop(size Size, willShowAppRightAtStartup bool, iconPNG []byte) *Des
 		},
 		CreatedAt:                 time.Now(),
 		WillShowAppRightAtStartup: willShowAppRightAtStartup,
+		Damage:                    make([]image.Rectangle, 0),
+		FullDamage:                true,
 	}
 	cd.IconImg = RgbaToBgra(DecodeIconToNRGBA(iconPNG))
 	return cd
 }
 
-func RgbaToBgra(src *image.NRGBA) *image.NRGBA {
-	if src == nil {
+/**
+ * Reallocate the back buffer for a new virtual monitor size
+ */
+func (cd *Desktop) Resize(size Size) {
+	w := int(size.Width)
+	h := int(size.Height)
+	if w == cd.Width && h == cd.Height {
+		return
+	}
+	cd.Width = w
+	cd.Height = h
+	cd.Stride = w * 4
+	cd.Buffer = make([]byte, w*h*4)
+	cd.RGBA = &image.RGBA{
+		Pix:    cd.Buffer,
+		Stride: cd.Stride,
+		Rect:   image.Rect(0, 0, w, h),
+	}
+	cd.FullDamage = true
+}
+
+/**
+ * Returns the parts of the desktop that changed
+ * since the last call. nil means all of it.
+ */
+func (cd *Desktop) TakeDamage() []image.Rectangle {
+	if cd.FullDamage {
+		cd.FullDamage = false
+		cd.Damage = cd.Damage[:0]
 		return nil
 	}
-	b := src.Bounds()
-	dst := image.NewNRGBA(b)
-	for y := b.Min.Y; y < b.Max.Y; y++ {
-		for x := b.Min.X; x < b.Max.X; x++ {
-			off := src.PixOffset(x, y)
-			r := src.Pix[off+0]
-			g := src.Pix[off+1]
-			bb := src.Pix[off+2]
-			a := src.Pix[off+3]
-
-			dstOff := dst.PixOffset(x, y)
-			dst.Pix[dstOff+0] = bb
-			dst.Pix[dstOff+1] = g
-			dst.Pix[dstOff+2] = r
-			dst.Pix[dstOff+3] = a
+	damage := cd.Damage
+	cd.Damage = make([]image.Rectangle, 0)
+	return damage
+}
+
+/**
+ * RGBA <-> BGRA, width x height pixels from the start
+ * of src into dst. Alpha is copied (0xff if opaque).
+ */
+func swapRedAndBlue(dst []byte, dstStride int, src []byte, srcStride int, width, height int, opaque bool) {
+	for y := range height {
+		srcRow := src[y*srcStride : y*srcStride+width*4]
+		dstRow := dst[y*dstStride : y*dstStride+width*4]
+		for i := 0; i < len(srcRow); i += 4 {
+			dstRow[i] = srcRow[i+2]
+			dstRow[i+1] = srcRow[i+1]
+			dstRow[i+2] = srcRow[i]
+			dstRow[i+3] = srcRow[i+3]
+			if opaque {
+				dstRow[i+3] = 0xff
+			}
 		}
 	}
+}
+
+func RgbaToBgra(src *image.NRGBA) *image.NRGBA {
+	if src == nil {
+		return nil
+	}
+	dst := image.NewNRGBA(src.Bounds())
+	swapRedAndBlue(dst.Pix, dst.Stride, src.Pix, src.Stride, src.Rect.Dx(), src.Rect.Dy(), false)
 	return dst
 }
 
+/**
+ * The other way, for the desktop and surfaces. They are
+ * argb8888 (B G R A in memory, premultiplied) in an
+ * image.RGBA. dst is at least the size of src. opaque
+ * for the desktop, where alpha is meaningless.
+ */
+func BgraToRgba(dst *image.RGBA, src *image.RGBA, opaque bool) {
+	swapRedAndBlue(dst.Pix, dst.Stride, src.Pix, src.Stride, src.Rect.Dx(), src.Rect.Dy(), opaque)
+}
+
 func DecodeIconToNRGBA(data []byte) *image.NRGBA {
 	if len(data) == 0 {
 		return nil
@@ -99,6 +165,22 @@ func (cd *Desktop) DrawImage(src image.Image, dx, dy int) {
 	draw.Draw(cd.RGBA, r, src, sb.Min, draw.Over)
 }
 
+/**
+ * DrawImage, but only inside of clip
+ */
+func (cd *Desktop) DrawImageClipped(src image.Image, dx, dy int, clip image.Rectangle) {
+	if src == nil {
+		return
+	}
+	sb := src.Bounds()
+	r := image.Rect(dx, dy, dx+sb.Dx(), dy+sb.Dy())
+	clipped := r.Intersect(clip)
+	if clipped.Empty() {
+		return
+	}
+	draw.Draw(cd.RGBA, clipped, src, sb.Min.Add(clipped.Min.Sub(r.Min)), draw.Over)
+}
+
 /*
 * If we will show an app right at startup,
      * we want to wait a bit before potentially
@@ -118,22 +200,52 @@ func (cd *Desktop) Clear() {
 	clear(cd.Buffer)
 }
 
+func (cd *Desktop) ClearRect(r image.Rectangle) {
+	draw.Draw(cd.RGBA, r, image.Transparent, image.Point{}, draw.Src)
+}
+
 type SortedSurfaceEntry struct {
 	Surface   *WlSurface
 	Src       *image.RGBA
 	SurfaceID protocols.ObjectID[protocols.WlSurface]
+	Client    *Client
+
+	/**
+	 * On the desktop, and the surface at
+	 * the top of its subsurface tree.
+	 */
+	X, Y int
+	Root protocols.ObjectID[protocols.WlSurface]
+	/**
+	 * How many popups deep, popups go
+	 * above the surfaces they are from.
+	 */
+	PopupDepth int
+	/**
+	 * The popup surface this is a part of, 0 if none
+	 */
+	Popup protocols.ObjectID[protocols.WlSurface]
+}
+
+/**
+ * Object ids are only unique per client
+ */
+type clientSurfaceID struct {
+	client    *Client
+	surfaceID protocols.ObjectID[protocols.WlSurface]
 }
 
 type SortedSurfaceEntryParentLocation struct {
 	parentID protocols.ObjectID[protocols.WlSurface]
 	x, y     int
+	isPopup  bool
 }
 
 func (cd *Desktop) DrawClients(clients []*Client) {
 
 	sorted := make([]SortedSurfaceEntry, 0, 64)
 
-	childToParent := make(map[protocols.ObjectID[protocols.WlSurface]]SortedSurfaceEntryParentLocation)
+	childToParent := make(map[clientSurfaceID]SortedSurfaceEntryParentLocation)
 
 	for _, c := range clients {
 		if c == nil {
@@ -144,7 +256,7 @@ func (cd *Desktop) DrawClients(clients []*Client) {
 			if surface == nil {
 				continue
 			}
-			tex := surface.Texture.AsRGBA()
+			tex := surface.SurfaceImage(DesktopScale)
 			if tex == nil {
 				continue
 			}
@@ -153,22 +265,90 @@ func (cd *Desktop) DrawClients(clients []*Client) {
 				if child == nil {
 					continue
 				}
-				childToParent[*child] = SortedSurfaceEntryParentLocation{
+				childToParent[clientSurfaceID{c, *child}] = SortedSurfaceEntryParentLocation{
 					parentID: surface_id,
 					x:        int(surface.Position.X),
 					y:        int(surface.Position.Y),
 				}
 			}
 
+			/**
+			 * Popups are relative to the window
+			 * geometry of their parent
+			 */
+			if role, ok := surface.Role.(*SurfaceRoleXdgPopup); ok && role.Data != nil {
+				if popup := GetXdgPopupObject(c, *role.Data); popup != nil && popup.Parent != nil {
+					parentID := GetSurfaceIDFromRole(c, *popup.Parent)
+					parent := GetSurfaceFromRole(c, *popup.Parent)
+					parentXdgSurface := GetXdgSurfaceObject(c, *popup.Parent)
+					if parentID != nil && parent != nil && parentXdgSurface != nil && *parentID != surface_id {
+						childToParent[clientSurfaceID{c, surface_id}] = SortedSurfaceEntryParentLocation{
+							parentID: *parentID,
+							x:        int(parent.Position.X + parentXdgSurface.WindowGeometry.X),
+							y:        int(parent.Position.Y + parentXdgSurface.WindowGeometry.Y),
+							isPopup:  true,
+						}
+					}
+				}
+			}
+
 			sorted = append(sorted, SortedSurfaceEntry{
 				Surface:   surface,
 				Src:       tex,
 				SurfaceID: surface_id,
+				Client:    c,
 			})
 		}
 	}
 
-	sort.Slice(sorted, func(i, j int) bool {
+	/**
+	 * Recursively get the position by adding
+	 * all ancestor position (bounded, in case
+	 * a client makes a cycle)
+	 */
+	for i := range sorted {
+		it := &sorted[i]
+		it.X = int(it.Surface.Position.X)
+		it.Y = int(it.Surface.Position.Y)
+		it.Root = it.SurfaceID
+		parent, ok := childToParent[clientSurfaceID{it.Client, it.SurfaceID}]
+		for depth := 0; ok && depth < len(sorted); depth++ {
+			it.X += parent.x
+			it.Y += parent.y
+			if parent.isPopup {
+				if it.PopupDepth == 0 {
+					it.Popup = it.Root
+				}
+				it.PopupDepth++
+			}
+			it.Root = parent.parentID
+			parent, ok = childToParent[clientSurfaceID{it.Client, parent.parentID}]
+		}
+	}
+
+	/**
+	 * Windows are stacked in the order of Focus.Toplevels,
+	 * inside of a window by z index. Cursors go on top.
+	 */
+	stackingOrder := Focus.stackingOrder()
+	layer := func(it *SortedSurfaceEntry) int {
+		if _, isCursor := it.Surface.Role.(*SurfaceRoleCursor); isCursor {
+			return len(stackingOrder) + 1
+		}
+		if index, ok := stackingOrder[clientSurfaceID{it.Client, it.Root}]; ok {
+			return index
+		}
+		return -1
+	}
+	sort.SliceStable(sorted, func(i, j int) bool {
+		li := layer(&sorted[i])
+		lj := layer(&sorted[j])
+		if li != lj {
+			return li < lj
+		}
+		if sorted[i].PopupDepth != sorted[j].PopupDepth {
+			return sorted[i].PopupDepth < sorted[j].PopupDepth
+		}
 		zi := sorted[i].Surface.Position.Z
 		zj := sorted[j].Surface.Position.Z
 		if zi == zj {
@@ -177,26 +357,82 @@ func (cd *Desktop) DrawClients(clients []*Client) {
 		return zi < zj
 	})
 
-	cd.Clear()
+	bounds := image.Rect(0, 0, cd.Width, cd.Height)
 
-	if len(sorted) == 0 && cd.AfterOpeningTimeout() {
-		cd.DrawImage(cd.IconImg, 0, 0)
-		return
+	stack := make([]SurfaceOnScreen, 0, len(sorted))
+	defer func() {
+		Focus.SetSurfaceStack(stack)
+	}()
+
+	showIcon := len(sorted) == 0 && cd.AfterOpeningTimeout()
+	if showIcon != cd.showingIcon {
+		cd.showingIcon = showIcon
+		cd.FullDamage = true
 	}
 
+	placements := make([]surfacePlacement, 0, len(sorted))
+	positions := make([]image.Point, 0, len(sorted))
+	frameDamage := make([]image.Rectangle, 0)
+
+	/**
+	 * Positions are in surface coordinates,
+	 * the desktop is DesktopScale / 120 times bigger.
+	 */
 	for _, it := range sorted {
-		/**
-		 * Recursively get the position by adding
-		 * all ancestor position
-		 */
-		x := int(it.Surface.Position.X)
-		y := int(it.Surface.Position.Y)
-		parent, ok := childToParent[it.SurfaceID]
-		for ok {
-			x += parent.x
-			y += parent.y
-			parent, ok = childToParent[parent.parentID]
+		x, y, root := it.X, it.Y, it.Root
+		origin := image.Pt(scalePixels(x, DesktopScale), scalePixels(y, DesktopScale))
+		rect := it.Src.Bounds().Sub(it.Src.Bounds().Min).Add(origin)
+		positions = append(positions, origin)
+		placements = append(placements, surfacePlacement{
+			Key:  clientSurfaceID{it.Client, it.SurfaceID},
+			Rect: rect,
+		})
+		for _, damage := range it.Surface.Damage {
+			r := scaleRect(damage.ToRectangle(), DesktopScale)
+			frameDamage = append(frameDamage, r.Add(origin).Intersect(rect))
+		}
+		it.Surface.Damage = nil
+
+		if _, isCursor := it.Surface.Role.(*SurfaceRoleCursor); isCursor {
+			continue
+		}
+		stack = append(stack, SurfaceOnScreen{
+			Client:    it.Client,
+			SurfaceID: it.SurfaceID,
+			Surface:   it.Surface,
+			Root:      root,
+			Popup:     it.Popup,
+			X:         int32(x),
+			Y:         int32(y),
+		})
+	}
+	frameDamage = append(frameDamage, placementDamage(cd.placements, placements)...)
+	cd.placements = placements
+
+	if cd.FullDamage {
+		cd.Clear()
+		if showIcon {
+			cd.DrawImage(cd.IconImg, 0, 0)
+			return
+		}
+		for i, it := range sorted {
+			cd.DrawImage(it.Src, positions[i].X, positions[i].Y)
+		}
+		return
+	}
+	if showIcon {
+		return
+	}
+
+	/**
+	 * Only recomposite what changed
+	 */
+	frameDamage = normalizeDamage(frameDamage, bounds)
+	for _, damage := range frameDamage {
+		cd.ClearRect(damage)
+		for i, it := range sorted {
+			cd.DrawImageClipped(it.Src, positions[i].X, positions[i].Y, damage)
 		}
-		cd.DrawImage(it.Src, x, y)
 	}
+	cd.Damage = normalizeDamage(append(cd.Damage, frameDamage...), bounds)
 }
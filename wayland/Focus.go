@@ -0,0 +1,607 @@
+package wayland
+
+import (
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/mmulet/term.everything/wayland/protocols"
+)
+
+/**
+ * A surface as it was last drawn on the desktop
+ */
+type SurfaceOnScreen struct {
+	Client    *Client
+	SurfaceID protocols.ObjectID[protocols.WlSurface]
+	Surface   *WlSurface
+	/**
+	 * The surface at the top of the subsurface tree,
+	 * (itself if it is not a subsurface)
+	 */
+	Root protocols.ObjectID[protocols.WlSurface]
+	/**
+	 * The xdg_popup surface this is part of, 0 if none
+	 */
+	Popup protocols.ObjectID[protocols.WlSurface]
+	X     int32
+	Y     int32
+}
+
+func (o *SurfaceOnScreen) isSame(other *SurfaceOnScreen) bool {
+	if o == nil || other == nil {
+		return o == other
+	}
+	return o.Client == other.Client && o.SurfaceID == other.SurfaceID
+}
+
+type ToplevelRef struct {
+	Client     *Client
+	ToplevelID protocols.ObjectID[protocols.XdgToplevel]
+	SurfaceID  protocols.ObjectID[protocols.WlSurface]
+	Toplevel   *XdgToplevel
+	XdgSurface *XdgSurface
+	/**
+	 * Set by ToplevelMapped, counts up
+	 */
+	MappedOrder uint64
+}
+
+func (t *ToplevelRef) isSame(other *ToplevelRef) bool {
+	if t == nil || other == nil {
+		return t == other
+	}
+	return t.Client == other.Client && t.ToplevelID == other.ToplevelID
+}
+
+/**
+ * Which surface gets pointer events, and
+ * which toplevel gets keyboard events.
+ *
+ * Only ever lock Access after the client locks,
+ * never the other way around.
+ *
+ * Requests of one client (ie mapping a toplevel) can
+ * move the focus away from another client, whose lock
+ * isn't held then. So everything that reads or changes
+ * a client's state goes through toClient.
+ */
+type SeatFocus struct {
+	Access sync.Mutex
+
+	/**
+	 * What was drawn last frame, 0 is the bottom.
+	 * The pointer is hit tested against this.
+	 */
+	SurfaceStack []SurfaceOnScreen
+
+	/**
+	 * In the order they were activated,
+	 * the last one is the active toplevel.
+	 */
+	Toplevels []*ToplevelRef
+
+	Pointer  *SurfaceOnScreen
+	Keyboard *ToplevelRef
+
+	/**
+	 * Open menus, the last one is the topmost
+	 * and gets the keyboard.
+	 */
+	Grabs []*PopupGrab
+
+	/**
+	 * Every zwp_text_input_v3, they get enter
+	 * and leave along with the keyboard.
+	 */
+	TextInputs []*TextInputRef
+
+	Modifiers uint32
+
+	/**
+	 * The terminal we draw to lost focus, so
+	 * nothing has the keyboard or is activated.
+	 */
+	TerminalUnfocused bool
+
+	mappedCount uint64
+
+	/**
+	 * Presses that closed popups, their
+	 * releases are not sent either.
+	 */
+	swallowedButtons map[uint32]bool
+	swallowedKeys    map[uint32]bool
+
+	/**
+	 * Sends waiting for their client's lock, in order
+	 */
+	queuedEvents []queuedEvent
+
+	/**
+	 * The client locks held by whoever holds Access,
+	 * set by lockFromClient and lockWithClients.
+	 */
+	lockedClient     *Client
+	allClientsLocked bool
+}
+
+type queuedEvent struct {
+	Client *Client
+	Send   func()
+}
+
+var Focus = SeatFocus{
+	swallowedButtons: make(map[uint32]bool),
+	swallowedKeys:    make(map[uint32]bool),
+}
+
+/**
+ * Lock Access from a request of client, which
+ * holds its own lock but no other client's.
+ */
+func (f *SeatFocus) lockFromClient(client *Client) (unlock func()) {
+	f.Access.Lock()
+	f.lockedClient = client
+	f.sendQueuedEvents()
+	return func() {
+		f.lockedClient = nil
+		f.Access.Unlock()
+	}
+}
+
+/**
+ * Lock Access with every client locked
+ * (ie from input or the draw loop).
+ */
+func (f *SeatFocus) lockWithClients() (unlock func()) {
+	f.Access.Lock()
+	f.allClientsLocked = true
+	f.sendQueuedEvents()
+	return func() {
+		f.allClientsLocked = false
+		f.Access.Unlock()
+	}
+}
+
+func (f *SeatFocus) clientLocked(client *Client) bool {
+	return f.allClientsLocked || f.lockedClient == client
+}
+
+/**
+ * Call send now if the client's lock is held,
+ * otherwise the next time it is (at the latest
+ * next frame, the draw loop locks every client).
+ */
+func (f *SeatFocus) toClient(client *Client, send func()) {
+	if client.Status != ClientStatus_Connected {
+		return
+	}
+	if f.clientLocked(client) {
+		send()
+		return
+	}
+	f.queuedEvents = append(f.queuedEvents, queuedEvent{Client: client, Send: send})
+}
+
+/**
+ * Send what was queued for the clients that are locked now.
+ * Called whenever Access is locked, so a client gets its
+ * queued events before anything that is sent right away.
+ */
+func (f *SeatFocus) sendQueuedEvents() {
+	queued := f.queuedEvents
+	f.queuedEvents = nil
+	for _, ev := range queued {
+		if ev.Client.Status != ClientStatus_Connected {
+			continue
+		}
+		if !f.clientLocked(ev.Client) {
+			f.queuedEvents = append(f.queuedEvents, ev)
+			continue
+		}
+		ev.Send()
+	}
+}
+
+/**
+ * Called after every draw, so that the
+ * pointer focus follows surfaces that move,
+ * appear or disappear under the pointer.
+ */
+func (f *SeatFocus) SetSurfaceStack(stack []SurfaceOnScreen) {
+	defer f.lockWithClients()()
+	f.SurfaceStack = stack
+	f.updatePointerFocus(Pointer.WindowX, Pointer.WindowY)
+}
+
+func (f *SeatFocus) surfaceAt(x, y float32) *SurfaceOnScreen {
+	for i := len(f.SurfaceStack) - 1; i >= 0; i-- {
+		it := &f.SurfaceStack[i]
+		if it.Client.Status != ClientStatus_Connected {
+			continue
+		}
+		if it.Surface.AcceptsInputAt(int32(x)-it.X, int32(y)-it.Y) {
+			return it
+		}
+	}
+	return nil
+}
+
+/**
+ * A copy of the surface under x, y as drawn last
+ * frame, nil if there is none. Call with the clients locked.
+ */
+func (f *SeatFocus) SurfaceAt(x, y float32) *SurfaceOnScreen {
+	defer f.lockWithClients()()
+	target := f.surfaceAt(x, y)
+	if target == nil {
+		return nil
+	}
+	it := *target
+	return &it
+}
+
+/**
+ * A copy of where the surface was drawn last
+ * frame, nil if it wasn't.
+ */
+func (f *SeatFocus) DrawnSurface(client *Client, surfaceID protocols.ObjectID[protocols.WlSurface]) *SurfaceOnScreen {
+	f.Access.Lock()
+	defer f.Access.Unlock()
+	for _, it := range f.SurfaceStack {
+		if it.Client == client && it.SurfaceID == surfaceID {
+			return &it
+		}
+	}
+	return nil
+}
+
+func (f *SeatFocus) updatePointerFocus(x, y float32) {
+	target := f.surfaceAt(x, y)
+	if target.isSame(f.Pointer) {
+		if target != nil {
+			/**
+			 * It may have moved
+			 */
+			f.Pointer.X = target.X
+			f.Pointer.Y = target.Y
+		}
+		return
+	}
+
+	if old := f.Pointer; old != nil && old.Client.Status == ClientStatus_Connected {
+		serial := GetNextEventSerial()
+		for pointerID, version := range protocols.GetGlobalWlPointerBinds(old.Client) {
+			protocols.WlPointer_leave(old.Client, pointerID, serial, old.SurfaceID)
+			protocols.WlPointer_frame(old.Client, uint32(version), pointerID)
+		}
+	}
+	f.Pointer = nil
+	if target == nil {
+		return
+	}
+	focus := *target
+	f.Pointer = &focus
+
+	serial := GetNextEventSerial()
+	for pointerID, version := range protocols.GetGlobalWlPointerBinds(focus.Client) {
+		protocols.WlPointer_enter(focus.Client, pointerID, serial, focus.SurfaceID, x-float32(focus.X), y-float32(focus.Y))
+		protocols.WlPointer_frame(focus.Client, uint32(version), pointerID)
+	}
+}
+
+func (f *SeatFocus) PointerMotion(x, y float32) {
+	defer f.lockWithClients()()
+	f.updatePointerFocus(x, y)
+	focus := f.Pointer
+	if focus == nil {
+		return
+	}
+	timestamp := uint32(time.Now().UnixMilli())
+	for pointerID, version := range protocols.GetGlobalWlPointerBinds(focus.Client) {
+		protocols.WlPointer_motion(focus.Client, pointerID, timestamp, x-float32(focus.X), y-float32(focus.Y))
+		protocols.WlPointer_frame(focus.Client, uint32(version), pointerID)
+	}
+}
+
+func (f *SeatFocus) PointerButton(button uint32, state protocols.WlPointerButtonState_enum) {
+	defer f.lockWithClients()()
+	if state == protocols.WlPointerButtonState_enum_released && f.swallowedButtons[button] {
+		delete(f.swallowedButtons, button)
+		return
+	}
+	focus := f.Pointer
+	if state == protocols.WlPointerButtonState_enum_pressed && len(f.Grabs) > 0 && !f.insideGrab(focus) {
+		/**
+		 * Clicking outside of the open menus closes them
+		 */
+		f.dismissPopups()
+		f.swallowedButtons[button] = true
+		return
+	}
+	if focus == nil {
+		return
+	}
+	if state == protocols.WlPointerButtonState_enum_pressed {
+		/**
+		 * Click to focus
+		 */
+		if toplevel := f.toplevelWithSurface(focus.Client, focus.Root); toplevel != nil {
+			f.activate(toplevel)
+		}
+	}
+	timestamp := uint32(time.Now().UnixMilli())
+	serial := GetNextEventSerial()
+	for pointerID, version := range protocols.GetGlobalWlPointerBinds(focus.Client) {
+		protocols.WlPointer_button(focus.Client, pointerID, serial, timestamp, button, state)
+		protocols.WlPointer_frame(focus.Client, uint32(version), pointerID)
+	}
+}
+
+func (f *SeatFocus) PointerAxis(axis protocols.WlPointerAxis_enum, value float32) {
+	defer f.lockWithClients()()
+	focus := f.Pointer
+	if focus == nil {
+		return
+	}
+	timestamp := uint32(time.Now().UnixMilli())
+	for pointerID, version := range protocols.GetGlobalWlPointerBinds(focus.Client) {
+		protocols.WlPointer_axis(focus.Client, pointerID, timestamp, axis, value)
+		protocols.WlPointer_frame(focus.Client, uint32(version), pointerID)
+	}
+}
+
+func (f *SeatFocus) KeyboardKey(key uint32, state protocols.WlKeyboardKeyState_enum) {
+	defer f.lockWithClients()()
+	if state == protocols.WlKeyboardKeyState_enum_released && f.swallowedKeys[key] {
+		delete(f.swallowedKeys, key)
+		return
+	}
+	if state == protocols.WlKeyboardKeyState_enum_pressed && key == evdevKeyEsc && len(f.Grabs) > 0 {
+		f.dismissPopups()
+		f.swallowedKeys[key] = true
+		return
+	}
+	focus := f.keyboardTarget()
+	if focus == nil {
+		return
+	}
+	timestamp := uint32(time.Now().UnixMilli())
+	serial := GetNextEventSerial()
+	for keyboardID := range protocols.GetGlobalWlKeyboardBinds(focus.Client) {
+		protocols.WlKeyboard_key(focus.Client, keyboardID, serial, timestamp, key, state)
+	}
+}
+
+/**
+ * Only sends the modifiers if they changed,
+ * the focused client gets the current modifiers
+ * right after wl_keyboard.enter anyway.
+ */
+func (f *SeatFocus) KeyboardModifiers(modifiers uint32) {
+	defer f.lockWithClients()()
+	if f.Modifiers == modifiers {
+		return
+	}
+	f.Modifiers = modifiers
+	focus := f.keyboardTarget()
+	if focus == nil {
+		return
+	}
+	serial := GetNextEventSerial()
+	for keyboardID := range protocols.GetGlobalWlKeyboardBinds(focus.Client) {
+		protocols.WlKeyboard_modifiers(focus.Client, keyboardID, serial, modifiers, 0, 0, 0)
+	}
+}
+
+func (f *SeatFocus) sendKeyboardEnter(client *Client, keyboardID protocols.ObjectID[protocols.WlKeyboard], surfaceID protocols.ObjectID[protocols.WlSurface]) {
+	serial := GetNextEventSerial()
+	protocols.WlKeyboard_enter(client, keyboardID, serial, surfaceID, []byte{})
+	protocols.WlKeyboard_modifiers(client, keyboardID, serial, f.Modifiers, 0, 0, 0)
+}
+
+/**
+ * configureNew is false when the caller is going to
+ * send the first configure of the new toplevel itself.
+ */
+func (f *SeatFocus) setKeyboardFocus(toplevel *ToplevelRef, configureNew bool) {
+	if toplevel.isSame(f.Keyboard) {
+		return
+	}
+	f.dismissPopups()
+	if old := f.Keyboard; old != nil {
+		/**
+		 * When the terminal is unfocused, it
+		 * already got leave and was deactivated.
+		 */
+		sendLeave := !f.TerminalUnfocused
+		f.toClient(old.Client, func() {
+			old.Toplevel.Activated = false
+			if !sendLeave || old.Client.GetObject(protocols.AnyObjectID(old.ToplevelID)) == nil {
+				return
+			}
+			serial := GetNextEventSerial()
+			for keyboardID := range protocols.GetGlobalWlKeyboardBinds(old.Client) {
+				protocols.WlKeyboard_leave(old.Client, keyboardID, serial, old.SurfaceID)
+			}
+			old.Toplevel.sendConfigure(old.Client, old.ToplevelID, old.XdgSurface)
+		})
+	}
+	f.Keyboard = toplevel
+	if toplevel == nil {
+		f.updateTextInputFocus()
+		return
+	}
+	activated := !f.TerminalUnfocused
+	f.toClient(toplevel.Client, func() {
+		toplevel.Toplevel.Activated = activated
+		if toplevel.Client.GetObject(protocols.AnyObjectID(toplevel.ToplevelID)) == nil {
+			return
+		}
+		if activated {
+			for keyboardID := range protocols.GetGlobalWlKeyboardBinds(toplevel.Client) {
+				f.sendKeyboardEnter(toplevel.Client, keyboardID, toplevel.SurfaceID)
+			}
+		}
+		if configureNew {
+			toplevel.Toplevel.sendConfigure(toplevel.Client, toplevel.ToplevelID, toplevel.XdgSurface)
+		}
+	})
+	f.updateTextInputFocus()
+}
+
+/**
+ * When the terminal loses focus the app with the
+ * keyboard gets leave and is no longer activated,
+ * when it comes back it gets both back.
+ */
+func (f *SeatFocus) SetTerminalFocused(focused bool) {
+	defer f.lockWithClients()()
+	if f.TerminalUnfocused == !focused {
+		return
+	}
+	from := f.keyboardTarget()
+	f.TerminalUnfocused = !focused
+	f.moveKeyboardFrom(from)
+	toplevel := f.Keyboard
+	if toplevel == nil || toplevel.Client.Status != ClientStatus_Connected {
+		return
+	}
+	f.toClient(toplevel.Client, func() {
+		toplevel.Toplevel.Activated = focused
+		toplevel.Toplevel.sendConfigure(toplevel.Client, toplevel.ToplevelID, toplevel.XdgSurface)
+	})
+}
+
+func (f *SeatFocus) TerminalFocused() bool {
+	f.Access.Lock()
+	defer f.Access.Unlock()
+	return !f.TerminalUnfocused
+}
+
+func (f *SeatFocus) toplevelWithSurface(client *Client, surfaceID protocols.ObjectID[protocols.WlSurface]) *ToplevelRef {
+	for _, t := range f.Toplevels {
+		if t.Client == client && t.SurfaceID == surfaceID {
+			return t
+		}
+	}
+	return nil
+}
+
+func (f *SeatFocus) activate(toplevel *ToplevelRef) {
+	index := slices.Index(f.Toplevels, toplevel)
+	if index == -1 {
+		return
+	}
+	f.Toplevels = append(slices.Delete(f.Toplevels, index, index+1), toplevel)
+	f.raiseChildren(toplevel)
+	/**
+	 * The keyboard goes to the top of the stack,
+	 * which is a dialog if it has one.
+	 */
+	f.setKeyboardFocus(f.Toplevels[len(f.Toplevels)-1], true)
+}
+
+/**
+ * New toplevels get the keyboard focus
+ */
+func (f *SeatFocus) ToplevelMapped(toplevel *ToplevelRef) {
+	defer f.lockFromClient(toplevel.Client)()
+	f.mappedCount++
+	toplevel.MappedOrder = f.mappedCount
+	f.Toplevels = append(f.Toplevels, toplevel)
+	f.setKeyboardFocus(toplevel, false)
+}
+
+/**
+ * Give the keyboard focus back to the
+ * previously active toplevel.
+ */
+func (f *SeatFocus) ToplevelUnmapped(client *Client, toplevelID protocols.ObjectID[protocols.XdgToplevel]) {
+	defer f.lockFromClient(client)()
+	f.Toplevels = slices.DeleteFunc(f.Toplevels, func(t *ToplevelRef) bool {
+		return (t.Client == client && t.ToplevelID == toplevelID) ||
+			t.Client.Status != ClientStatus_Connected
+	})
+	if f.Keyboard == nil || f.Keyboard.Client != client || f.Keyboard.ToplevelID != toplevelID {
+		return
+	}
+	/**
+	 * The client knows its surface is gone,
+	 * so don't send leave.
+	 */
+	f.Keyboard = nil
+	if len(f.Toplevels) > 0 {
+		f.setKeyboardFocus(f.Toplevels[len(f.Toplevels)-1], true)
+		return
+	}
+	f.updateTextInputFocus()
+}
+
+/**
+ * The client is gone, maybe without destroying its
+ * toplevels (ie it crashed). Forget everything of it,
+ * and give the keyboard to the previously active toplevel.
+ * No client is locked, the other clients get their
+ * events once they are.
+ */
+func (f *SeatFocus) ClientDisconnected(client *Client) {
+	f.Access.Lock()
+	defer f.Access.Unlock()
+	var topGrab *PopupGrab
+	if len(f.Grabs) > 0 {
+		topGrab = f.Grabs[len(f.Grabs)-1]
+	}
+	f.Toplevels = slices.DeleteFunc(f.Toplevels, func(t *ToplevelRef) bool {
+		return t.Client == client
+	})
+	f.Grabs = slices.DeleteFunc(f.Grabs, func(g *PopupGrab) bool {
+		return g.Client == client
+	})
+	f.TextInputs = slices.DeleteFunc(f.TextInputs, func(t *TextInputRef) bool {
+		return t.Client == client
+	})
+	if f.Pointer != nil && f.Pointer.Client == client {
+		f.Pointer = nil
+	}
+	if f.Keyboard == nil || f.Keyboard.Client != client {
+		if topGrab != nil && topGrab.Client == client {
+			/**
+			 * Its menu had the keyboard, the
+			 * keyboard goes back under it.
+			 */
+			f.moveKeyboardFrom(&keyboardTarget{Client: client, SurfaceID: topGrab.SurfaceID})
+		}
+		return
+	}
+	f.Keyboard = nil
+	if len(f.Toplevels) > 0 {
+		f.setKeyboardFocus(f.Toplevels[len(f.Toplevels)-1], true)
+		return
+	}
+	f.updateTextInputFocus()
+}
+
+/**
+ * A client asked for a new wl_keyboard,
+ * if it already has focus, it needs to know.
+ */
+func (f *SeatFocus) AfterGetKeyboard(client *Client, keyboardID protocols.ObjectID[protocols.WlKeyboard]) {
+	defer f.lockFromClient(client)()
+	target := f.keyboardTarget()
+	if target == nil || target.Client != client {
+		return
+	}
+	f.sendKeyboardEnter(client, keyboardID, target.SurfaceID)
+}
+
+func (f *SeatFocus) AfterGetPointer(client *Client, pointerID protocols.ObjectID[protocols.WlPointer], version uint32) {
+	defer f.lockFromClient(client)()
+	focus := f.Pointer
+	if focus == nil || focus.Client != client {
+		return
+	}
+	protocols.WlPointer_enter(client, pointerID, GetNextEventSerial(), focus.SurfaceID, Pointer.WindowX-float32(focus.X), Pointer.WindowY-float32(focus.Y))
+	protocols.WlPointer_frame(client, version, pointerID)
+}
@@ -21,3 +21,9 @@ var Global_WlDataDevice = Global_WlSeat
 var Global_WlTouch = MakeWlTouch()
 
 var Global_ZxdgDecorationManagerV1 = MakeZxdgDecorationManagerV1()
+
+var Global_WpViewporter = MakeWpViewporter()
+
+var Global_WpFractionalScaleManagerV1 = MakeWpFractionalScaleManagerV1()
+
+var Global_ZwpTextInputManagerV3 = MakeZwpTextInputManagerV3()
@@ -0,0 +1,116 @@
+package wayland
+
+import (
+	"bytes"
+
+	"github.com/mmulet/term.everything/wayland/protocols"
+)
+
+/**
+ * When true, surfaces draw straight from the client's
+ * shm pool instead of copying the buffer on every commit.
+ * The buffer is held (not released) until the surface
+ * gets a new one, so the client must not draw into it.
+ */
+var ZeroCopyBuffers = false
+
+/**
+ * Point the surface's texture into the pool memory of
+ * bufferID, and hold on to the buffer until it is replaced.
+ */
+func (w *WlSurface) holdBuffer(
+	s protocols.ClientState,
+	pool *WlShmPool,
+	bufferID protocols.ObjectID[protocols.WlBuffer],
+	texture *Texture,
+) {
+	if w.HeldBuffer != nil && *w.HeldBuffer != bufferID {
+		/**
+		 * texture replaces the old one,
+		 * so there is nothing to keep
+		 */
+		w.releaseReplacedBuffer(s)
+	}
+	w.HeldBuffer = &bufferID
+	w.HeldBufferPool = pool
+	w.Texture = texture
+	pool.Holders[w] = bufferID
+}
+
+/**
+ * Tell the client we are done with the buffer the
+ * texture was pointing into, and keep showing what
+ * was there (ie the surface is going away).
+ */
+func (w *WlSurface) ReleaseHeldBuffer(s protocols.ClientState) {
+	if w.HeldBuffer == nil {
+		return
+	}
+	bufferID := *w.HeldBuffer
+	w.forgetHeldBuffer()
+	if s.GetObject(protocols.AnyObjectID(bufferID)) != nil {
+		protocols.WlBuffer_release(s, bufferID)
+	}
+}
+
+/**
+ * Like ReleaseHeldBuffer without the copy, for when
+ * the caller replaces (or removes) w.Texture right after.
+ * The texture still points into the buffer until then.
+ */
+func (w *WlSurface) releaseReplacedBuffer(s protocols.ClientState) {
+	if w.HeldBuffer == nil {
+		return
+	}
+	bufferID := *w.HeldBuffer
+	if w.HeldBufferPool != nil {
+		delete(w.HeldBufferPool.Holders, w)
+	}
+	w.HeldBuffer = nil
+	w.HeldBufferPool = nil
+	if s.GetObject(protocols.AnyObjectID(bufferID)) != nil {
+		protocols.WlBuffer_release(s, bufferID)
+	}
+}
+
+/**
+ * The pool was remapped, so textures
+ * pointing into the old mapping must move.
+ */
+func (p *WlShmPool) refreshHeldTextures() {
+	memMap, ok := p.MemMaps[p.WlShmPoolObjectID]
+	for surface, bufferID := range p.Holders {
+		info, hasBuffer := p.Buffers[bufferID]
+		total := int(info.Stride) * int(info.Height)
+		offset := int(info.Offset)
+		if !ok || !hasBuffer || offset < 0 || offset+total > len(memMap.Bytes) || surface.Texture == nil {
+			surface.forgetHeldBuffer()
+			continue
+		}
+		surface.Texture.Data = memMap.Bytes[offset : offset+total]
+	}
+}
+
+/**
+ * The buffer was destroyed while we were still
+ * drawing from it, take a copy of it instead.
+ */
+func (p *WlShmPool) detachHolders(bufferID protocols.ObjectID[protocols.WlBuffer]) {
+	for surface, held := range p.Holders {
+		if held != bufferID {
+			continue
+		}
+		surface.forgetHeldBuffer()
+	}
+}
+
+func (w *WlSurface) forgetHeldBuffer() {
+	if w.HeldBufferPool != nil {
+		delete(w.HeldBufferPool.Holders, w)
+	}
+	w.HeldBuffer = nil
+	w.HeldBufferPool = nil
+	if w.Texture != nil {
+		w.Texture.Data = bytes.Clone(w.Texture.Data)
+	}
+}
@@ -2,7 +2,6 @@ package wayland
 
 import (
 	"sync"
-	"time"
 
 	"github.com/mmulet/term.everything/wayland/protocols"
 )
@@ -19,79 +18,64 @@ func GetNextEventSerial() uint32 {
 	return nextSerial
 }
 
-func getNextSerial() uint32 {
-	return GetNextEventSerial()
-}
-
-func SendPointerMotion(clients []*Client, x, y float32) {
+/**
+ * x and y are in desktop coordinates, the
+ * surface under the pointer gets them in
+ * surface local coordinates.
+ */
+func SendPointerMotion(x, y float32) {
 	// Update global pointer position for cursor drawing
 	Pointer.WindowX = x
 	Pointer.WindowY = y
 
-	timestamp := uint32(time.Now().UnixMilli())
-	for _, client := range clients {
-		if client.Status != ClientStatus_Connected {
-			continue
-		}
-		if pointerBinds := protocols.GetGlobalWlPointerBinds(client); pointerBinds != nil {
-			for pointerID, version := range pointerBinds {
-				protocols.WlPointer_motion(client, pointerID, timestamp, x, y)
-				protocols.WlPointer_frame(client, uint32(version), pointerID)
-			}
-		}
+	/**
+	 * While dragging, motion goes to the
+	 * wl_data_device instead of the wl_pointer
+	 */
+	if Selection.DragMotion(x, y) {
+		return
 	}
+	Focus.PointerMotion(x, y)
 }
 
-func SendPointerButton(clients []*Client, button uint32, pressed bool) {
-	timestamp := uint32(time.Now().UnixMilli())
-	ser := getNextSerial()
+func SendPointerButton(button uint32, pressed bool) {
+	if !pressed && Selection.Drop() {
+		return
+	}
 	state := protocols.WlPointerButtonState_enum_released
 	if pressed {
 		state = protocols.WlPointerButtonState_enum_pressed
 	}
-	for _, client := range clients {
-		if client.Status != ClientStatus_Connected {
-			continue
-		}
-		if pointerBinds := protocols.GetGlobalWlPointerBinds(client); pointerBinds != nil {
-			for pointerID, version := range pointerBinds {
-				protocols.WlPointer_button(client, pointerID, ser, timestamp, button, state)
-				protocols.WlPointer_frame(client, uint32(version), pointerID)
-			}
-		}
-	}
+	Focus.PointerButton(button, state)
 }
 
-func SendPointerAxis(clients []*Client, axis protocols.WlPointerAxis_enum, value float32) {
-	timestamp := uint32(time.Now().UnixMilli())
-	for _, client := range clients {
-		if client.Status != ClientStatus_Connected {
-			continue
-		}
-		if pointerBinds := protocols.GetGlobalWlPointerBinds(client); pointerBinds != nil {
-			for pointerID, version := range pointerBinds {
-				protocols.WlPointer_axis(client, pointerID, timestamp, axis, value)
-				protocols.WlPointer_frame(client, uint32(version), pointerID)
-			}
-		}
-	}
+func SendPointerAxis(axis protocols.WlPointerAxis_enum, value float32) {
+	Focus.PointerAxis(axis, value)
 }
 
-func SendKeyboardKey(clients []*Client, key uint32, pressed bool) {
-	timestamp := uint32(time.Now().UnixMilli())
-	ser := getNextSerial()
+func SendKeyboardKey(key uint32, pressed bool) {
 	state := protocols.WlKeyboardKeyState_enum_released
 	if pressed {
 		state = protocols.WlKeyboardKeyState_enum_pressed
 	}
-	for _, client := range clients {
-		if client.Status != ClientStatus_Connected {
-			continue
-		}
-		if keyboardBinds := protocols.GetGlobalWlKeyboardBinds(client); keyboardBinds != nil {
-			for keyboardID := range keyboardBinds {
-				protocols.WlKeyboard_key(client, keyboardID, ser, timestamp, key, state)
-			}
-		}
-	}
+	Focus.KeyboardKey(key, state)
+}
+
+/**
+ * Returns false if the focused app has no
+ * enabled zwp_text_input_v3 to take the text.
+ */
+func SendText(text string) bool {
+	return Focus.CommitText(text)
+}
+
+/**
+ * The terminal gained or lost focus
+ */
+func SetTerminalFocused(focused bool) {
+	Focus.SetTerminalFocused(focused)
+}
+
+func SendKeyboardModifiers(modifiers uint32) {
+	Focus.KeyboardModifiers(modifiers)
 }
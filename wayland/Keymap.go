@@ -0,0 +1,201 @@
+package wayland
+
+import (
+	"cmp"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+/**
+ * A key (evdev code) and the shift level that types
+ * a character: 0 plain, 1 shift, 2 AltGr, 3 shift+AltGr.
+ */
+type KeymapKey struct {
+	Key   uint32
+	Level int
+}
+
+/**
+ * Which key types each character on the keymap apps
+ * were given, nil while it is the embedded (US) keymap.
+ */
+var keymapKeys map[rune]KeymapKey
+
+/**
+ * How to type r on the keymap that apps were given.
+ * false with the default keymap, or if r is not on it.
+ */
+func KeymapKeyForRune(r rune) (KeymapKey, bool) {
+	key, ok := keymapKeys[r]
+	return key, ok
+}
+
+/**
+ * Pick the keymap sent to every wl_keyboard. name is a path
+ * to an xkb keymap file, or layouts like "de", "us(dvorak)"
+ * or "us,ru". An empty name uses XKB_DEFAULT_LAYOUT,
+ * XKB_DEFAULT_VARIANT and XKB_DEFAULT_OPTIONS, and keeps the
+ * embedded keymap if they are not set.
+ * Call before any client connects.
+ */
+func LoadKeymap(name string) error {
+	options := os.Getenv("XKB_DEFAULT_OPTIONS")
+	if name == "" {
+		layout := os.Getenv("XKB_DEFAULT_LAYOUT")
+		if layout == "" {
+			return nil
+		}
+		name = joinLayoutVariants(layout, os.Getenv("XKB_DEFAULT_VARIANT"))
+	}
+
+	var keymap string
+	var symbols xkbSymbols
+	if info, err := os.Stat(name); err == nil && info.Mode().IsRegular() {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		keymap = string(data)
+		start := strings.Index(keymap, "xkb_symbols")
+		open := -1
+		if start != -1 {
+			open = strings.Index(keymap[start:], "{")
+		}
+		if open == -1 {
+			return fmt.Errorf("%s has no xkb_symbols", name)
+		}
+		body, _ := xkbBlock(keymap, start+open)
+		if symbols, err = xkbParseSymbols(body, 0); err != nil {
+			return err
+		}
+	} else {
+		include := keymapSymbolsInclude(name, options)
+		if symbols, err = xkbResolveInclude(include, 0); err != nil {
+			return err
+		}
+		/**
+		 * The app's libxkbcommon resolves the includes
+		 * with the same xkb data we just read.
+		 */
+		keymap = fmt.Sprintf(`xkb_keymap {
+	xkb_keycodes  { include "evdev+aliases(qwerty)" };
+	xkb_types     { include "complete" };
+	xkb_compat    { include "complete" };
+	xkb_symbols   { include "%s" };
+};
+`, include)
+	}
+
+	keycodes := xkbKeycodes(keymap)
+	if len(keycodes) == 0 {
+		keycodes = xkbKeycodes(string(xkbKeymapData))
+	}
+	if err := Global_WlKeyboard.Delegate.(*WlKeyboard).SetKeymap([]byte(keymap)); err != nil {
+		return err
+	}
+	keymapKeys = reverseKeymap(symbols, keycodes)
+	return nil
+}
+
+/**
+ * "us,de" and ",nodeadkeys" to "us,de(nodeadkeys)"
+ */
+func joinLayoutVariants(layouts string, variants string) string {
+	variantList := strings.Split(variants, ",")
+	out := make([]string, 0)
+	for i, layout := range strings.Split(layouts, ",") {
+		layout = strings.TrimSpace(layout)
+		if i < len(variantList) && strings.TrimSpace(variantList[i]) != "" {
+			layout += "(" + strings.TrimSpace(variantList[i]) + ")"
+		}
+		out = append(out, layout)
+	}
+	return strings.Join(out, ",")
+}
+
+/**
+ * Like the evdev rules: "us,ru" with options
+ * "ctrl:nocaps" is "pc+us+ru:2+inet(evdev)+ctrl(nocaps)"
+ */
+func keymapSymbolsInclude(layouts string, options string) string {
+	include := "pc"
+	for i, layout := range strings.Split(layouts, ",") {
+		layout = strings.TrimSpace(layout)
+		if layout == "" {
+			continue
+		}
+		include += "+" + layout
+		if i > 0 {
+			include += fmt.Sprintf(":%d", i+1)
+		}
+	}
+	include += "+inet(evdev)"
+	optionSymbols := xkbOptionSymbols()
+	for _, option := range strings.Split(options, ",") {
+		include += optionSymbols[strings.TrimSpace(option)]
+	}
+	return include
+}
+
+/**
+ * The "! option = symbols" part of the evdev rules, ie
+ * "ctrl:nocaps" to "+ctrl(nocaps)". Options that are
+ * not in it don't change the symbols.
+ */
+func xkbOptionSymbols() map[string]string {
+	options := make(map[string]string)
+	data, err := os.ReadFile(filepath.Join(xkbConfigRoot(), "rules", "evdev"))
+	if err != nil {
+		return options
+	}
+	inSection := false
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) > 0 && fields[0] == "!" {
+			inSection = strings.Join(fields, " ") == "! option = symbols"
+			continue
+		}
+		if inSection && len(fields) == 3 && fields[1] == "=" {
+			options[fields[0]] = fields[2]
+		}
+	}
+	return options
+}
+
+/**
+ * Character to key, preferring the lowest level
+ * and then the lowest key code. The keypad is
+ * skipped so digits come from the number row.
+ */
+func reverseKeymap(symbols xkbSymbols, keycodes map[string]uint32) map[rune]KeymapKey {
+	names := make([]string, 0, len(symbols))
+	for name := range symbols {
+		if _, ok := keycodes[name]; ok && !strings.HasPrefix(name, "KP") {
+			names = append(names, name)
+		}
+	}
+	slices.SortFunc(names, func(a, b string) int {
+		return cmp.Compare(keycodes[a], keycodes[b])
+	})
+	keys := make(map[rune]KeymapKey)
+	for level := range 4 {
+		for _, name := range names {
+			levels := symbols[name]
+			if level >= len(levels) {
+				continue
+			}
+			r, ok := xkbKeysymRune(levels[level])
+			if !ok {
+				continue
+			}
+			if _, have := keys[r]; have {
+				continue
+			}
+			keys[r] = KeymapKey{Key: keycodes[name], Level: level}
+		}
+	}
+	return keys
+}
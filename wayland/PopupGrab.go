@@ -0,0 +1,165 @@
+package wayland
+
+import (
+	"slices"
+
+	"github.com/mmulet/term.everything/wayland/protocols"
+)
+
+/**
+ * KEY_ESC from linux/input-event-codes.h
+ */
+const evdevKeyEsc = 1
+
+/**
+ * A popup that asked for an explicit grab (ie a menu).
+ * While it is open it gets the keyboard, and clicking
+ * anywhere else closes it.
+ */
+type PopupGrab struct {
+	Client    *Client
+	PopupID   protocols.ObjectID[protocols.XdgPopup]
+	SurfaceID protocols.ObjectID[protocols.WlSurface]
+	/**
+	 * The parent's surface, nested menus
+	 * have another grabbing popup as parent.
+	 */
+	ParentSurfaceID protocols.ObjectID[protocols.WlSurface]
+}
+
+/**
+ * Where keyboard events go
+ */
+type keyboardTarget struct {
+	Client    *Client
+	SurfaceID protocols.ObjectID[protocols.WlSurface]
+}
+
+/**
+ * The topmost grabbing popup, or the active toplevel.
+ * nil while the terminal is unfocused.
+ */
+func (f *SeatFocus) keyboardTarget() *keyboardTarget {
+	if f.TerminalUnfocused {
+		return nil
+	}
+	for i := len(f.Grabs) - 1; i >= 0; i-- {
+		grab := f.Grabs[i]
+		if grab.Client.Status != ClientStatus_Connected {
+			continue
+		}
+		return &keyboardTarget{Client: grab.Client, SurfaceID: grab.SurfaceID}
+	}
+	if f.Keyboard == nil || f.Keyboard.Client.Status != ClientStatus_Connected {
+		return nil
+	}
+	return &keyboardTarget{Client: f.Keyboard.Client, SurfaceID: f.Keyboard.SurfaceID}
+}
+
+/**
+ * Send leave to from, and enter to wherever
+ * the keyboard should be now.
+ */
+func (f *SeatFocus) moveKeyboardFrom(from *keyboardTarget) {
+	to := f.keyboardTarget()
+	if from != nil && to != nil && *from == *to {
+		return
+	}
+	defer f.updateTextInputFocus()
+	if from != nil {
+		f.toClient(from.Client, func() {
+			if from.Client.GetObject(protocols.AnyObjectID(from.SurfaceID)) == nil {
+				return
+			}
+			serial := GetNextEventSerial()
+			for keyboardID := range protocols.GetGlobalWlKeyboardBinds(from.Client) {
+				protocols.WlKeyboard_leave(from.Client, keyboardID, serial, from.SurfaceID)
+			}
+		})
+	}
+	if to == nil {
+		return
+	}
+	f.toClient(to.Client, func() {
+		for keyboardID := range protocols.GetGlobalWlKeyboardBinds(to.Client) {
+			f.sendKeyboardEnter(to.Client, keyboardID, to.SurfaceID)
+		}
+	})
+}
+
+/**
+ * Called from xdg_popup.grab. The popup has to be on top
+ * of the current grabs (ie a submenu of the open menu),
+ * otherwise the open menus are closed first.
+ */
+func (f *SeatFocus) PopupGrabbed(grab *PopupGrab) {
+	defer f.lockFromClient(grab.Client)()
+	if len(f.Grabs) > 0 {
+		top := f.Grabs[len(f.Grabs)-1]
+		if top.Client != grab.Client || top.SurfaceID != grab.ParentSurfaceID {
+			f.dismissPopups()
+		}
+	}
+	from := f.keyboardTarget()
+	f.Grabs = append(f.Grabs, grab)
+	f.moveKeyboardFrom(from)
+}
+
+/**
+ * The client destroyed the popup, it (and
+ * any popups above it) no longer grab.
+ */
+func (f *SeatFocus) PopupDestroyed(client *Client, popupID protocols.ObjectID[protocols.XdgPopup]) {
+	defer f.lockFromClient(client)()
+	index := slices.IndexFunc(f.Grabs, func(g *PopupGrab) bool {
+		return g.Client == client && g.PopupID == popupID
+	})
+	if index == -1 {
+		return
+	}
+	from := f.keyboardTarget()
+	for i := len(f.Grabs) - 1; i > index; i-- {
+		f.sendPopupDone(f.Grabs[i])
+	}
+	f.Grabs = f.Grabs[:index]
+	f.moveKeyboardFrom(from)
+}
+
+func (f *SeatFocus) sendPopupDone(grab *PopupGrab) {
+	f.toClient(grab.Client, func() {
+		if grab.Client.GetObject(protocols.AnyObjectID(grab.PopupID)) == nil {
+			return
+		}
+		protocols.XdgPopup_popup_done(grab.Client, grab.PopupID)
+	})
+}
+
+/**
+ * Close every grabbing popup, topmost first.
+ */
+func (f *SeatFocus) dismissPopups() {
+	if len(f.Grabs) == 0 {
+		return
+	}
+	from := f.keyboardTarget()
+	for i := len(f.Grabs) - 1; i >= 0; i-- {
+		f.sendPopupDone(f.Grabs[i])
+	}
+	f.Grabs = nil
+	f.moveKeyboardFrom(from)
+}
+
+/**
+ * Is the surface part of a grabbing popup
+ */
+func (f *SeatFocus) insideGrab(surface *SurfaceOnScreen) bool {
+	if surface == nil {
+		return false
+	}
+	for _, grab := range f.Grabs {
+		if grab.Client == surface.Client && grab.SurfaceID == surface.Popup {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,447 @@
+package wayland
+
+import (
+	"io"
+	"os"
+	"slices"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/mmulet/term.everything/wayland/protocols"
+)
+
+/**
+ * Mime types we will offer when the selection
+ * comes from the host terminal, and the ones
+ * we will ask for (in order of preference) when
+ * copying a client's selection to the host terminal.
+ */
+var TextMimeTypes = []string{
+	"text/plain;charset=utf-8",
+	"UTF8_STRING",
+	"text/plain",
+	"TEXT",
+	"STRING",
+}
+
+/**
+ * Where the contents of a selection (or a drag) come from.
+ * Either a wl_data_source of a client, or text that
+ * the host terminal gave us (ie from a bracketed paste).
+ */
+type SelectionSource struct {
+	/**
+	 * nil means the host terminal owns the selection
+	 */
+	Client    *Client
+	SourceID  protocols.ObjectID[protocols.WlDataSource]
+	Version   uint32
+	MimeTypes []string
+	Actions   protocols.WlDataDeviceManagerDndAction_enum
+
+	HostData []byte
+}
+
+func (src *SelectionSource) IsHost() bool {
+	return src.Client == nil
+}
+
+func (src *SelectionSource) clientConnected() bool {
+	return src.Client != nil && src.Client.Status == ClientStatus_Connected
+}
+
+/**
+ * Ask the source to write mime_type into fd.
+ * Takes ownership of fd.
+ */
+func (src *SelectionSource) Send(mimeType string, fd protocols.FileDescriptor) {
+	if src.IsHost() {
+		go func() {
+			f := os.NewFile(uintptr(fd), "selection")
+			defer f.Close()
+			_, _ = f.Write(src.HostData)
+		}()
+		return
+	}
+	if !src.clientConnected() {
+		_ = syscall.Close(int(fd))
+		return
+	}
+	protocols.WlDataSource_send(closeFileDescriptorAfterSend{src.Client}, src.SourceID, mimeType, fd)
+}
+
+/**
+ * Read the contents of the selection as text.
+ * Blocks until the source client closes its end of the
+ * pipe, so call this from its own goroutine.
+ */
+func (src *SelectionSource) ReadText(timeout time.Duration) ([]byte, bool) {
+	if src.IsHost() {
+		return src.HostData, true
+	}
+	mimeType := ""
+	for _, m := range TextMimeTypes {
+		if slices.Contains(src.MimeTypes, m) {
+			mimeType = m
+			break
+		}
+	}
+	if mimeType == "" {
+		return nil, false
+	}
+
+	var fds [2]int
+	if err := syscall.Pipe2(fds[:], syscall.O_CLOEXEC); err != nil {
+		return nil, false
+	}
+	/**
+	 * Only our end is non blocking, so that
+	 * the read can have a deadline.
+	 */
+	if err := syscall.SetNonblock(fds[0], true); err != nil {
+		syscall.Close(fds[0])
+		syscall.Close(fds[1])
+		return nil, false
+	}
+	r := os.NewFile(uintptr(fds[0]), "selection-read")
+	defer r.Close()
+
+	src.Send(mimeType, protocols.FileDescriptor(fds[1]))
+
+	_ = r.SetReadDeadline(time.Now().Add(timeout))
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, false
+	}
+	return data, true
+}
+
+type closeFileDescriptorAfterSend struct {
+	protocols.Sender
+}
+
+func (c closeFileDescriptorAfterSend) Send(ev protocols.OutgoingEvent) {
+	ev.CloseFileDescriptorAfterSend = true
+	c.Sender.Send(ev)
+}
+
+type DataDeviceBinding struct {
+	ID      protocols.ObjectID[protocols.WlDataDevice]
+	Version uint32
+}
+
+type DragState struct {
+	Source *SelectionSource
+	/**
+	 * The client that started the drag
+	 */
+	Client *Client
+	Origin protocols.ObjectID[protocols.WlSurface]
+	Icon   *protocols.ObjectID[protocols.WlSurface]
+
+	/**
+	 * The surface under the pointer that has received
+	 * wl_data_device.enter, it can be any client's.
+	 */
+	Target  *SurfaceOnScreen
+	OfferID *protocols.ObjectID[protocols.WlDataOffer]
+	Offer   *WlDataOffer
+
+	Dropped bool
+}
+
+/**
+ * The seat's selection (aka the clipboard)
+ * and any drag and drop in progress.
+ */
+type SeatSelection struct {
+	Access sync.Mutex
+
+	Current *SelectionSource
+
+	DataDevices map[*Client][]DataDeviceBinding
+
+	Drag *DragState
+
+	/**
+	 * Text that a client copied, ready to
+	 * be forwarded to the host terminal.
+	 */
+	CopiedText chan []byte
+}
+
+var Selection = SeatSelection{
+	DataDevices: make(map[*Client][]DataDeviceBinding),
+	CopiedText:  make(chan []byte, 8),
+}
+
+func (sel *SeatSelection) AddDataDevice(client *Client, id protocols.ObjectID[protocols.WlDataDevice], version uint32) {
+	sel.Access.Lock()
+	defer sel.Access.Unlock()
+	sel.DataDevices[client] = append(sel.DataDevices[client], DataDeviceBinding{ID: id, Version: version})
+	if sel.Current != nil {
+		sel.sendSelection(client, DataDeviceBinding{ID: id, Version: version})
+	}
+}
+
+func (sel *SeatSelection) RemoveDataDevice(client *Client, id protocols.ObjectID[protocols.WlDataDevice]) {
+	sel.Access.Lock()
+	defer sel.Access.Unlock()
+	sel.DataDevices[client] = slices.DeleteFunc(sel.DataDevices[client], func(d DataDeviceBinding) bool {
+		return d.ID == id
+	})
+	if len(sel.DataDevices[client]) == 0 {
+		delete(sel.DataDevices, client)
+	}
+}
+
+/**
+ * Replace the current selection, cancel the old one
+ * and tell everyone about it. nil clears the selection.
+ */
+func (sel *SeatSelection) Set(src *SelectionSource) {
+	sel.Access.Lock()
+	defer sel.Access.Unlock()
+
+	if old := sel.Current; old != nil && old != src && old.clientConnected() {
+		protocols.WlDataSource_cancelled(old.Client, old.SourceID)
+	}
+	sel.Current = src
+	sel.broadcastSelection()
+
+	if src == nil || src.IsHost() {
+		return
+	}
+	go func() {
+		text, ok := src.ReadText(2 * time.Second)
+		if !ok || len(text) == 0 {
+			return
+		}
+		select {
+		case sel.CopiedText <- text:
+		default:
+		}
+	}()
+}
+
+func (sel *SeatSelection) SetHostText(text []byte) {
+	sel.Set(&SelectionSource{
+		MimeTypes: TextMimeTypes,
+		HostData:  text,
+	})
+}
+
+/**
+ * Called when a client destroys its wl_data_source
+ */
+func (sel *SeatSelection) SourceDestroyed(client *Client, id protocols.ObjectID[protocols.WlDataSource]) {
+	sel.Access.Lock()
+	defer sel.Access.Unlock()
+	if sel.Drag != nil && sel.Drag.Source != nil && sel.Drag.Source.Client == client && sel.Drag.Source.SourceID == id {
+		sel.endDrag()
+	}
+	if sel.Current == nil || sel.Current.Client != client || sel.Current.SourceID != id {
+		return
+	}
+	sel.Current = nil
+	sel.broadcastSelection()
+}
+
+func (sel *SeatSelection) broadcastSelection() {
+	for client, devices := range sel.DataDevices {
+		if client.Status != ClientStatus_Connected {
+			delete(sel.DataDevices, client)
+			continue
+		}
+		for _, device := range devices {
+			sel.sendSelection(client, device)
+		}
+	}
+}
+
+func (sel *SeatSelection) sendSelection(client *Client, device DataDeviceBinding) {
+	if sel.Current == nil {
+		protocols.WlDataDevice_selection(client, device.ID, nil)
+		return
+	}
+	offerID, _ := sel.makeOffer(client, device, sel.Current, false)
+	protocols.WlDataDevice_selection(client, device.ID, &offerID)
+}
+
+func (sel *SeatSelection) makeOffer(client *Client, device DataDeviceBinding, src *SelectionSource, dnd bool) (protocols.ObjectID[protocols.WlDataOffer], *WlDataOffer) {
+	offerID := protocols.ObjectID[protocols.WlDataOffer](client.NextServerObjectID())
+	offer := MakeWlDataOffer(src, device.Version, dnd)
+	client.AddServerObject(protocols.AnyObjectID(offerID), offer)
+
+	protocols.WlDataDevice_data_offer(client, device.ID, offerID)
+	for _, mimeType := range src.MimeTypes {
+		protocols.WlDataOffer_offer(client, offerID, mimeType)
+	}
+	return offerID, offer.Delegate.(*WlDataOffer)
+}
+
+/**
+ * Drag and drop
+ */
+
+func (sel *SeatSelection) StartDrag(drag *DragState, x, y float32) {
+	/**
+	 * The pointer is over the origin, from the first
+	 * motion on the drag goes to whatever is under it.
+	 */
+	origin := Focus.DrawnSurface(drag.Client, drag.Origin)
+	if origin == nil {
+		origin = &SurfaceOnScreen{Client: drag.Client, SurfaceID: drag.Origin}
+	}
+	sel.Access.Lock()
+	defer sel.Access.Unlock()
+	if sel.Drag != nil {
+		sel.endDrag()
+	}
+	sel.Drag = drag
+	sel.enterDragTarget(origin, x, y)
+}
+
+/**
+ * x and y are in desktop coordinates
+ */
+func (sel *SeatSelection) enterDragTarget(target *SurfaceOnScreen, x, y float32) {
+	drag := sel.Drag
+	/**
+	 * Drags without a source are only
+	 * meant for the client that started them,
+	 * so they don't get an offer.
+	 */
+	if target == nil || (drag.Source == nil && target.Client != drag.Client) {
+		return
+	}
+	serial := GetNextEventSerial()
+	for _, device := range sel.DataDevices[target.Client] {
+		var offerID *protocols.ObjectID[protocols.WlDataOffer]
+		if drag.Source != nil {
+			id, offer := sel.makeOffer(target.Client, device, drag.Source, true)
+			offerID = &id
+			drag.OfferID = offerID
+			drag.Offer = offer
+			protocols.WlDataOffer_source_actions(target.Client, device.Version, id, drag.Source.Actions)
+		}
+		protocols.WlDataDevice_enter(target.Client, device.ID, serial, target.SurfaceID, x-float32(target.X), y-float32(target.Y), offerID)
+	}
+	drag.Target = target
+}
+
+func (sel *SeatSelection) leaveDragTarget() {
+	drag := sel.Drag
+	if drag.Target != nil && drag.Target.Client.Status == ClientStatus_Connected {
+		for _, device := range sel.DataDevices[drag.Target.Client] {
+			protocols.WlDataDevice_leave(drag.Target.Client, device.ID)
+		}
+	}
+	drag.Target = nil
+	drag.OfferID = nil
+	drag.Offer = nil
+}
+
+/**
+ * Returns true if the motion was consumed by the drag.
+ * Call with the clients locked.
+ */
+func (sel *SeatSelection) DragMotion(x, y float32) bool {
+	target := Focus.SurfaceAt(x, y)
+	sel.Access.Lock()
+	defer sel.Access.Unlock()
+	drag := sel.Drag
+	if drag == nil || drag.Dropped {
+		return false
+	}
+	if drag.Client.Status != ClientStatus_Connected {
+		sel.Drag = nil
+		return false
+	}
+	if !target.isSame(drag.Target) {
+		sel.leaveDragTarget()
+		sel.enterDragTarget(target, x, y)
+		return true
+	}
+	if target == nil {
+		return true
+	}
+	/**
+	 * It may have moved
+	 */
+	drag.Target.X = target.X
+	drag.Target.Y = target.Y
+	timestamp := uint32(time.Now().UnixMilli())
+	for _, device := range sel.DataDevices[target.Client] {
+		protocols.WlDataDevice_motion(target.Client, device.ID, timestamp, x-float32(target.X), y-float32(target.Y))
+	}
+	return true
+}
+
+/**
+ * Called when the pointer button is released during a drag.
+ * Returns true if the release was consumed by the drag.
+ */
+func (sel *SeatSelection) Drop() bool {
+	sel.Access.Lock()
+	defer sel.Access.Unlock()
+	drag := sel.Drag
+	if drag == nil || drag.Dropped {
+		return false
+	}
+	accepted := drag.Target != nil &&
+		drag.Target.Client.Status == ClientStatus_Connected &&
+		(drag.Source == nil ||
+			(drag.Offer != nil && drag.Offer.AcceptedMimeType != "" && drag.Offer.Action != protocols.WlDataDeviceManagerDndAction_enum_none))
+	if !accepted {
+		if drag.Source != nil && drag.Source.clientConnected() {
+			protocols.WlDataSource_cancelled(drag.Source.Client, drag.Source.SourceID)
+		}
+		sel.endDrag()
+		return true
+	}
+	for _, device := range sel.DataDevices[drag.Target.Client] {
+		protocols.WlDataDevice_drop(drag.Target.Client, device.ID)
+	}
+	if drag.Source == nil {
+		sel.endDrag()
+		return true
+	}
+	drag.Dropped = true
+	if drag.Source.clientConnected() {
+		protocols.WlDataSource_dnd_drop_performed(drag.Source.Client, drag.Source.Version, drag.Source.SourceID)
+	}
+	return true
+}
+
+/**
+ * Called when the drop target calls wl_data_offer.finish
+ */
+func (sel *SeatSelection) DragFinished(offer *WlDataOffer) {
+	sel.Access.Lock()
+	defer sel.Access.Unlock()
+	drag := sel.Drag
+	if drag == nil || drag.Offer != offer {
+		return
+	}
+	if drag.Source != nil && drag.Source.clientConnected() {
+		protocols.WlDataSource_dnd_finished(drag.Source.Client, drag.Source.Version, drag.Source.SourceID)
+	}
+	sel.endDrag()
+}
+
+func (sel *SeatSelection) endDrag() {
+	drag := sel.Drag
+	if drag == nil {
+		return
+	}
+	sel.leaveDragTarget()
+	sel.Drag = nil
+}
+
+func (sel *SeatSelection) DragInProgress() bool {
+	sel.Access.Lock()
+	defer sel.Access.Unlock()
+	return sel.Drag != nil
+}
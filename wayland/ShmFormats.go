@@ -0,0 +1,133 @@
+package wayland
+
+import (
+	"encoding/binary"
+
+	"github.com/mmulet/term.everything/wayland/protocols"
+)
+
+/**
+ * Sent to every client in wl_shm.format. argb8888 and
+ * xrgb8888 are required by the protocol, the rest are
+ * converted to argb8888 (the desktop's format) on commit.
+ */
+var SupportedShmFormats = []protocols.WlShmFormat_enum{
+	protocols.WlShmFormat_enum_argb8888,
+	protocols.WlShmFormat_enum_xrgb8888,
+	protocols.WlShmFormat_enum_abgr8888,
+	protocols.WlShmFormat_enum_xbgr8888,
+	protocols.WlShmFormat_enum_rgb565,
+	protocols.WlShmFormat_enum_argb2101010,
+	protocols.WlShmFormat_enum_xrgb2101010,
+	protocols.WlShmFormat_enum_abgr2101010,
+	protocols.WlShmFormat_enum_xbgr2101010,
+}
+
+func ShmFormatSupported(format protocols.WlShmFormat_enum) bool {
+	for _, supported := range SupportedShmFormats {
+		if supported == format {
+			return true
+		}
+	}
+	return false
+}
+
+func ShmFormatBytesPerPixel(format protocols.WlShmFormat_enum) int {
+	if format == protocols.WlShmFormat_enum_rgb565 {
+		return 2
+	}
+	return 4
+}
+
+/**
+ * 10 bits to 8 bits
+ */
+func channel10(v uint32) byte {
+	return byte((v & 0x3ff) >> 2)
+}
+
+/**
+ * 2 bits of alpha to 8 bits
+ */
+func alpha2(v uint32) byte {
+	return byte(v&0x3) * 0x55
+}
+
+/**
+ * Convert a buffer to the desktop's pixel format, argb8888 (BGRA in memory).
+ * dst is tightly packed (width * 4 bytes per row). All the formats
+ * are little endian, so (ie) xbgr8888 is R G B X in memory.
+ * The x formats get an opaque alpha, otherwise whatever was
+ * in the padding byte would show through.
+ */
+func ConvertShmToBGRA(
+	dst []byte,
+	src []byte,
+	width int,
+	height int,
+	srcStride int,
+	format protocols.WlShmFormat_enum,
+) {
+	bytesPerPixel := ShmFormatBytesPerPixel(format)
+	for y := range height {
+		srcRow := src[y*srcStride : y*srcStride+width*bytesPerPixel]
+		dstRow := dst[y*width*4 : (y+1)*width*4]
+		switch format {
+		case protocols.WlShmFormat_enum_argb8888:
+			copy(dstRow, srcRow)
+		case protocols.WlShmFormat_enum_xrgb8888:
+			copy(dstRow, srcRow)
+			for i := 3; i < len(dstRow); i += 4 {
+				dstRow[i] = 0xff
+			}
+		case protocols.WlShmFormat_enum_abgr8888,
+			protocols.WlShmFormat_enum_xbgr8888:
+			opaque := format == protocols.WlShmFormat_enum_xbgr8888
+			for i := 0; i+3 < len(srcRow); i += 4 {
+				dstRow[i] = srcRow[i+2]
+				dstRow[i+1] = srcRow[i+1]
+				dstRow[i+2] = srcRow[i]
+				dstRow[i+3] = srcRow[i+3]
+				if opaque {
+					dstRow[i+3] = 0xff
+				}
+			}
+		case protocols.WlShmFormat_enum_rgb565:
+			for x := range width {
+				v := binary.LittleEndian.Uint16(srcRow[x*2:])
+				r := byte(v>>11) & 0x1f
+				g := byte(v>>5) & 0x3f
+				b := byte(v) & 0x1f
+				dstRow[x*4] = b<<3 | b>>2
+				dstRow[x*4+1] = g<<2 | g>>4
+				dstRow[x*4+2] = r<<3 | r>>2
+				dstRow[x*4+3] = 0xff
+			}
+		case protocols.WlShmFormat_enum_argb2101010,
+			protocols.WlShmFormat_enum_xrgb2101010,
+			protocols.WlShmFormat_enum_abgr2101010,
+			protocols.WlShmFormat_enum_xbgr2101010:
+			redFirst := format == protocols.WlShmFormat_enum_argb2101010 ||
+				format == protocols.WlShmFormat_enum_xrgb2101010
+			opaque := format == protocols.WlShmFormat_enum_xrgb2101010 ||
+				format == protocols.WlShmFormat_enum_xbgr2101010
+			for x := range width {
+				v := binary.LittleEndian.Uint32(srcRow[x*4:])
+				high := channel10(v >> 20)
+				low := channel10(v)
+				if redFirst {
+					dstRow[x*4] = low
+					dstRow[x*4+2] = high
+				} else {
+					dstRow[x*4] = high
+					dstRow[x*4+2] = low
+				}
+				dstRow[x*4+1] = channel10(v >> 10)
+				dstRow[x*4+3] = 0xff
+				if !opaque {
+					dstRow[x*4+3] = alpha2(v >> 30)
+				}
+			}
+		}
+	}
+}
@@ -14,6 +14,12 @@ type SurfaceUpdate struct {
 	BufferTransform *protocols.WlOutputTransform_enum
 
 	InputRegion *protocols.ObjectID[protocols.WlRegion]
+	/**
+	 * set_input_region can set the region to nil (infinite),
+	 * so we need to know if it was called at all.
+	 */
+	InputRegionSet   bool
+	InputRegionShape *Region
 
 	OpaqueRegion *protocols.ObjectID[protocols.WlRegion]
 
@@ -42,6 +48,16 @@ type SurfaceUpdate struct {
 	ZOrderSubsurfaces []ZOrderSubsurface
 
 	XwaylandSurfarfaceV1Serial *XWaylandSurfaceV1Serial
+
+	/**
+	 * wp_viewport, like the input region these
+	 * can be unset, so the Set bools say if
+	 * they were changed at all.
+	 */
+	ViewportSourceSet      bool
+	ViewportSource         *ViewportSource
+	ViewportDestinationSet bool
+	ViewportDestination    *ViewportDestination
 }
 
 type Point struct {
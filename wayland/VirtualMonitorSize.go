@@ -1,5 +1,7 @@
 package wayland
 
+import "github.com/mmulet/term.everything/wayland/protocols"
+
 type Pixels int
 
 type PixelSize struct {
@@ -11,3 +13,37 @@ var VirtualMonitorSize = PixelSize{
 	Width:  640,
 	Height: 480,
 }
+
+/**
+ * Change the size of the virtual monitor and tell
+ * every client about it. Maximized toplevels get a new
+ * configure, so they will resize to fill the monitor.
+ * Call with all the clients locked.
+ */
+func ResizeVirtualMonitor(clients []*Client, size PixelSize) {
+	VirtualMonitorSize = size
+	for _, client := range clients {
+		if client.Status != ClientStatus_Connected {
+			continue
+		}
+		for outputID, version := range protocols.GetGlobalWlOutputBinds(client) {
+			sendOutputMode(client, outputID)
+			protocols.WlOutput_done(client, uint32(version), outputID)
+		}
+		for toplevelID, isToplevel := range client.TopLevelSurfaces() {
+			if !isToplevel {
+				continue
+			}
+			toplevel := GetXdgToplevelObject(client, toplevelID)
+			surface := GetSurfaceFromRole(client, toplevelID)
+			if toplevel == nil || surface == nil || surface.XdgSurfaceState == nil {
+				continue
+			}
+			xdgSurface := GetXdgSurfaceObject(client, *surface.XdgSurfaceState)
+			if xdgSurface == nil {
+				continue
+			}
+			toplevel.sendConfigure(client, toplevelID, xdgSurface)
+		}
+	}
+}
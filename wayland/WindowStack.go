@@ -0,0 +1,170 @@
+package wayland
+
+import (
+	"cmp"
+	"image"
+	"image/draw"
+	"slices"
+
+	"github.com/mmulet/term.everything/wayland/protocols"
+)
+
+/**
+ * A toplevel, as shown in the window list
+ */
+type WindowInfo struct {
+	/**
+	 * Unique for as long as we run, ToplevelRef.MappedOrder
+	 */
+	ID         uint64
+	Client     *Client
+	ToplevelID protocols.ObjectID[protocols.XdgToplevel]
+	SurfaceID  protocols.ObjectID[protocols.WlSurface]
+	/**
+	 * The title, or the app_id if there is no title
+	 */
+	Title  string
+	AppID  string
+	Active bool
+}
+
+/**
+ * Every toplevel, in the order they were mapped
+ * (so that the window list doesn't jump around).
+ * Call with the clients locked.
+ */
+func (f *SeatFocus) Windows() []WindowInfo {
+	f.Access.Lock()
+	defer f.Access.Unlock()
+	mapped := slices.Clone(f.Toplevels)
+	slices.SortFunc(mapped, func(a, b *ToplevelRef) int {
+		return cmp.Compare(a.MappedOrder, b.MappedOrder)
+	})
+	windows := make([]WindowInfo, 0, len(mapped))
+	for _, t := range mapped {
+		if t.Client.Status != ClientStatus_Connected {
+			continue
+		}
+		title := t.Toplevel.AppID
+		if t.Toplevel.Title != nil && *t.Toplevel.Title != "" {
+			title = *t.Toplevel.Title
+		}
+		windows = append(windows, WindowInfo{
+			ID:         t.MappedOrder,
+			Client:     t.Client,
+			ToplevelID: t.ToplevelID,
+			SurfaceID:  t.SurfaceID,
+			Title:      title,
+			AppID:      t.Toplevel.AppID,
+			Active:     t.isSame(f.Keyboard),
+		})
+	}
+	return windows
+}
+
+/**
+ * Raise and focus a toplevel
+ */
+func (f *SeatFocus) ActivateWindow(client *Client, toplevelID protocols.ObjectID[protocols.XdgToplevel]) {
+	defer f.lockWithClients()()
+	for _, t := range f.Toplevels {
+		if t.Client == client && t.ToplevelID == toplevelID {
+			f.activate(t)
+			return
+		}
+	}
+}
+
+/**
+ * Like alt+tab. forward activates the window at the
+ * bottom of the stack, backwards sends the active
+ * window to the bottom.
+ */
+func (f *SeatFocus) CycleWindows(forward bool) {
+	defer f.lockWithClients()()
+	if len(f.Toplevels) < 2 {
+		return
+	}
+	if forward {
+		f.activate(f.Toplevels[0])
+		return
+	}
+	top := f.Toplevels[len(f.Toplevels)-1]
+	f.Toplevels = append([]*ToplevelRef{top}, f.Toplevels[:len(f.Toplevels)-1]...)
+	f.setKeyboardFocus(f.Toplevels[len(f.Toplevels)-1], true)
+}
+
+/**
+ * Dialogs (toplevels with a parent) stay
+ * above their parent when it is raised.
+ */
+func (f *SeatFocus) raiseChildren(parent *ToplevelRef) {
+	for _, t := range slices.Clone(f.Toplevels) {
+		if t.Client != parent.Client || t.Toplevel.Parent == nil || *t.Toplevel.Parent != parent.ToplevelID {
+			continue
+		}
+		index := slices.Index(f.Toplevels, t)
+		f.Toplevels = append(slices.Delete(f.Toplevels, index, index+1), t)
+		f.raiseChildren(t)
+	}
+}
+
+/**
+ * Where each toplevel's surface is in the stack,
+ * 0 is the bottom.
+ */
+func (f *SeatFocus) stackingOrder() map[clientSurfaceID]int {
+	f.Access.Lock()
+	defer f.Access.Unlock()
+	order := make(map[clientSurfaceID]int, len(f.Toplevels))
+	for i, t := range f.Toplevels {
+		order[clientSurfaceID{t.Client, t.SurfaceID}] = i
+	}
+	return order
+}
+
+/**
+ * The active toplevel with its subsurfaces and open
+ * popups, as drawn last frame, at desktop scale.
+ * The pixels are BGRA like the desktop. nil if there
+ * is no window. Call with the clients locked.
+ */
+func (f *SeatFocus) ActiveWindowImage() *image.RGBA {
+	f.Access.Lock()
+	defer f.Access.Unlock()
+	if len(f.Toplevels) == 0 {
+		return nil
+	}
+	active := f.Toplevels[len(f.Toplevels)-1]
+	type layer struct {
+		Src    *image.RGBA
+		Origin image.Point
+	}
+	layers := make([]layer, 0)
+	bounds := image.Rectangle{}
+	/**
+	 * SurfaceStack is already in draw order
+	 */
+	for _, it := range f.SurfaceStack {
+		if it.Client != active.Client || it.Root != active.SurfaceID {
+			continue
+		}
+		src := it.Surface.SurfaceImage(DesktopScale)
+		if src == nil {
+			continue
+		}
+		origin := image.Pt(scalePixels(int(it.X), DesktopScale), scalePixels(int(it.Y), DesktopScale))
+		layers = append(layers, layer{Src: src, Origin: origin})
+		bounds = bounds.Union(src.Bounds().Sub(src.Bounds().Min).Add(origin))
+	}
+	if bounds.Empty() {
+		return nil
+	}
+	out := image.NewRGBA(bounds.Sub(bounds.Min))
+	for _, it := range layers {
+		b := it.Src.Bounds()
+		r := b.Sub(b.Min).Add(it.Origin.Sub(bounds.Min))
+		draw.Draw(out, r, it.Src, b.Min, draw.Over)
+	}
+	return out
+}
@@ -0,0 +1,405 @@
+package wayland
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+/**
+ * Just enough of the xkb symbols format to know which
+ * key (and level) types a character. The app compiles
+ * the real keymap with libxkbcommon, this only follows
+ * includes and reads the symbols of the first group.
+ */
+
+/**
+ * Key name (ie AD01) to the keysym names of
+ * each level of the first group
+ */
+type xkbSymbols map[string][]string
+
+type xkbMergeMode int
+
+const (
+	xkbMergeOverride xkbMergeMode = iota
+	xkbMergeAugment
+)
+
+/**
+ * Where the xkb data files are, XKB_CONFIG_ROOT
+ * like libxkbcommon.
+ */
+func xkbConfigRoot() string {
+	if root := os.Getenv("XKB_CONFIG_ROOT"); root != "" {
+		return root
+	}
+	return "/usr/share/X11/xkb"
+}
+
+func (s xkbSymbols) merge(other xkbSymbols, mode xkbMergeMode) {
+	for name, levels := range other {
+		current := s[name]
+		for len(current) < len(levels) {
+			current = append(current, "")
+		}
+		for i, level := range levels {
+			if level == "" || level == "NoSymbol" {
+				continue
+			}
+			if mode == xkbMergeAugment && current[i] != "" {
+				continue
+			}
+			current[i] = level
+		}
+		s[name] = current
+	}
+}
+
+var xkbCommentRegex = regexp.MustCompile(`(?s)//[^\n]*|/\*.*?\*/`)
+
+var xkbSectionRegex = regexp.MustCompile(`((?:\w+\s+)*)xkb_symbols\s+"([^"]*)"\s*\{`)
+
+var xkbStatementRegex = regexp.MustCompile(
+	`(include|augment|override|replace)\s+"([^"]*)"|(?:(override|augment|replace)\s+)?key\s+<([^>]+)>\s*\{`,
+)
+
+var xkbGroup1SymbolsRegex = regexp.MustCompile(`(?i)symbols\[\s*(?:group)?1\s*\]\s*=\s*\[([^\]]*)\]`)
+
+var xkbBareSymbolsRegex = regexp.MustCompile(`(?:^|[{,])\s*\[([^\]]*)\]`)
+
+/**
+ * From the opening brace at open, the text up to its closing brace
+ */
+func xkbBlock(text string, open int) (string, int) {
+	depth := 0
+	for i := open; i < len(text); i++ {
+		switch text[i] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				return text[open+1 : i], i + 1
+			}
+		}
+	}
+	return text[open+1:], len(text)
+}
+
+/**
+ * The body of the section of an xkb_symbols file,
+ * the default one if section is empty.
+ */
+func xkbSection(text string, section string) (string, bool) {
+	matches := xkbSectionRegex.FindAllStringSubmatchIndex(text, -1)
+	if len(matches) == 0 {
+		return "", false
+	}
+	chosen := -1
+	for i, m := range matches {
+		flags := strings.Fields(text[m[2]:m[3]])
+		name := text[m[4]:m[5]]
+		if section == "" && chosen == -1 {
+			chosen = i
+		}
+		if section == "" && strings.Contains(strings.Join(flags, " "), "default") {
+			chosen = i
+			break
+		}
+		if section != "" && name == section {
+			chosen = i
+			break
+		}
+	}
+	if chosen == -1 {
+		return "", false
+	}
+	body, _ := xkbBlock(text, matches[chosen][1]-1)
+	return body, true
+}
+
+/**
+ * The levels of the first group of a key statement,
+ * ie `type[Group1]="ALPHABETIC", symbols[Group1]=[ a, A ]` or `[ 1, exclam ]`
+ */
+func xkbKeyLevels(block string) []string {
+	var list string
+	if m := xkbGroup1SymbolsRegex.FindStringSubmatch(block); m != nil {
+		list = m[1]
+	} else if strings.Contains(block, "symbols[") {
+		return nil
+	} else if m := xkbBareSymbolsRegex.FindStringSubmatch("{" + block); m != nil {
+		list = m[1]
+	} else {
+		return nil
+	}
+	levels := make([]string, 0, 4)
+	for _, level := range strings.Split(list, ",") {
+		levels = append(levels, strings.TrimSpace(level))
+	}
+	return levels
+}
+
+/**
+ * Resolve a symbols include string like "pc+de(nodeadkeys)+inet(evdev)".
+ * Parts after | augment instead of override, parts
+ * for another group (ie "ru:2") are skipped.
+ */
+func xkbResolveInclude(include string, depth int) (xkbSymbols, error) {
+	if depth > 16 {
+		return nil, fmt.Errorf("xkb include loop at %q", include)
+	}
+	symbols := make(xkbSymbols)
+	mode := xkbMergeOverride
+	for len(include) > 0 {
+		end := strings.IndexAny(include, "+|")
+		if end == -1 {
+			end = len(include)
+		}
+		part := include[:end]
+		if part != "" {
+			group := ""
+			if colon := strings.Index(part, ":"); colon != -1 {
+				part, group = part[:colon], part[colon+1:]
+			}
+			if group == "" || group == "1" {
+				file, section := part, ""
+				if open := strings.Index(part, "("); open != -1 && strings.HasSuffix(part, ")") {
+					file, section = part[:open], part[open+1:len(part)-1]
+				}
+				included, err := xkbSymbolsFromFile(file, section, depth+1)
+				if err != nil {
+					return nil, err
+				}
+				symbols.merge(included, mode)
+			}
+		}
+		if end == len(include) {
+			break
+		}
+		mode = xkbMergeOverride
+		if include[end] == '|' {
+			mode = xkbMergeAugment
+		}
+		include = include[end+1:]
+	}
+	return symbols, nil
+}
+
+func xkbSymbolsFromFile(file string, section string, depth int) (xkbSymbols, error) {
+	if strings.Contains(file, "..") || strings.ContainsRune(file, '/') {
+		return nil, fmt.Errorf("bad xkb symbols file %q", file)
+	}
+	data, err := os.ReadFile(filepath.Join(xkbConfigRoot(), "symbols", file))
+	if err != nil {
+		return nil, fmt.Errorf("no xkb symbols for %q: %w", file, err)
+	}
+	body, ok := xkbSection(string(data), section)
+	if !ok {
+		return nil, fmt.Errorf("no section %q in xkb symbols %q", section, file)
+	}
+	return xkbParseSymbols(body, depth)
+}
+
+/**
+ * The statements inside of an xkb_symbols { } block
+ */
+func xkbParseSymbols(body string, depth int) (xkbSymbols, error) {
+	body = xkbCommentRegex.ReplaceAllString(body, "")
+	symbols := make(xkbSymbols)
+	position := 0
+	for {
+		m := xkbStatementRegex.FindStringSubmatchIndex(body[position:])
+		if m == nil {
+			return symbols, nil
+		}
+		for i := range m {
+			if m[i] != -1 {
+				m[i] += position
+			}
+		}
+		if m[2] != -1 {
+			mode := xkbMergeOverride
+			if body[m[2]:m[3]] == "augment" {
+				mode = xkbMergeAugment
+			}
+			included, err := xkbResolveInclude(body[m[4]:m[5]], depth)
+			if err != nil {
+				return nil, err
+			}
+			symbols.merge(included, mode)
+			position = m[1]
+			continue
+		}
+		mode := xkbMergeOverride
+		if m[6] != -1 && body[m[6]:m[7]] == "augment" {
+			mode = xkbMergeAugment
+		}
+		block, end := xkbBlock(body, m[1]-1)
+		position = end
+		if levels := xkbKeyLevels(block); levels != nil {
+			symbols.merge(xkbSymbols{body[m[8]:m[9]]: levels}, mode)
+		}
+	}
+}
+
+var xkbKeycodeRegex = regexp.MustCompile(`<([^>]+)>\s*=\s*(\d+)\s*;`)
+
+var xkbAliasRegex = regexp.MustCompile(`alias\s+<([^>]+)>\s*=\s*<([^>]+)>\s*;`)
+
+/**
+ * Key name to evdev key code, from the xkb_keycodes
+ * section of a compiled keymap (xkb key codes are 8 more).
+ */
+func xkbKeycodes(keymap string) map[string]uint32 {
+	start := strings.Index(keymap, "xkb_keycodes")
+	if start == -1 {
+		return nil
+	}
+	open := strings.Index(keymap[start:], "{")
+	if open == -1 {
+		return nil
+	}
+	body, _ := xkbBlock(keymap, start+open)
+	keycodes := make(map[string]uint32)
+	for _, m := range xkbKeycodeRegex.FindAllStringSubmatch(body, -1) {
+		code, err := strconv.Atoi(m[2])
+		if err != nil || code < 8 {
+			continue
+		}
+		keycodes[m[1]] = uint32(code - 8)
+	}
+	for _, m := range xkbAliasRegex.FindAllStringSubmatch(body, -1) {
+		if code, ok := keycodes[m[2]]; ok {
+			keycodes[m[1]] = code
+		}
+	}
+	return keycodes
+}
+
+/**
+ * The character a keysym types, if any. Handles single
+ * characters, Unicode keysyms (U20AC or 0x10020ac) and
+ * the named ones for ASCII and Latin-1 (and a few more).
+ */
+func xkbKeysymRune(name string) (rune, bool) {
+	if len(name) == 1 && name[0] > ' ' && name[0] < 0x7f {
+		return rune(name[0]), true
+	}
+	if r, ok := xkbKeysymNames[name]; ok {
+		return r, true
+	}
+	if len(name) > 1 && name[0] == 'U' {
+		if v, err := strconv.ParseUint(name[1:], 16, 32); err == nil {
+			return rune(v), true
+		}
+	}
+	if strings.HasPrefix(name, "0x") {
+		v, err := strconv.ParseUint(name[2:], 16, 32)
+		if err != nil {
+			return 0, false
+		}
+		if v >= 0x1000000 {
+			return rune(v - 0x1000000), true
+		}
+		if v >= 0x20 && v <= 0xff && v != 0x7f {
+			return rune(v), true
+		}
+	}
+	return 0, false
+}
+
+/**
+ * Latin-1 keysyms are the same as their code point,
+ * in order from 0xa0.
+ */
+var xkbLatin1KeysymNames = []string{
+	"nobreakspace", "exclamdown", "cent", "sterling", "currency", "yen", "brokenbar", "section",
+	"diaeresis", "copyright", "ordfeminine", "guillemotleft", "notsign", "hyphen", "registered", "macron",
+	"degree", "plusminus", "twosuperior", "threesuperior", "acute", "mu", "paragraph", "periodcentered",
+	"cedilla", "onesuperior", "masculine", "guillemotright", "onequarter", "onehalf", "threequarters", "questiondown",
+	"Agrave", "Aacute", "Acircumflex", "Atilde", "Adiaeresis", "Aring", "AE", "Ccedilla",
+	"Egrave", "Eacute", "Ecircumflex", "Ediaeresis", "Igrave", "Iacute", "Icircumflex", "Idiaeresis",
+	"ETH", "Ntilde", "Ograve", "Oacute", "Ocircumflex", "Otilde", "Odiaeresis", "multiply",
+	"Oslash", "Ugrave", "Uacute", "Ucircumflex", "Udiaeresis", "Yacute", "THORN", "ssharp",
+	"agrave", "aacute", "acircumflex", "atilde", "adiaeresis", "aring", "ae", "ccedilla",
+	"egrave", "eacute", "ecircumflex", "ediaeresis", "igrave", "iacute", "icircumflex", "idiaeresis",
+	"eth", "ntilde", "ograve", "oacute", "ocircumflex", "otilde", "odiaeresis", "division",
+	"oslash", "ugrave", "uacute", "ucircumflex", "udiaeresis", "yacute", "thorn", "ydiaeresis",
+}
+
+var xkbKeysymNames = func() map[string]rune {
+	names := map[string]rune{
+		"space":        ' ',
+		"exclam":       '!',
+		"quotedbl":     '"',
+		"numbersign":   '#',
+		"dollar":       '$',
+		"percent":      '%',
+		"ampersand":    '&',
+		"apostrophe":   '\'',
+		"quoteright":   '\'',
+		"parenleft":    '(',
+		"parenright":   ')',
+		"asterisk":     '*',
+		"plus":         '+',
+		"comma":        ',',
+		"minus":        '-',
+		"period":       '.',
+		"slash":        '/',
+		"colon":        ':',
+		"semicolon":    ';',
+		"less":         '<',
+		"equal":        '=',
+		"greater":      '>',
+		"question":     '?',
+		"at":           '@',
+		"bracketleft":  '[',
+		"backslash":    '\\',
+		"bracketright": ']',
+		"asciicircum":  '^',
+		"underscore":   '_',
+		"grave":        '`',
+		"quoteleft":    '`',
+		"braceleft":    '{',
+		"bar":          '|',
+		"braceright":   '}',
+		"asciitilde":   '~',
+
+		"Ooblique":       0xd8,
+		"ooblique":       0xf8,
+		"Eth":            0xd0,
+		"Thorn":          0xde,
+		"guillemetleft":  0xab,
+		"guillemetright": 0xbb,
+		"ordmasculine":   0xba,
+
+		"OE":                   0x152,
+		"oe":                   0x153,
+		"Ydiaeresis":           0x178,
+		"Scaron":               0x160,
+		"scaron":               0x161,
+		"Zcaron":               0x17d,
+		"zcaron":               0x17e,
+		"Ccaron":               0x10c,
+		"ccaron":               0x10d,
+		"Lstroke":              0x141,
+		"lstroke":              0x142,
+		"EuroSign":             0x20ac,
+		"endash":               0x2013,
+		"emdash":               0x2014,
+		"leftsinglequotemark":  0x2018,
+		"rightsinglequotemark": 0x2019,
+		"leftdoublequotemark":  0x201c,
+		"rightdoublequotemark": 0x201d,
+		"ellipsis":             0x2026,
+	}
+	for i, name := range xkbLatin1KeysymNames {
+		names[name] = rune(0xa0 + i)
+	}
+	return names
+}()
@@ -1,3 +1,3 @@
 package wayland
 
-//go:generate sh -c "go run ./generate ./protocols . $(go list) WlSurface XdgPositioner XdgSurface WlPointer WlSubsurface XdgToplevel"
+//go:generate sh -c "go run ./generate ./protocols . $(go list) WlSurface XdgPositioner XdgSurface WlPointer WlSubsurface XdgToplevel WlRegion XdgPopup"
@@ -1,3 +1,4 @@
+#define _GNU_SOURCE
 #include <fcntl.h>
 #include <sys/mman.h>
 #include <unistd.h>
@@ -54,4 +55,38 @@ void* remap(int fd, void* addr, size_t size, size_t new_size) {
 
 void* map_failed(void) {
 	return MAP_FAILED;
+}
+
+/**
+ * A read only copy of data that can be shared with clients,
+ * they can't change it or its size. Returns -1 on failure.
+ */
+int sealed_memfd(const char *name, const void *data, size_t size)
+{
+    int fd = memfd_create(name, MFD_CLOEXEC | MFD_ALLOW_SEALING);
+    if (fd == -1)
+    {
+        perror("memfd_create");
+        return -1;
+    }
+    const char *bytes = data;
+    size_t written = 0;
+    while (written < size)
+    {
+        ssize_t n = write(fd, bytes + written, size - written);
+        if (n <= 0)
+        {
+            perror("write in sealed_memfd");
+            close(fd);
+            return -1;
+        }
+        written += n;
+    }
+    if (fcntl(fd, F_ADD_SEALS, F_SEAL_SHRINK | F_SEAL_GROW | F_SEAL_WRITE | F_SEAL_SEAL) == -1)
+    {
+        perror("fcntl F_ADD_SEALS");
+        close(fd);
+        return -1;
+    }
+    return fd;
 }
\ No newline at end of file
@@ -5,4 +5,5 @@
 void *mmap_fd(int fd, size_t size);
 bool unmap(void* addr, size_t size);
 void* remap(int fd, void* addr, size_t size, size_t new_size);
-void* map_failed(void);
\ No newline at end of file
+void* map_failed(void);
+int sealed_memfd(const char *name, const void *data, size_t size);
\ No newline at end of file
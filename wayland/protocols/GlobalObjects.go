@@ -19,6 +19,9 @@ const (
 	GlobalID_WlDataDevice                     GlobalID = 0xff00012
 	GlobalID_WlTouch                          GlobalID = 0xff00013
 	GlobalID_ZxdgDecorationManagerV1          GlobalID = 0xff00014
+	GlobalID_WpViewporter                     GlobalID = 0xff00015
+	GlobalID_WpFractionalScaleManagerV1       GlobalID = 0xff00016
+	GlobalID_ZwpTextInputManagerV3            GlobalID = 0xff00017
 )
 
 type AdvertisedGlobalObjectName struct {
@@ -46,6 +49,9 @@ var AdvertisedGlobalObjectNames = []AdvertisedGlobalObjectName{
 	{"xdg_wm_base", GlobalID_XdgWmBase, 6},
 	{"wl_data_device_manager", GlobalID_WlDataDeviceManager, 3},
 	{"zxdg_decoration_manager_v1", GlobalID_ZxdgDecorationManagerV1, 1},
+	{"wp_viewporter", GlobalID_WpViewporter, 1},
+	{"wp_fractional_scale_manager_v1", GlobalID_WpFractionalScaleManagerV1, 1},
+	{"zwp_text_input_manager_v3", GlobalID_ZwpTextInputManagerV3, 1},
 	/**
 	 * @TODO only advertise these to Xwayland clients
 	 */
@@ -202,3 +208,13 @@ func GetGlobalZxdgDecorationManagerV1Binds(cs ClientState) map[ObjectID[ZxdgDeco
 	m := v.(map[ObjectID[ZxdgDecorationManagerV1]]Version)
 	return m
 }
+
+func GetGlobalWpViewporterBinds(cs ClientState) map[ObjectID[WpViewporter]]Version {
+
+	v := cs.GetGlobalBinds(GlobalID(GlobalID_WpViewporter))
+	if v == nil {
+		return nil
+	}
+	m := v.(map[ObjectID[WpViewporter]]Version)
+	return m
+}
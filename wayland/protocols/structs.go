@@ -47,6 +47,8 @@ type ClientState interface {
 	FindDescendantSurface(ObjectID[WlSurface], ObjectID[WlSurface]) bool
 
 	GetGlobalBinds(GlobalID) any
+
+	NextServerObjectID() AnyObjectID
 	// AddGlobalBind(GlobalID, AnyObjectID, Version)
 
 	AddGlobalWlShmBind(ObjectID[WlShm], Version)
@@ -73,6 +75,13 @@ type OutgoingEvent struct {
 	Opcode         uint16
 	Data           []byte
 	FileDescriptor *FileDescriptor
+	/**
+	 * Set when the file descriptor belongs to the
+	 * compositor and should be closed once it has
+	 * been handed to the client (ie a pipe end
+	 * for a data transfer).
+	 */
+	CloseFileDescriptorAfterSend bool
 }
 
 type FileDescriptorClaimClientState interface {
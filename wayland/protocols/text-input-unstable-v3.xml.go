@@ -0,0 +1,395 @@
+// Code generated by `cmd/protocols`; DO NOT EDIT.
+
+package protocols
+
+import "fmt"
+
+type ZwpTextInputV3_delegate interface {
+	ZwpTextInputV3_destroy(s ClientState, object_id ObjectID[ZwpTextInputV3]) bool
+	ZwpTextInputV3_enable(s ClientState, object_id ObjectID[ZwpTextInputV3])
+	ZwpTextInputV3_disable(s ClientState, object_id ObjectID[ZwpTextInputV3])
+	ZwpTextInputV3_set_surrounding_text(s ClientState, object_id ObjectID[ZwpTextInputV3], text string, cursor int32, anchor int32)
+	ZwpTextInputV3_set_text_change_cause(s ClientState, object_id ObjectID[ZwpTextInputV3], cause ZwpTextInputV3ChangeCause_enum)
+	ZwpTextInputV3_set_content_type(s ClientState, object_id ObjectID[ZwpTextInputV3], hint ZwpTextInputV3ContentHint_enum, purpose ZwpTextInputV3ContentPurpose_enum)
+	ZwpTextInputV3_set_cursor_rectangle(s ClientState, object_id ObjectID[ZwpTextInputV3], x int32, y int32, width int32, height int32)
+	ZwpTextInputV3_commit(s ClientState, object_id ObjectID[ZwpTextInputV3])
+	OnBind(s ClientState, name AnyObjectID, interface_ string, new_id AnyObjectID, version_number uint32)
+}
+
+type ZwpTextInputV3 struct {
+	Delegate ZwpTextInputV3_delegate
+}
+
+func (p *ZwpTextInputV3) GetDelegate() ZwpTextInputV3_delegate {
+	return p.Delegate
+}
+func (p *ZwpTextInputV3) GetBindable() OnBindable {
+	return p.Delegate
+}
+
+func ZwpTextInputV3_enter(s Sender, eventObjectID ObjectID[ZwpTextInputV3], surface ObjectID[WlSurface]) {
+	data := make([]byte, 0)
+	putUint32 := func(v uint32) { data = append(data, byte(v), byte(v>>8), byte(v>>16), byte(v>>24)) }
+	var fileDescriptor *FileDescriptor
+	putUint32(uint32(surface))
+	obj := OutgoingEvent{
+		ObjectID:       AnyObjectID(eventObjectID),
+		Opcode:         0,
+		Data:           data,
+		FileDescriptor: fileDescriptor,
+	}
+	s.Send(obj)
+}
+
+func ZwpTextInputV3_leave(s Sender, eventObjectID ObjectID[ZwpTextInputV3], surface ObjectID[WlSurface]) {
+	data := make([]byte, 0)
+	putUint32 := func(v uint32) { data = append(data, byte(v), byte(v>>8), byte(v>>16), byte(v>>24)) }
+	var fileDescriptor *FileDescriptor
+	putUint32(uint32(surface))
+	obj := OutgoingEvent{
+		ObjectID:       AnyObjectID(eventObjectID),
+		Opcode:         1,
+		Data:           data,
+		FileDescriptor: fileDescriptor,
+	}
+	s.Send(obj)
+}
+
+func ZwpTextInputV3_preedit_string(s Sender, eventObjectID ObjectID[ZwpTextInputV3], text string, cursor_begin int32, cursor_end int32) {
+	data := make([]byte, 0)
+	putUint32 := func(v uint32) { data = append(data, byte(v), byte(v>>8), byte(v>>16), byte(v>>24)) }
+	putInt32 := func(v int32) { putUint32(uint32(v)) }
+	var fileDescriptor *FileDescriptor
+	{
+		b := []byte(text)
+		total := len(b) + 1 // include null terminator
+		putUint32(uint32(total))
+		data = append(data, b...)
+		data = append(data, 0)
+		if pad := (4 - (total % 4)) % 4; pad != 0 {
+			data = append(data, make([]byte, pad)...)
+		}
+	}
+	putInt32(int32(cursor_begin))
+	putInt32(int32(cursor_end))
+	obj := OutgoingEvent{
+		ObjectID:       AnyObjectID(eventObjectID),
+		Opcode:         2,
+		Data:           data,
+		FileDescriptor: fileDescriptor,
+	}
+	s.Send(obj)
+}
+
+func ZwpTextInputV3_commit_string(s Sender, eventObjectID ObjectID[ZwpTextInputV3], text string) {
+	data := make([]byte, 0)
+	putUint32 := func(v uint32) { data = append(data, byte(v), byte(v>>8), byte(v>>16), byte(v>>24)) }
+	var fileDescriptor *FileDescriptor
+	{
+		b := []byte(text)
+		total := len(b) + 1 // include null terminator
+		putUint32(uint32(total))
+		data = append(data, b...)
+		data = append(data, 0)
+		if pad := (4 - (total % 4)) % 4; pad != 0 {
+			data = append(data, make([]byte, pad)...)
+		}
+	}
+	obj := OutgoingEvent{
+		ObjectID:       AnyObjectID(eventObjectID),
+		Opcode:         3,
+		Data:           data,
+		FileDescriptor: fileDescriptor,
+	}
+	s.Send(obj)
+}
+
+func ZwpTextInputV3_delete_surrounding_text(s Sender, eventObjectID ObjectID[ZwpTextInputV3], before_length uint32, after_length uint32) {
+	data := make([]byte, 0)
+	putUint32 := func(v uint32) { data = append(data, byte(v), byte(v>>8), byte(v>>16), byte(v>>24)) }
+	var fileDescriptor *FileDescriptor
+	putUint32(uint32(before_length))
+	putUint32(uint32(after_length))
+	obj := OutgoingEvent{
+		ObjectID:       AnyObjectID(eventObjectID),
+		Opcode:         4,
+		Data:           data,
+		FileDescriptor: fileDescriptor,
+	}
+	s.Send(obj)
+}
+
+func ZwpTextInputV3_done(s Sender, eventObjectID ObjectID[ZwpTextInputV3], serial uint32) {
+	data := make([]byte, 0)
+	putUint32 := func(v uint32) { data = append(data, byte(v), byte(v>>8), byte(v>>16), byte(v>>24)) }
+	var fileDescriptor *FileDescriptor
+	putUint32(uint32(serial))
+	obj := OutgoingEvent{
+		ObjectID:       AnyObjectID(eventObjectID),
+		Opcode:         5,
+		Data:           data,
+		FileDescriptor: fileDescriptor,
+	}
+	s.Send(obj)
+}
+
+func (p *ZwpTextInputV3) OnRequest(s FileDescriptorClaimClientState, message Message) {
+	_data_in_offset__ := 0
+	_ = _data_in_offset__
+	d := p.Delegate
+	switch message.Opcode {
+	case 0:
+		{
+
+			if DebugRequests {
+				fmt.Print("ZwpTextInputV3@", message.ObjectID, ".destroy(")
+				fmt.Println(")")
+			}
+
+			autoRemove := d.ZwpTextInputV3_destroy(s, ObjectID[ZwpTextInputV3](message.ObjectID))
+			if autoRemove {
+				s.RemoveObject(message.ObjectID)
+			}
+			break
+		}
+
+	case 1:
+		{
+
+			if DebugRequests {
+				fmt.Print("ZwpTextInputV3@", message.ObjectID, ".enable(")
+				fmt.Println(")")
+			}
+
+			d.ZwpTextInputV3_enable(s, ObjectID[ZwpTextInputV3](message.ObjectID))
+			break
+		}
+
+	case 2:
+		{
+
+			if DebugRequests {
+				fmt.Print("ZwpTextInputV3@", message.ObjectID, ".disable(")
+				fmt.Println(")")
+			}
+
+			d.ZwpTextInputV3_disable(s, ObjectID[ZwpTextInputV3](message.ObjectID))
+			break
+		}
+
+	case 3:
+		{
+
+			textLen := int(uint32(message.Data[_data_in_offset__+0]) | uint32(message.Data[_data_in_offset__+1])<<8 |
+				uint32(message.Data[_data_in_offset__+2])<<16 | uint32(message.Data[_data_in_offset__+3])<<24)
+			_data_in_offset__ += 4
+			text := string(message.Data[_data_in_offset__ : _data_in_offset__+textLen-1]) // NUL-terminated
+			// 4-byte alignment
+			if textLen%4 != 0 {
+				_data_in_offset__ += textLen + (4 - (textLen % 4))
+			} else {
+				_data_in_offset__ += textLen
+			}
+
+			cursor := int32(uint32(message.Data[_data_in_offset__+0]) | uint32(message.Data[_data_in_offset__+1])<<8 |
+				uint32(message.Data[_data_in_offset__+2])<<16 | uint32(message.Data[_data_in_offset__+3])<<24)
+			_data_in_offset__ += 4
+
+			anchor := int32(uint32(message.Data[_data_in_offset__+0]) | uint32(message.Data[_data_in_offset__+1])<<8 |
+				uint32(message.Data[_data_in_offset__+2])<<16 | uint32(message.Data[_data_in_offset__+3])<<24)
+			_data_in_offset__ += 4
+
+			if DebugRequests {
+				fmt.Print("ZwpTextInputV3@", message.ObjectID, ".set_surrounding_text(")
+				fmt.Println("text: ", text, ", ", "cursor: ", cursor, ", ", "anchor: ", anchor, ")")
+			}
+
+			d.ZwpTextInputV3_set_surrounding_text(s, ObjectID[ZwpTextInputV3](message.ObjectID), text, cursor, anchor)
+			break
+		}
+
+	case 4:
+		{
+
+			cause := ZwpTextInputV3ChangeCause_enum(uint32(message.Data[_data_in_offset__+0]) | uint32(message.Data[_data_in_offset__+1])<<8 |
+				uint32(message.Data[_data_in_offset__+2])<<16 | uint32(message.Data[_data_in_offset__+3])<<24)
+			_data_in_offset__ += 4
+
+			if DebugRequests {
+				fmt.Print("ZwpTextInputV3@", message.ObjectID, ".set_text_change_cause(")
+				fmt.Println("cause: ", cause, ")")
+			}
+
+			d.ZwpTextInputV3_set_text_change_cause(s, ObjectID[ZwpTextInputV3](message.ObjectID), cause)
+			break
+		}
+
+	case 5:
+		{
+
+			hint := ZwpTextInputV3ContentHint_enum(uint32(message.Data[_data_in_offset__+0]) | uint32(message.Data[_data_in_offset__+1])<<8 |
+				uint32(message.Data[_data_in_offset__+2])<<16 | uint32(message.Data[_data_in_offset__+3])<<24)
+			_data_in_offset__ += 4
+
+			purpose := ZwpTextInputV3ContentPurpose_enum(uint32(message.Data[_data_in_offset__+0]) | uint32(message.Data[_data_in_offset__+1])<<8 |
+				uint32(message.Data[_data_in_offset__+2])<<16 | uint32(message.Data[_data_in_offset__+3])<<24)
+			_data_in_offset__ += 4
+
+			if DebugRequests {
+				fmt.Print("ZwpTextInputV3@", message.ObjectID, ".set_content_type(")
+				fmt.Println("hint: ", hint, ", ", "purpose: ", purpose, ")")
+			}
+
+			d.ZwpTextInputV3_set_content_type(s, ObjectID[ZwpTextInputV3](message.ObjectID), hint, purpose)
+			break
+		}
+
+	case 6:
+		{
+
+			x := int32(uint32(message.Data[_data_in_offset__+0]) | uint32(message.Data[_data_in_offset__+1])<<8 |
+				uint32(message.Data[_data_in_offset__+2])<<16 | uint32(message.Data[_data_in_offset__+3])<<24)
+			_data_in_offset__ += 4
+
+			y := int32(uint32(message.Data[_data_in_offset__+0]) | uint32(message.Data[_data_in_offset__+1])<<8 |
+				uint32(message.Data[_data_in_offset__+2])<<16 | uint32(message.Data[_data_in_offset__+3])<<24)
+			_data_in_offset__ += 4
+
+			width := int32(uint32(message.Data[_data_in_offset__+0]) | uint32(message.Data[_data_in_offset__+1])<<8 |
+				uint32(message.Data[_data_in_offset__+2])<<16 | uint32(message.Data[_data_in_offset__+3])<<24)
+			_data_in_offset__ += 4
+
+			height := int32(uint32(message.Data[_data_in_offset__+0]) | uint32(message.Data[_data_in_offset__+1])<<8 |
+				uint32(message.Data[_data_in_offset__+2])<<16 | uint32(message.Data[_data_in_offset__+3])<<24)
+			_data_in_offset__ += 4
+
+			if DebugRequests {
+				fmt.Print("ZwpTextInputV3@", message.ObjectID, ".set_cursor_rectangle(")
+				fmt.Println("x: ", x, ", ", "y: ", y, ", ", "width: ", width, ", ", "height: ", height, ")")
+			}
+
+			d.ZwpTextInputV3_set_cursor_rectangle(s, ObjectID[ZwpTextInputV3](message.ObjectID), x, y, width, height)
+			break
+		}
+
+	case 7:
+		{
+
+			if DebugRequests {
+				fmt.Print("ZwpTextInputV3@", message.ObjectID, ".commit(")
+				fmt.Println(")")
+			}
+
+			d.ZwpTextInputV3_commit(s, ObjectID[ZwpTextInputV3](message.ObjectID))
+			break
+		}
+
+	default:
+		fmt.Println("Unknown opcode on ZwpTextInputV3", message.Opcode)
+	}
+}
+
+type ZwpTextInputV3ChangeCause_enum uint32
+
+const (
+	ZwpTextInputV3ChangeCause_enum_input_method ZwpTextInputV3ChangeCause_enum = 0
+	ZwpTextInputV3ChangeCause_enum_other        ZwpTextInputV3ChangeCause_enum = 1
+)
+
+type ZwpTextInputV3ContentHint_enum uint32
+
+const (
+	ZwpTextInputV3ContentHint_enum_none                ZwpTextInputV3ContentHint_enum = 0x0
+	ZwpTextInputV3ContentHint_enum_completion          ZwpTextInputV3ContentHint_enum = 0x1
+	ZwpTextInputV3ContentHint_enum_spellcheck          ZwpTextInputV3ContentHint_enum = 0x2
+	ZwpTextInputV3ContentHint_enum_auto_capitalization ZwpTextInputV3ContentHint_enum = 0x4
+	ZwpTextInputV3ContentHint_enum_lowercase           ZwpTextInputV3ContentHint_enum = 0x8
+	ZwpTextInputV3ContentHint_enum_uppercase           ZwpTextInputV3ContentHint_enum = 0x10
+	ZwpTextInputV3ContentHint_enum_titlecase           ZwpTextInputV3ContentHint_enum = 0x20
+	ZwpTextInputV3ContentHint_enum_hidden_text         ZwpTextInputV3ContentHint_enum = 0x40
+	ZwpTextInputV3ContentHint_enum_sensitive_data      ZwpTextInputV3ContentHint_enum = 0x80
+	ZwpTextInputV3ContentHint_enum_latin               ZwpTextInputV3ContentHint_enum = 0x100
+	ZwpTextInputV3ContentHint_enum_multiline           ZwpTextInputV3ContentHint_enum = 0x200
+)
+
+type ZwpTextInputV3ContentPurpose_enum uint32
+
+const (
+	ZwpTextInputV3ContentPurpose_enum_normal   ZwpTextInputV3ContentPurpose_enum = 0
+	ZwpTextInputV3ContentPurpose_enum_alpha    ZwpTextInputV3ContentPurpose_enum = 1
+	ZwpTextInputV3ContentPurpose_enum_digits   ZwpTextInputV3ContentPurpose_enum = 2
+	ZwpTextInputV3ContentPurpose_enum_number   ZwpTextInputV3ContentPurpose_enum = 3
+	ZwpTextInputV3ContentPurpose_enum_phone    ZwpTextInputV3ContentPurpose_enum = 4
+	ZwpTextInputV3ContentPurpose_enum_url      ZwpTextInputV3ContentPurpose_enum = 5
+	ZwpTextInputV3ContentPurpose_enum_email    ZwpTextInputV3ContentPurpose_enum = 6
+	ZwpTextInputV3ContentPurpose_enum_name     ZwpTextInputV3ContentPurpose_enum = 7
+	ZwpTextInputV3ContentPurpose_enum_password ZwpTextInputV3ContentPurpose_enum = 8
+	ZwpTextInputV3ContentPurpose_enum_pin      ZwpTextInputV3ContentPurpose_enum = 9
+	ZwpTextInputV3ContentPurpose_enum_date     ZwpTextInputV3ContentPurpose_enum = 10
+	ZwpTextInputV3ContentPurpose_enum_time     ZwpTextInputV3ContentPurpose_enum = 11
+	ZwpTextInputV3ContentPurpose_enum_datetime ZwpTextInputV3ContentPurpose_enum = 12
+	ZwpTextInputV3ContentPurpose_enum_terminal ZwpTextInputV3ContentPurpose_enum = 13
+)
+
+type ZwpTextInputManagerV3_delegate interface {
+	ZwpTextInputManagerV3_destroy(s ClientState, object_id ObjectID[ZwpTextInputManagerV3]) bool
+	ZwpTextInputManagerV3_get_text_input(s ClientState, object_id ObjectID[ZwpTextInputManagerV3], id ObjectID[ZwpTextInputV3], seat ObjectID[WlSeat])
+	OnBind(s ClientState, name AnyObjectID, interface_ string, new_id AnyObjectID, version_number uint32)
+}
+
+type ZwpTextInputManagerV3 struct {
+	Delegate ZwpTextInputManagerV3_delegate
+}
+
+func (p *ZwpTextInputManagerV3) GetDelegate() ZwpTextInputManagerV3_delegate {
+	return p.Delegate
+}
+func (p *ZwpTextInputManagerV3) GetBindable() OnBindable {
+	return p.Delegate
+}
+
+func (p *ZwpTextInputManagerV3) OnRequest(s FileDescriptorClaimClientState, message Message) {
+	_data_in_offset__ := 0
+	_ = _data_in_offset__
+	d := p.Delegate
+	switch message.Opcode {
+	case 0:
+		{
+
+			if DebugRequests {
+				fmt.Print("ZwpTextInputManagerV3@", message.ObjectID, ".destroy(")
+				fmt.Println(")")
+			}
+
+			autoRemove := d.ZwpTextInputManagerV3_destroy(s, ObjectID[ZwpTextInputManagerV3](message.ObjectID))
+			if autoRemove {
+				s.RemoveObject(message.ObjectID)
+			}
+			break
+		}
+
+	case 1:
+		{
+
+			idVal := uint32(message.Data[_data_in_offset__+0]) | uint32(message.Data[_data_in_offset__+1])<<8 |
+				uint32(message.Data[_data_in_offset__+2])<<16 | uint32(message.Data[_data_in_offset__+3])<<24
+			id := ObjectID[ZwpTextInputV3](idVal)
+			_data_in_offset__ += 4
+
+			seat := ObjectID[WlSeat](uint32(message.Data[_data_in_offset__+0]) | uint32(message.Data[_data_in_offset__+1])<<8 |
+				uint32(message.Data[_data_in_offset__+2])<<16 | uint32(message.Data[_data_in_offset__+3])<<24)
+			_data_in_offset__ += 4
+
+			if DebugRequests {
+				fmt.Print("ZwpTextInputManagerV3@", message.ObjectID, ".get_text_input(")
+				fmt.Println("id: ", id, ", ", "seat: ", seat, ")")
+			}
+
+			d.ZwpTextInputManagerV3_get_text_input(s, ObjectID[ZwpTextInputManagerV3](message.ObjectID), id, seat)
+			break
+		}
+
+	default:
+		fmt.Println("Unknown opcode on ZwpTextInputManagerV3", message.Opcode)
+	}
+}
@@ -0,0 +1,178 @@
+// Code generated by `cmd/protocols`; DO NOT EDIT.
+
+package protocols
+
+import "fmt"
+
+type WpViewporter_delegate interface {
+	WpViewporter_destroy(s ClientState, object_id ObjectID[WpViewporter]) bool
+	WpViewporter_get_viewport(s ClientState, object_id ObjectID[WpViewporter], id ObjectID[WpViewport], surface ObjectID[WlSurface])
+	OnBind(s ClientState, name AnyObjectID, interface_ string, new_id AnyObjectID, version_number uint32)
+}
+
+type WpViewporter struct {
+	Delegate WpViewporter_delegate
+}
+
+func (p *WpViewporter) GetDelegate() WpViewporter_delegate {
+	return p.Delegate
+}
+func (p *WpViewporter) GetBindable() OnBindable {
+	return p.Delegate
+}
+
+func (p *WpViewporter) OnRequest(s FileDescriptorClaimClientState, message Message) {
+	_data_in_offset__ := 0
+	_ = _data_in_offset__
+	d := p.Delegate
+	switch message.Opcode {
+	case 0:
+		{
+
+			if DebugRequests {
+				fmt.Print("WpViewporter@", message.ObjectID, ".destroy(")
+				fmt.Println(")")
+			}
+
+			autoRemove := d.WpViewporter_destroy(s, ObjectID[WpViewporter](message.ObjectID))
+			if autoRemove {
+				s.RemoveObject(message.ObjectID)
+			}
+			break
+		}
+
+	case 1:
+		{
+
+			idVal := uint32(message.Data[_data_in_offset__+0]) | uint32(message.Data[_data_in_offset__+1])<<8 |
+				uint32(message.Data[_data_in_offset__+2])<<16 | uint32(message.Data[_data_in_offset__+3])<<24
+			id := ObjectID[WpViewport](idVal)
+			_data_in_offset__ += 4
+
+			surface := ObjectID[WlSurface](uint32(message.Data[_data_in_offset__+0]) | uint32(message.Data[_data_in_offset__+1])<<8 |
+				uint32(message.Data[_data_in_offset__+2])<<16 | uint32(message.Data[_data_in_offset__+3])<<24)
+			_data_in_offset__ += 4
+
+			if DebugRequests {
+				fmt.Print("WpViewporter@", message.ObjectID, ".get_viewport(")
+				fmt.Println("id: ", id, ", ", "surface: ", surface, ")")
+			}
+
+			d.WpViewporter_get_viewport(s, ObjectID[WpViewporter](message.ObjectID), id, surface)
+			break
+		}
+
+	default:
+		fmt.Println("Unknown opcode on WpViewporter", message.Opcode)
+	}
+}
+
+type WpViewporterError_enum uint32
+
+const (
+	WpViewporterError_enum_viewport_exists WpViewporterError_enum = 0
+)
+
+type WpViewport_delegate interface {
+	WpViewport_destroy(s ClientState, object_id ObjectID[WpViewport]) bool
+	WpViewport_set_source(s ClientState, object_id ObjectID[WpViewport], x Fixed, y Fixed, width Fixed, height Fixed)
+	WpViewport_set_destination(s ClientState, object_id ObjectID[WpViewport], width int32, height int32)
+	OnBind(s ClientState, name AnyObjectID, interface_ string, new_id AnyObjectID, version_number uint32)
+}
+
+type WpViewport struct {
+	Delegate WpViewport_delegate
+}
+
+func (p *WpViewport) GetDelegate() WpViewport_delegate {
+	return p.Delegate
+}
+func (p *WpViewport) GetBindable() OnBindable {
+	return p.Delegate
+}
+
+func (p *WpViewport) OnRequest(s FileDescriptorClaimClientState, message Message) {
+	_data_in_offset__ := 0
+	_ = _data_in_offset__
+	d := p.Delegate
+	switch message.Opcode {
+	case 0:
+		{
+
+			if DebugRequests {
+				fmt.Print("WpViewport@", message.ObjectID, ".destroy(")
+				fmt.Println(")")
+			}
+
+			autoRemove := d.WpViewport_destroy(s, ObjectID[WpViewport](message.ObjectID))
+			if autoRemove {
+				s.RemoveObject(message.ObjectID)
+			}
+			break
+		}
+
+	case 1:
+		{
+
+			xRaw := uint32(message.Data[_data_in_offset__+0]) | uint32(message.Data[_data_in_offset__+1])<<8 |
+				uint32(message.Data[_data_in_offset__+2])<<16 | uint32(message.Data[_data_in_offset__+3])<<24
+			x := float64(int32(xRaw)) / 256.0
+			_data_in_offset__ += 4
+
+			yRaw := uint32(message.Data[_data_in_offset__+0]) | uint32(message.Data[_data_in_offset__+1])<<8 |
+				uint32(message.Data[_data_in_offset__+2])<<16 | uint32(message.Data[_data_in_offset__+3])<<24
+			y := float64(int32(yRaw)) / 256.0
+			_data_in_offset__ += 4
+
+			widthRaw := uint32(message.Data[_data_in_offset__+0]) | uint32(message.Data[_data_in_offset__+1])<<8 |
+				uint32(message.Data[_data_in_offset__+2])<<16 | uint32(message.Data[_data_in_offset__+3])<<24
+			width := float64(int32(widthRaw)) / 256.0
+			_data_in_offset__ += 4
+
+			heightRaw := uint32(message.Data[_data_in_offset__+0]) | uint32(message.Data[_data_in_offset__+1])<<8 |
+				uint32(message.Data[_data_in_offset__+2])<<16 | uint32(message.Data[_data_in_offset__+3])<<24
+			height := float64(int32(heightRaw)) / 256.0
+			_data_in_offset__ += 4
+
+			if DebugRequests {
+				fmt.Print("WpViewport@", message.ObjectID, ".set_source(")
+				fmt.Println("x: ", x, ", ", "y: ", y, ", ", "width: ", width, ", ", "height: ", height, ")")
+			}
+
+			d.WpViewport_set_source(s, ObjectID[WpViewport](message.ObjectID), x, y, width, height)
+			break
+		}
+
+	case 2:
+		{
+
+			width := int32(uint32(message.Data[_data_in_offset__+0]) | uint32(message.Data[_data_in_offset__+1])<<8 |
+				uint32(message.Data[_data_in_offset__+2])<<16 | uint32(message.Data[_data_in_offset__+3])<<24)
+			_data_in_offset__ += 4
+
+			height := int32(uint32(message.Data[_data_in_offset__+0]) | uint32(message.Data[_data_in_offset__+1])<<8 |
+				uint32(message.Data[_data_in_offset__+2])<<16 | uint32(message.Data[_data_in_offset__+3])<<24)
+			_data_in_offset__ += 4
+
+			if DebugRequests {
+				fmt.Print("WpViewport@", message.ObjectID, ".set_destination(")
+				fmt.Println("width: ", width, ", ", "height: ", height, ")")
+			}
+
+			d.WpViewport_set_destination(s, ObjectID[WpViewport](message.ObjectID), width, height)
+			break
+		}
+
+	default:
+		fmt.Println("Unknown opcode on WpViewport", message.Opcode)
+	}
+}
+
+type WpViewportError_enum uint32
+
+const (
+	WpViewportError_enum_bad_value     WpViewportError_enum = 0
+	WpViewportError_enum_bad_size      WpViewportError_enum = 1
+	WpViewportError_enum_out_of_buffer WpViewportError_enum = 2
+	WpViewportError_enum_no_surface    WpViewportError_enum = 3
+)
@@ -4,47 +4,79 @@ import (
 	"github.com/mmulet/term.everything/wayland/protocols"
 )
 
-type wl_data_device struct {
-	Seat protocols.ObjectID[protocols.WlSeat]
+type WlDataDevice struct {
+	Seat    protocols.ObjectID[protocols.WlSeat]
+	Version uint32
 }
 
-func (w *wl_data_device) WlDataDevice_start_drag(
-	_s protocols.ClientState,
+func (w *WlDataDevice) WlDataDevice_start_drag(
+	s protocols.ClientState,
 	_object_id protocols.ObjectID[protocols.WlDataDevice],
-	_source *protocols.ObjectID[protocols.WlDataSource],
-	_origin protocols.ObjectID[protocols.WlSurface],
-	_icon *protocols.ObjectID[protocols.WlSurface],
+	source *protocols.ObjectID[protocols.WlDataSource],
+	origin protocols.ObjectID[protocols.WlSurface],
+	icon *protocols.ObjectID[protocols.WlSurface],
 	_serial uint32,
 ) {
-	/** @TODO: Implement wl_data_device_start_drag */
+	client, ok := s.(*Client)
+	if !ok {
+		return
+	}
+	drag := &DragState{
+		Client: client,
+		Origin: origin,
+		Icon:   icon,
+	}
+	if source != nil {
+		drag.Source = MakeSelectionSource(client, *source)
+		if drag.Source == nil {
+			return
+		}
+	}
+	Selection.StartDrag(drag, Pointer.WindowX, Pointer.WindowY)
 }
 
-func (w *wl_data_device) WlDataDevice_set_selection(
-	_s protocols.ClientState,
+func (w *WlDataDevice) WlDataDevice_set_selection(
+	s protocols.ClientState,
 	_object_id protocols.ObjectID[protocols.WlDataDevice],
-	_source *protocols.ObjectID[protocols.WlDataSource],
+	source *protocols.ObjectID[protocols.WlDataSource],
 	_serial uint32,
 ) {
-	/** @TODO: Implement wl_data_device_set_selection */
+	client, ok := s.(*Client)
+	if !ok {
+		return
+	}
+	if source == nil {
+		Selection.Set(nil)
+		return
+	}
+	src := MakeSelectionSource(client, *source)
+	if src == nil {
+		return
+	}
+	Selection.Set(src)
 }
 
-func (w *wl_data_device) WlDataDevice_release(
-	_s protocols.ClientState,
-	_object_id protocols.ObjectID[protocols.WlDataDevice],
+func (w *WlDataDevice) WlDataDevice_release(
+	s protocols.ClientState,
+	object_id protocols.ObjectID[protocols.WlDataDevice],
 ) bool {
+	if client, ok := s.(*Client); ok {
+		Selection.RemoveDataDevice(client, object_id)
+	}
 	return true
 }
 
-func (w *wl_data_device) WlDataDevice_on_bind(
+func (w *WlDataDevice) OnBind(
 	_s protocols.ClientState,
-	_name protocols.ObjectID[protocols.WlDataDevice],
+	_name protocols.AnyObjectID,
 	_interface_ string,
-	_new_id protocols.ObjectID[protocols.WlDataDevice],
+	_new_id protocols.AnyObjectID,
 	_version_number uint32,
 ) {
-	/** @TODO: Implement wl_data_device_on_bind */
 }
 
-func MakeWlDataDevice(seat protocols.ObjectID[protocols.WlSeat]) *wl_data_device {
-	return &wl_data_device{Seat: seat}
+func MakeWlDataDevice(seat protocols.ObjectID[protocols.WlSeat], version uint32) *protocols.WlDataDevice {
+	return &protocols.WlDataDevice{
+		Delegate: &WlDataDevice{Seat: seat, Version: version},
+	}
 }
@@ -4,15 +4,19 @@ import (
 	"github.com/mmulet/term.everything/wayland/protocols"
 )
 
-type WlDataDeviceManagerImpl struct{}
+type WlDataDeviceManagerImpl struct {
+	Version uint32
+}
 
 func (w *WlDataDeviceManagerImpl) WlDataDeviceManager_create_data_source(s protocols.ClientState, _object_id protocols.ObjectID[protocols.WlDataDeviceManager], id protocols.ObjectID[protocols.WlDataSource]) {
-	s.AddObject(protocols.AnyObjectID(id), MakeWlDataSource())
+	s.AddObject(protocols.AnyObjectID(id), MakeWlDataSource(w.Version))
 }
 
 func (w *WlDataDeviceManagerImpl) WlDataDeviceManager_get_data_device(s protocols.ClientState, _object_id protocols.ObjectID[protocols.WlDataDeviceManager], id protocols.ObjectID[protocols.WlDataDevice], seat protocols.ObjectID[protocols.WlSeat]) {
-	s.AddObject(protocols.AnyObjectID(id), MakeWlDataDevice(seat))
-	/** @TODO: Implement wl_data_device_manager_get_data_device */
+	s.AddObject(protocols.AnyObjectID(id), MakeWlDataDevice(seat, w.Version))
+	if client, ok := s.(*Client); ok {
+		Selection.AddDataDevice(client, id, w.Version)
+	}
 }
 
 func (w *WlDataDeviceManagerImpl) OnBind(
@@ -22,7 +26,7 @@ func (w *WlDataDeviceManagerImpl) OnBind(
 	_ protocols.AnyObjectID,
 	version uint32,
 ) {
-	/** @TODO: Implement wl_data_device_manager_on_bind */
+	w.Version = version
 }
 
 func MakeWlDataDeviceManager() *protocols.WlDataDeviceManager {
@@ -0,0 +1,116 @@
+package wayland
+
+import (
+	"syscall"
+
+	"github.com/mmulet/term.everything/wayland/protocols"
+)
+
+/**
+ * The compositor side of a wl_data_offer. Offers
+ * are created by the compositor (see SeatSelection.makeOffer)
+ * whenever a client gets a new selection or a drag enters
+ * one of its surfaces.
+ */
+type WlDataOffer struct {
+	Source  *SelectionSource
+	Version uint32
+	Dnd     bool
+
+	AcceptedMimeType string
+	Action           protocols.WlDataDeviceManagerDndAction_enum
+}
+
+func (o *WlDataOffer) WlDataOffer_accept(
+	_s protocols.ClientState,
+	_object_id protocols.ObjectID[protocols.WlDataOffer],
+	_serial uint32,
+	mime_type string,
+) {
+	o.AcceptedMimeType = mime_type
+	if o.Dnd && o.Source != nil && o.Source.clientConnected() {
+		protocols.WlDataSource_target(o.Source.Client, o.Source.SourceID, mime_type)
+	}
+}
+
+func (o *WlDataOffer) WlDataOffer_receive(
+	_s protocols.ClientState,
+	_object_id protocols.ObjectID[protocols.WlDataOffer],
+	mime_type string,
+	fd *protocols.FileDescriptor,
+) {
+	if fd == nil {
+		return
+	}
+	if o.Source == nil {
+		_ = syscall.Close(int(*fd))
+		return
+	}
+	o.Source.Send(mime_type, *fd)
+}
+
+func (o *WlDataOffer) WlDataOffer_destroy(
+	_s protocols.ClientState,
+	_object_id protocols.ObjectID[protocols.WlDataOffer],
+) bool {
+	return true
+}
+
+func (o *WlDataOffer) WlDataOffer_finish(
+	_s protocols.ClientState,
+	_object_id protocols.ObjectID[protocols.WlDataOffer],
+) {
+	Selection.DragFinished(o)
+}
+
+func (o *WlDataOffer) WlDataOffer_set_actions(
+	s protocols.ClientState,
+	object_id protocols.ObjectID[protocols.WlDataOffer],
+	dnd_actions protocols.WlDataDeviceManagerDndAction_enum,
+	preferred_action protocols.WlDataDeviceManagerDndAction_enum,
+) {
+	if !o.Dnd || o.Source == nil {
+		return
+	}
+	o.Action = chooseDndAction(o.Source.Actions&dnd_actions, preferred_action)
+	protocols.WlDataOffer_action(s, o.Version, object_id, o.Action)
+	if o.Source.clientConnected() {
+		protocols.WlDataSource_action(o.Source.Client, o.Source.Version, o.Source.SourceID, o.Action)
+	}
+}
+
+func chooseDndAction(common, preferred protocols.WlDataDeviceManagerDndAction_enum) protocols.WlDataDeviceManagerDndAction_enum {
+	if preferred != protocols.WlDataDeviceManagerDndAction_enum_none && common&preferred != 0 {
+		return preferred
+	}
+	for _, action := range []protocols.WlDataDeviceManagerDndAction_enum{
+		protocols.WlDataDeviceManagerDndAction_enum_copy,
+		protocols.WlDataDeviceManagerDndAction_enum_move,
+		protocols.WlDataDeviceManagerDndAction_enum_ask,
+	} {
+		if common&action != 0 {
+			return action
+		}
+	}
+	return protocols.WlDataDeviceManagerDndAction_enum_none
+}
+
+func (o *WlDataOffer) OnBind(
+	_s protocols.ClientState,
+	_name protocols.AnyObjectID,
+	_interface_ string,
+	_new_id protocols.AnyObjectID,
+	_version_number uint32,
+) {
+}
+
+func MakeWlDataOffer(source *SelectionSource, version uint32, dnd bool) *protocols.WlDataOffer {
+	return &protocols.WlDataOffer{
+		Delegate: &WlDataOffer{
+			Source:  source,
+			Version: version,
+			Dnd:     dnd,
+			Action:  protocols.WlDataDeviceManagerDndAction_enum_none,
+		},
+	}
+}
@@ -1,12 +1,15 @@
 package wayland
 
 import (
+	"slices"
+
 	"github.com/mmulet/term.everything/wayland/protocols"
 )
 
 type WlDataSource struct {
 	MimeTypes []string
 	Actions   protocols.WlDataDeviceManagerDndAction_enum
+	Version   uint32
 }
 
 func (w *WlDataSource) WlDataSource_offer(
@@ -21,6 +24,9 @@ func (w *WlDataSource) WlDataSource_destroy(
 	s protocols.ClientState,
 	object_id protocols.ObjectID[protocols.WlDataSource],
 ) bool {
+	if client, ok := s.(*Client); ok {
+		Selection.SourceDestroyed(client, object_id)
+	}
 	return true
 }
 
@@ -42,12 +48,36 @@ func (w *WlDataSource) OnBind(
 	// TODO: Implement wl_data_source_on_bind
 }
 
-func MakeWlDataSource() *protocols.WlDataSource {
+func MakeWlDataSource(version uint32) *protocols.WlDataSource {
 	ws := &WlDataSource{
 		MimeTypes: []string{},
 		Actions:   protocols.WlDataDeviceManagerDndAction_enum_none,
+		Version:   version,
 	}
 	return &protocols.WlDataSource{
 		Delegate: ws,
 	}
 }
+
+/**
+ * Snapshot a client's wl_data_source so it can
+ * become the selection or the source of a drag.
+ * Returns nil if source_id is not a wl_data_source.
+ */
+func MakeSelectionSource(client *Client, sourceID protocols.ObjectID[protocols.WlDataSource]) *SelectionSource {
+	object, ok := client.GetObject(protocols.AnyObjectID(sourceID)).(*protocols.WlDataSource)
+	if !ok {
+		return nil
+	}
+	source, ok := object.Delegate.(*WlDataSource)
+	if !ok {
+		return nil
+	}
+	return &SelectionSource{
+		Client:    client,
+		SourceID:  sourceID,
+		Version:   source.Version,
+		MimeTypes: slices.Clone(source.MimeTypes),
+		Actions:   source.Actions,
+	}
+}
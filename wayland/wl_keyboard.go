@@ -1,8 +1,15 @@
 package wayland
 
+/*
+#include <stdlib.h>
+#include "mmap.h"
+*/
+import "C"
+
 import (
 	_ "embed"
-	"os"
+	"fmt"
+	"unsafe"
 
 	"github.com/mmulet/term.everything/wayland/protocols"
 )
@@ -10,11 +17,21 @@ import (
 //go:embed resources/server-1.xkb
 var xkbKeymapData []byte
 
+/**
+ * Sent in wl_keyboard.repeat_info. Legacy terminal input
+ * repeats by itself (a press and release each time). The
+ * rate is 0 with the kitty keyboard protocol, whose repeat
+ * events are sent as presses instead.
+ */
+var KeyRepeatRate int32 = 25
+var KeyRepeatDelay int32 = 600
+
 type WlKeyboard struct {
+	/**
+	 * A sealed memfd with the keymap, shared by every client
+	 */
 	Key_map_fd   protocols.FileDescriptor
 	Key_map_size uint32
-	// let's prevent the garbage collector from closing the file descriptor
-	File *os.File
 }
 
 func (o *WlKeyboard) WlKeyboard_release(s protocols.ClientState, _ protocols.ObjectID[protocols.WlKeyboard]) bool {
@@ -40,28 +57,41 @@ func (o *WlKeyboard) AfterGetKeyboard(
 		o.Key_map_fd,
 		o.Key_map_size,
 	)
+	if version, ok := protocols.GetGlobalWlKeyboardBinds(s)[object_id]; ok {
+		protocols.WlKeyboard_repeat_info(s, uint32(version), object_id, KeyRepeatRate, KeyRepeatDelay)
+	}
+	if client, ok := s.(*Client); ok {
+		Focus.AfterGetKeyboard(client, object_id)
+	}
 }
 
-func MakeWlKeyboard() *protocols.WlKeyboard {
+/**
+ * Replace the keymap for keyboards made from now on.
+ * The old memfd is kept open, clients may still
+ * be mapping it.
+ */
+func (o *WlKeyboard) SetKeymap(keymap []byte) error {
+	/**
+	 * xkbcommon reads the keymap as a C string
+	 */
+	data := append(append([]byte{}, keymap...), 0)
+	name := C.CString("xkb-keymap")
+	defer C.free(unsafe.Pointer(name))
+	fd := C.sealed_memfd(name, unsafe.Pointer(&data[0]), C.size_t(len(data)))
+	if fd < 0 {
+		return fmt.Errorf("could not make a memfd for the keymap")
+	}
+	o.Key_map_fd = protocols.FileDescriptor(fd)
+	o.Key_map_size = uint32(len(data))
+	return nil
+}
 
-	f, err := os.CreateTemp(os.TempDir(), "xkb-keymap-*.xkb")
-	if err != nil {
+func MakeWlKeyboard() *protocols.WlKeyboard {
+	keyboard := &WlKeyboard{}
+	if err := keyboard.SetKeymap(xkbKeymapData); err != nil {
 		panic(err)
 	}
-	if _, werr := f.Write(xkbKeymapData); werr != nil {
-		f.Close()
-		panic(werr)
-	}
-	if _, serr := f.Seek(0, 0); serr != nil {
-		f.Close()
-		panic(serr)
-	}
 	return &protocols.WlKeyboard{
-		Delegate: &WlKeyboard{
-			Key_map_fd:   protocols.FileDescriptor(f.Fd()),
-			Key_map_size: uint32(len(xkbKeymapData)),
-			File:         f,
-		},
+		Delegate: keyboard,
 	}
-
 }
@@ -22,14 +22,20 @@ func (o *WlOutput) OnBind(
 	newID := protocols.ObjectID[protocols.WlOutput](newId_any)
 	o.Version = version
 
-	protocols.WlOutput_scale(s, o.Version, newID, 1)
+	protocols.WlOutput_scale(s, o.Version, newID, OutputScale)
 
 	protocols.WlOutput_name(s, o.Version, newID, "term.everything Virtual Monitor")
 	protocols.WlOutput_description(s, o.Version, newID, "The best monitor")
 
+	sendOutputMode(s, newID)
+
+	protocols.WlOutput_done(s, version, newID)
+}
+
+func sendOutputMode(s protocols.ClientState, id protocols.ObjectID[protocols.WlOutput]) {
 	protocols.WlOutput_geometry(
 		s,
-		newID,
+		id,
 		0,
 		0,
 		int32(VirtualMonitorSize.Width),
@@ -40,16 +46,18 @@ func (o *WlOutput) OnBind(
 		int32(protocols.WlOutputTransform_enum_normal),
 	)
 
+	/**
+	 * The mode is in physical pixels
+	 */
+	desktopSize := DesktopSizeForMonitor(VirtualMonitorSize)
 	protocols.WlOutput_mode(
 		s,
-		newID,
+		id,
 		protocols.WlOutputMode_enum_current,
-		int32(VirtualMonitorSize.Width),
-		int32(VirtualMonitorSize.Height),
+		int32(desktopSize.Width),
+		int32(desktopSize.Height),
 		60_000,
 	)
-
-	protocols.WlOutput_done(s, version, newID)
 }
 
 func MakeWlOutput() *protocols.WlOutput {
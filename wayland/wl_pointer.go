@@ -77,12 +77,13 @@ func (p *WlPointer) WlPointer_set_cursor(
 
 }
 
-func (p *WlPointer) AfterGetPointer(_ protocols.ClientState, _ protocols.ObjectID[protocols.WlPointer]) {
-	/** @TODO: Implement wl_pointer_set_cursor */
-	/**
-	 * @TODO probably pointer.enter
-	 */
-	// this.last_pointer_enter_serial += 1;
+func (p *WlPointer) AfterGetPointer(s protocols.ClientState, object_id protocols.ObjectID[protocols.WlPointer]) {
+	client, ok := s.(*Client)
+	if !ok {
+		return
+	}
+	version := protocols.GetGlobalWlPointerBinds(s)[object_id]
+	Focus.AfterGetPointer(client, object_id, uint32(version))
 }
 
 func (p *WlPointer) WlPointer_release(
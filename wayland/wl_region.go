@@ -9,7 +9,38 @@ func auto_release(s protocols.ClientState,
 	return true
 }
 
+type RegionOperation struct {
+	Rect
+	Subtract bool
+}
+
+/**
+ * A region is built up by adding and subtracting
+ * rectangles in order. A point is in the region
+ * if the last rectangle that contains it was added.
+ */
+type Region struct {
+	Operations []RegionOperation
+}
+
+func (r *Region) Contains(x, y int32) bool {
+	inside := false
+	for _, op := range r.Operations {
+		if x >= op.X && y >= op.Y && x < op.X+op.Width && y < op.Y+op.Height {
+			inside = !op.Subtract
+		}
+	}
+	return inside
+}
+
+func (r *Region) Clone() *Region {
+	return &Region{
+		Operations: append([]RegionOperation(nil), r.Operations...),
+	}
+}
+
 type WlRegion struct {
+	Region
 }
 
 func (r *WlRegion) WlRegion_destroy(
@@ -27,18 +58,23 @@ func (r *WlRegion) WlRegion_add(
 	width int32,
 	height int32,
 ) {
-	// TODO: Implement proper region union semantics.
+	r.Operations = append(r.Operations, RegionOperation{
+		Rect: Rect{X: x, Y: y, Width: width, Height: height},
+	})
 }
 
 func (r *WlRegion) WlRegion_subtract(
 	_ protocols.ClientState,
 	_ protocols.ObjectID[protocols.WlRegion],
-	_x int32,
-	_y int32,
-	_width int32,
-	_height int32,
+	x int32,
+	y int32,
+	width int32,
+	height int32,
 ) {
-	// TODO: Implement proper region subtraction semantics.
+	r.Operations = append(r.Operations, RegionOperation{
+		Rect:     Rect{X: x, Y: y, Width: width, Height: height},
+		Subtract: true,
+	})
 }
 
 func (r *WlRegion) OnBind(
@@ -56,3 +92,16 @@ func MakeWlRegion() *protocols.WlRegion {
 		Delegate: &WlRegion{},
 	}
 }
+
+/**
+ * Copy the current state of a wl_region, because
+ * clients usually destroy the region right after
+ * they set it.
+ */
+func GetRegionSnapshot(s protocols.ClientState, id protocols.ObjectID[protocols.WlRegion]) *Region {
+	region := GetWlRegionObject(s, id)
+	if region == nil {
+		return nil
+	}
+	return region.Clone()
+}
@@ -15,6 +15,7 @@ func (w *WlSeat) WlSeat_get_pointer(
 ) {
 	s.AddGlobalWlPointerBind(id, protocols.Version(w.Version))
 	AddObject(s, id, Global_WlPointer)
+	Pointer.AfterGetPointer(s, id)
 }
 
 func (w *WlSeat) WlSeat_get_keyboard(
@@ -27,11 +27,16 @@ type WlShmPool struct {
 	Buffers           map[protocols.ObjectID[protocols.WlBuffer]]BufferInfo
 	MemMaps           map[protocols.ObjectID[protocols.WlShmPool]]MemMapInfo
 	WlShmPoolObjectID protocols.ObjectID[protocols.WlShmPool]
+	/**
+	 * Surfaces drawing straight from one of our
+	 * buffers, see ZeroCopyBuffers
+	 */
+	Holders map[*WlSurface]protocols.ObjectID[protocols.WlBuffer]
 }
 
 func (p *WlShmPool) WlShmPool_create_buffer(
 	s protocols.ClientState,
-	_objectID protocols.ObjectID[protocols.WlShmPool],
+	objectID protocols.ObjectID[protocols.WlShmPool],
 	id protocols.ObjectID[protocols.WlBuffer],
 	offset int32,
 	width int32,
@@ -39,6 +44,14 @@ func (p *WlShmPool) WlShmPool_create_buffer(
 	stride int32,
 	format protocols.WlShmFormat_enum,
 ) {
+	if !ShmFormatSupported(format) {
+		SendError(s, objectID, protocols.WlShmError_enum_invalid_format, fmt.Sprintf("unsupported format 0x%x", uint32(format)))
+		return
+	}
+	if width <= 0 || height <= 0 || stride < width*int32(ShmFormatBytesPerPixel(format)) {
+		SendError(s, objectID, protocols.WlShmError_enum_invalid_stride, "invalid width, height or stride")
+		return
+	}
 	buf := &protocols.WlBuffer{
 		Delegate: p,
 	}
@@ -53,6 +66,9 @@ func (p *WlShmPool) WlShmPool_create_buffer(
 }
 
 func (p *WlShmPool) OnDestroyShmPool(s protocols.ClientState, objectID protocols.ObjectID[protocols.WlShmPool]) {
+	for surface := range p.Holders {
+		surface.forgetHeldBuffer()
+	}
 	if memap, ok := p.MemMaps[objectID]; ok {
 		memap.Unmap()
 	}
@@ -103,8 +119,9 @@ func (p *WlShmPool) WlShmPool_resize(
 				p.MapState = MapStateDestroyed
 				return
 			}
-			old.Unmap()
 			p.MemMaps[objectID] = newMap
+			p.refreshHeldTextures()
+			old.Unmap()
 
 			// err := memap.Remap(uint64(size))
 			// if err != nil {
@@ -150,6 +167,7 @@ func MakeWlShmPool(
 		Buffers:           make(map[protocols.ObjectID[protocols.WlBuffer]]BufferInfo),
 		MemMaps:           make(map[protocols.ObjectID[protocols.WlShmPool]]MemMapInfo),
 		WlShmPoolObjectID: wlShmPoolObjectID,
+		Holders:           make(map[*WlSurface]protocols.ObjectID[protocols.WlBuffer]),
 	}
 
 	memMap, err := NewMemMapInfo(int(fd), uint64(size))
@@ -180,6 +198,7 @@ func (p *WlShmPool) WlBuffer_destroy(
 		fmt.Printf("destroying a buffer that does not exist!, wl_shm_pool_id: %d, buffer_id: %d\n", p.WlShmPoolObjectID, bufferObjectID)
 		return true
 	}
+	p.detachHolders(bufferObjectID)
 	delete(p.Buffers, bufferObjectID)
 	switch p.MapState {
 	case MapStateDestroyed, MapStateMmapped:
@@ -3,6 +3,7 @@ package wayland
 import (
 	"fmt"
 	"image"
+	"math"
 
 	"github.com/mmulet/term.everything/wayland/protocols"
 )
@@ -50,10 +51,27 @@ type WlSurface struct {
 	BufferTransform protocols.WlOutputTransform_enum
 	BufferScale     int32
 
+	/**
+	 * From wp_viewport, nil when unset
+	 */
+	Viewport            *protocols.ObjectID[protocols.WpViewport]
+	ViewportSource      *ViewportSource
+	ViewportDestination *ViewportDestination
+
+	/**
+	 * The surface's wp_fractional_scale_v1, nil if none
+	 */
+	FractionalScale *protocols.ObjectID[protocols.WpFractionalScaleV1]
+
 	/**
 	 * Null means infinite, (ie we can accept input from everywhere)
 	 */
 	InputRegion *protocols.ObjectID[protocols.WlRegion]
+	/**
+	 * A copy of the input region when it was set,
+	 * nil means infinite.
+	 */
+	InputRegionShape *Region
 	/**
 	 * Unlink opaque region, null means empty!
 	 */
@@ -64,11 +82,27 @@ type WlSurface struct {
 	Offset Point
 
 	/**
-	 * Don't care about regions for now.
-	 * Just need to clear this when the surface has
-	 * been drawn.
+	 * Surface local rectangles that changed since
+	 * the desktop last drew this surface.
+	 * The desktop clears this when it draws it.
+	 */
+	Damage []Rect
+
+	/**
+	 * With ZeroCopyBuffers, the buffer that Texture
+	 * points into. Released when it is replaced.
+	 */
+	HeldBuffer     *protocols.ObjectID[protocols.WlBuffer]
+	HeldBufferPool *WlShmPool
+
+	/**
+	 * Goes up every time the texture gets new contents
 	 */
-	Damaged bool
+	textureVersion uint64
+	/**
+	 * See SurfaceImage
+	 */
+	scaled *scaledTexture
 }
 
 func (w *WlSurface) ClearRoleData() {
@@ -106,6 +140,7 @@ func (w *WlSurface) WlSurface_destroy(
 ) bool {
 
 	// this.destroy_texture(s, object_id);
+	w.ReleaseHeldBuffer(s)
 
 	if !w.HasRoleData() {
 		return true
@@ -176,11 +211,76 @@ func (w *WlSurface) WlSurface_set_opaque_region(
 }
 
 func (w *WlSurface) WlSurface_set_input_region(
-	_ protocols.ClientState,
+	s protocols.ClientState,
 	_ protocols.ObjectID[protocols.WlSurface],
 	region *protocols.ObjectID[protocols.WlRegion],
 ) {
 	w.PendingUpdate.InputRegion = region
+	w.PendingUpdate.InputRegionSet = true
+	w.PendingUpdate.InputRegionShape = nil
+	if region != nil {
+		w.PendingUpdate.InputRegionShape = GetRegionSnapshot(s, *region)
+	}
+}
+
+/**
+ * x and y are surface local
+ */
+func (w *WlSurface) AcceptsInputAt(x, y int32) bool {
+	width, height := w.Size()
+	if x < 0 || y < 0 || x >= width || y >= height {
+		return false
+	}
+	if w.InputRegionShape == nil {
+		return true
+	}
+	return w.InputRegionShape.Contains(x, y)
+}
+
+/**
+ * Convert damage_buffer coordinates to surface local
+ * coordinates, rounding outwards.
+ */
+func (w *WlSurface) BufferRectToSurface(r Rect) Rect {
+	scale := max(w.BufferScale, 1)
+	if scale == 1 &&
+		w.BufferTransform == protocols.WlOutputTransform_enum_normal &&
+		w.ViewportSource == nil &&
+		w.ViewportDestination == nil {
+		return r
+	}
+	width, height := w.bufferSurfaceSize()
+	if width == 0 || height == 0 {
+		/**
+		 * No buffer yet, so no damage to transform
+		 */
+		return Rect{}
+	}
+	x0, y0 := bufferToSurface(w.BufferTransform, float64(width), float64(height),
+		float64(r.X)/float64(scale), float64(r.Y)/float64(scale))
+	x1, y1 := bufferToSurface(w.BufferTransform, float64(width), float64(height),
+		(float64(r.X)+float64(r.Width))/float64(scale), (float64(r.Y)+float64(r.Height))/float64(scale))
+
+	/**
+	 * Then the wp_viewport crop and scale
+	 */
+	source := w.viewportSource()
+	surfaceWidth, surfaceHeight := w.Size()
+	scaleX := float64(surfaceWidth) / source.Width
+	scaleY := float64(surfaceHeight) / source.Height
+	x0, x1 = (x0-source.X)*scaleX, (x1-source.X)*scaleX
+	y0, y1 = (y0-source.Y)*scaleY, (y1-source.Y)*scaleY
+
+	left := math.Floor(min(x0, x1))
+	top := math.Floor(min(y0, y1))
+	right := math.Ceil(max(x0, x1))
+	bottom := math.Ceil(max(y0, y1))
+	return Rect{
+		X:      int32(max(left, math.MinInt32)),
+		Y:      int32(max(top, math.MinInt32)),
+		Width:  int32(min(right-left, math.MaxInt32)),
+		Height: int32(min(bottom-top, math.MaxInt32)),
+	}
 }
 
 func (w *WlSurface) WlSurface_commit(
@@ -191,35 +291,40 @@ func (w *WlSurface) WlSurface_commit(
 	pendingBufferTextureUpdates = ApplyWlSurfaceDoubleBufferedState(s, object_id, false, pendingBufferTextureUpdates, 0)
 
 	for _, upd := range pendingBufferTextureUpdates {
-		CopyBufferToWlSurfaceTexture(s, upd.Surface, upd.ZIndex, upd.Buffer)
-	}
-
-	for _, upd := range pendingBufferTextureUpdates {
+		held := CopyBufferToWlSurfaceTexture(s, upd.Surface, upd.ZIndex, upd.Buffer)
 		/**
-		 * @TODO Is there every an occasion where the buffer would
-		 * be used more than once, ie can we always release it here?
+		 * We copied it (or couldn't use it), either way the
+		 * client can re-use it. Held buffers are released
+		 * when the surface gets a new one.
 		 */
-		// After consumption, tell client its buffer can be re-used
-		if upd.Buffer != nil {
+		if upd.Buffer != nil && !held {
 			protocols.WlBuffer_release(s, *upd.Buffer)
 		}
 	}
 }
 
 func (w *WlSurface) WlSurface_set_buffer_transform(
-	_ protocols.ClientState,
-	_ protocols.ObjectID[protocols.WlSurface],
+	s protocols.ClientState,
+	object_id protocols.ObjectID[protocols.WlSurface],
 	transform int32,
 ) {
+	if transform < int32(protocols.WlOutputTransform_enum_normal) || transform > int32(protocols.WlOutputTransform_enum_flipped_270) {
+		SendError(s, object_id, protocols.WlSurfaceError_enum_invalid_transform, "invalid buffer transform")
+		return
+	}
 	t := protocols.WlOutputTransform_enum(transform)
 	w.PendingUpdate.BufferTransform = &t
 }
 
 func (w *WlSurface) WlSurface_set_buffer_scale(
-	_ protocols.ClientState,
-	_ protocols.ObjectID[protocols.WlSurface],
+	s protocols.ClientState,
+	object_id protocols.ObjectID[protocols.WlSurface],
 	scale int32,
 ) {
+	if scale < 1 {
+		SendError(s, object_id, protocols.WlSurfaceError_enum_invalid_scale, "buffer scale must be at least 1")
+		return
+	}
 	w.PendingUpdate.BufferScale = &scale
 }
 
@@ -0,0 +1,48 @@
+package wayland
+
+import (
+	"github.com/mmulet/term.everything/wayland/protocols"
+)
+
+type WpFractionalScaleManagerV1 struct{}
+
+func (m *WpFractionalScaleManagerV1) WpFractionalScaleManagerV1_destroy(
+	_ protocols.ClientState,
+	_ protocols.ObjectID[protocols.WpFractionalScaleManagerV1],
+) bool {
+	return true
+}
+
+func (m *WpFractionalScaleManagerV1) WpFractionalScaleManagerV1_get_fractional_scale(
+	s protocols.ClientState,
+	objectID protocols.ObjectID[protocols.WpFractionalScaleManagerV1],
+	id protocols.ObjectID[protocols.WpFractionalScaleV1],
+	surfaceID protocols.ObjectID[protocols.WlSurface],
+) {
+	surface := GetWlSurfaceObject(s, surfaceID)
+	if surface == nil {
+		return
+	}
+	if surface.FractionalScale != nil {
+		SendError(s, objectID, protocols.WpFractionalScaleManagerV1Error_enum_fractional_scale_exists, "the surface already has a fractional scale")
+		return
+	}
+	surface.FractionalScale = &id
+	AddObject(s, id, MakeWpFractionalScaleV1(surfaceID))
+	protocols.WpFractionalScaleV1_preferred_scale(s, id, DesktopScale)
+}
+
+func (m *WpFractionalScaleManagerV1) OnBind(
+	_ protocols.ClientState,
+	_ protocols.AnyObjectID,
+	_ string,
+	_ protocols.AnyObjectID,
+	_ uint32,
+) {
+}
+
+func MakeWpFractionalScaleManagerV1() *protocols.WpFractionalScaleManagerV1 {
+	return &protocols.WpFractionalScaleManagerV1{
+		Delegate: &WpFractionalScaleManagerV1{},
+	}
+}
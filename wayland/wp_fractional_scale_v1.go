@@ -0,0 +1,58 @@
+package wayland
+
+import (
+	"github.com/mmulet/term.everything/wayland/protocols"
+)
+
+/**
+ * Tells a surface what scale to render at. The app
+ * renders a buffer that many times bigger, and sets
+ * the surface size with a wp_viewport destination.
+ */
+type WpFractionalScaleV1 struct {
+	SurfaceID protocols.ObjectID[protocols.WlSurface]
+}
+
+func (f *WpFractionalScaleV1) WpFractionalScaleV1_destroy(
+	s protocols.ClientState,
+	_ protocols.ObjectID[protocols.WpFractionalScaleV1],
+) bool {
+	if surface := GetWlSurfaceObject(s, f.SurfaceID); surface != nil {
+		surface.FractionalScale = nil
+	}
+	return true
+}
+
+func (f *WpFractionalScaleV1) OnBind(
+	_ protocols.ClientState,
+	_ protocols.AnyObjectID,
+	_ string,
+	_ protocols.AnyObjectID,
+	_ uint32,
+) {
+}
+
+/**
+ * Send the current DesktopScale to every
+ * wp_fractional_scale_v1 of the client
+ */
+func sendPreferredScale(client *Client) {
+	for id, object := range client.Objects {
+		if _, ok := object.(*protocols.WpFractionalScaleV1); !ok {
+			continue
+		}
+		protocols.WpFractionalScaleV1_preferred_scale(
+			client,
+			protocols.ObjectID[protocols.WpFractionalScaleV1](id),
+			DesktopScale,
+		)
+	}
+}
+
+func MakeWpFractionalScaleV1(surfaceID protocols.ObjectID[protocols.WlSurface]) *protocols.WpFractionalScaleV1 {
+	return &protocols.WpFractionalScaleV1{
+		Delegate: &WpFractionalScaleV1{
+			SurfaceID: surfaceID,
+		},
+	}
+}
@@ -0,0 +1,136 @@
+package wayland
+
+import (
+	"github.com/mmulet/term.everything/wayland/protocols"
+)
+
+/**
+ * wp_viewport source rectangle, in surface local
+ * coordinates before the viewport is applied
+ * (after buffer_transform and buffer_scale).
+ */
+type ViewportSource struct {
+	X      float64
+	Y      float64
+	Width  float64
+	Height float64
+}
+
+type ViewportDestination struct {
+	Width  int32
+	Height int32
+}
+
+/**
+ * Crops and scales its surface. The state is double
+ * buffered, so it goes into the surface's PendingUpdate.
+ */
+type WpViewport struct {
+	SurfaceID protocols.ObjectID[protocols.WlSurface]
+}
+
+/**
+ * The surface, or a no_surface error if it is gone
+ */
+func (v *WpViewport) surface(
+	s protocols.ClientState,
+	objectID protocols.ObjectID[protocols.WpViewport],
+) *WlSurface {
+	surface := GetWlSurfaceObject(s, v.SurfaceID)
+	if surface == nil {
+		SendError(s, objectID, protocols.WpViewportError_enum_no_surface, "the wl_surface was destroyed")
+	}
+	return surface
+}
+
+func (v *WpViewport) WpViewport_destroy(
+	s protocols.ClientState,
+	objectID protocols.ObjectID[protocols.WpViewport],
+) bool {
+	surface := GetWlSurfaceObject(s, v.SurfaceID)
+	if surface == nil {
+		return true
+	}
+	surface.Viewport = nil
+	/**
+	 * The crop and scale are removed on the next commit
+	 */
+	surface.PendingUpdate.ViewportSourceSet = true
+	surface.PendingUpdate.ViewportSource = nil
+	surface.PendingUpdate.ViewportDestinationSet = true
+	surface.PendingUpdate.ViewportDestination = nil
+	return true
+}
+
+func (v *WpViewport) WpViewport_set_source(
+	s protocols.ClientState,
+	objectID protocols.ObjectID[protocols.WpViewport],
+	x protocols.Fixed,
+	y protocols.Fixed,
+	width protocols.Fixed,
+	height protocols.Fixed,
+) {
+	surface := v.surface(s, objectID)
+	if surface == nil {
+		return
+	}
+	if x == -1 && y == -1 && width == -1 && height == -1 {
+		surface.PendingUpdate.ViewportSourceSet = true
+		surface.PendingUpdate.ViewportSource = nil
+		return
+	}
+	if x < 0 || y < 0 || width <= 0 || height <= 0 {
+		SendError(s, objectID, protocols.WpViewportError_enum_bad_value, "invalid source rectangle")
+		return
+	}
+	surface.PendingUpdate.ViewportSourceSet = true
+	surface.PendingUpdate.ViewportSource = &ViewportSource{
+		X:      x,
+		Y:      y,
+		Width:  width,
+		Height: height,
+	}
+}
+
+func (v *WpViewport) WpViewport_set_destination(
+	s protocols.ClientState,
+	objectID protocols.ObjectID[protocols.WpViewport],
+	width int32,
+	height int32,
+) {
+	surface := v.surface(s, objectID)
+	if surface == nil {
+		return
+	}
+	if width == -1 && height == -1 {
+		surface.PendingUpdate.ViewportDestinationSet = true
+		surface.PendingUpdate.ViewportDestination = nil
+		return
+	}
+	if width <= 0 || height <= 0 {
+		SendError(s, objectID, protocols.WpViewportError_enum_bad_value, "invalid destination size")
+		return
+	}
+	surface.PendingUpdate.ViewportDestinationSet = true
+	surface.PendingUpdate.ViewportDestination = &ViewportDestination{
+		Width:  width,
+		Height: height,
+	}
+}
+
+func (v *WpViewport) OnBind(
+	_ protocols.ClientState,
+	_ protocols.AnyObjectID,
+	_ string,
+	_ protocols.AnyObjectID,
+	_ uint32,
+) {
+}
+
+func MakeWpViewport(surfaceID protocols.ObjectID[protocols.WlSurface]) *protocols.WpViewport {
+	return &protocols.WpViewport{
+		Delegate: &WpViewport{
+			SurfaceID: surfaceID,
+		},
+	}
+}
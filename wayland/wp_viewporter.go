@@ -0,0 +1,47 @@
+package wayland
+
+import (
+	"github.com/mmulet/term.everything/wayland/protocols"
+)
+
+type WpViewporter struct{}
+
+func (v *WpViewporter) WpViewporter_destroy(
+	_ protocols.ClientState,
+	_ protocols.ObjectID[protocols.WpViewporter],
+) bool {
+	return true
+}
+
+func (v *WpViewporter) WpViewporter_get_viewport(
+	s protocols.ClientState,
+	objectID protocols.ObjectID[protocols.WpViewporter],
+	id protocols.ObjectID[protocols.WpViewport],
+	surfaceID protocols.ObjectID[protocols.WlSurface],
+) {
+	surface := GetWlSurfaceObject(s, surfaceID)
+	if surface == nil {
+		return
+	}
+	if surface.Viewport != nil {
+		SendError(s, objectID, protocols.WpViewporterError_enum_viewport_exists, "the surface already has a viewport")
+		return
+	}
+	surface.Viewport = &id
+	AddObject(s, id, MakeWpViewport(surfaceID))
+}
+
+func (v *WpViewporter) OnBind(
+	_ protocols.ClientState,
+	_ protocols.AnyObjectID,
+	_ string,
+	_ protocols.AnyObjectID,
+	_ uint32,
+) {
+}
+
+func MakeWpViewporter() *protocols.WpViewporter {
+	return &protocols.WpViewporter{
+		Delegate: &WpViewporter{},
+	}
+}
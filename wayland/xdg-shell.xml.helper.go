@@ -33,3 +33,13 @@ func GetXdgToplevelObject(cs protocols.ClientState, id protocols.ObjectID[protoc
 	d := o.GetDelegate()
 	return d.(*XdgToplevel)
 }
+
+func GetXdgPopupObject(cs protocols.ClientState, id protocols.ObjectID[protocols.XdgPopup]) *XdgPopup {
+	v := cs.GetObject(protocols.AnyObjectID(id))
+	if v == nil {
+		return nil
+	}
+	o := v.(protocols.WaylandObject[protocols.XdgPopup_delegate])
+	d := o.GetDelegate()
+	return d.(*XdgPopup)
+}
@@ -8,19 +8,26 @@ type XdgPopup struct {
 	Version uint32
 	Parent  *protocols.ObjectID[protocols.XdgSurface]
 	State   XdgPositionerState
+	/**
+	 * Where the popup is, relative to
+	 * the parent's window geometry
+	 */
+	Geometry Rect
 	/**
 	 * Only one instead of a queue because if multiple
 	 * position requests are sent we can ignore
-	 * all but the last one
+	 * all but the last one. Applied on the next commit.
 	 */
-	pendingPosition       *XdgPositionerState
-	pendingPositionSerial *uint32
+	pendingGeometry *Rect
 }
 
 func (x *XdgPopup) XdgPopup_destroy(
 	s protocols.ClientState,
 	object_id protocols.ObjectID[protocols.XdgPopup],
 ) bool {
+	if client, ok := s.(*Client); ok {
+		Focus.PopupDestroyed(client, object_id)
+	}
 	surface := GetSurfaceFromRole(s, object_id)
 	UnregisterRoleToSurface(s, object_id)
 	if surface == nil {
@@ -39,12 +46,30 @@ func (x *XdgPopup) XdgPopup_destroy(
 }
 
 func (x *XdgPopup) XdgPopup_grab(
-	_ protocols.ClientState,
-	_ protocols.ObjectID[protocols.XdgPopup],
+	s protocols.ClientState,
+	object_id protocols.ObjectID[protocols.XdgPopup],
 	_ protocols.ObjectID[protocols.WlSeat],
 	_ uint32,
 ) {
-	/** @TODO: Implement xdg_popup_grab */
+	client, ok := s.(*Client)
+	if !ok {
+		return
+	}
+	surfaceID := GetSurfaceIDFromRole(s, object_id)
+	if surfaceID == nil {
+		return
+	}
+	grab := &PopupGrab{
+		Client:    client,
+		PopupID:   object_id,
+		SurfaceID: *surfaceID,
+	}
+	if x.Parent != nil {
+		if parentID := GetSurfaceIDFromRole(s, *x.Parent); parentID != nil {
+			grab.ParentSurfaceID = *parentID
+		}
+	}
+	Focus.PopupGrabbed(grab)
 }
 
 func (x *XdgPopup) XdgPopup_reposition(
@@ -57,38 +82,112 @@ func (x *XdgPopup) XdgPopup_reposition(
 	if positioner == nil {
 		return
 	}
-	new_state := positioner.state
-	st := new_state // copy
-	x.pendingPosition = &st
-	x.pendingPositionSerial = &token
+	x.State = positioner.state
+	geometry := x.place(s)
+	x.pendingGeometry = &geometry
 
 	protocols.XdgPopup_repositioned(s, x.Version, object_id, token)
+	x.sendConfigure(s, object_id, geometry)
+}
 
-	/**
-	 * @TODO figure out what
-	 * these values are
-	 */
-	protocols.XdgPopup_configure(s, object_id, 0, 0, int32(VirtualMonitorSize.Width), int32(VirtualMonitorSize.Height))
+/**
+ * Run the positioner against the virtual monitor
+ */
+func (x *XdgPopup) place(s protocols.ClientState) Rect {
+	origin := Point{}
+	if x.Parent != nil {
+		origin = xdgSurfaceGeometryOrigin(s, *x.Parent)
+	}
+	return x.State.Place(Rect{
+		X:      -origin.X,
+		Y:      -origin.Y,
+		Width:  int32(VirtualMonitorSize.Width),
+		Height: int32(VirtualMonitorSize.Height),
+	})
+}
 
-	surface := GetSurfaceFromRole(s, object_id)
-	if surface == nil {
+/**
+ * Like XdgToplevel.sendConfigure, doesn't wait for the ack.
+ */
+func (x *XdgPopup) sendConfigure(
+	s protocols.ClientState,
+	objectID protocols.ObjectID[protocols.XdgPopup],
+	geometry Rect,
+) {
+	protocols.XdgPopup_configure(s, objectID, geometry.X, geometry.Y, geometry.Width, geometry.Height)
+
+	surface := GetSurfaceFromRole(s, objectID)
+	if surface == nil || surface.XdgSurfaceState == nil {
 		return
 	}
-
-	if surface.XdgSurfaceState == nil {
+	xdgSurface := GetXdgSurfaceObject(s, *surface.XdgSurfaceState)
+	if xdgSurface == nil {
 		return
 	}
+	xdgSurface.LatestSerial += 1
+	protocols.XdgSurface_configure(s, xdgSurface.XdgSurfaceID, xdgSurface.LatestSerial)
+}
 
-	xdg_surface_state := GetXdgSurfaceObject(s, *surface.XdgSurfaceState)
-	if xdg_surface_state == nil {
+/**
+ * Called on commit, a reposition only
+ * takes effect with the new buffer.
+ */
+func (x *XdgPopup) applyPendingGeometry(s protocols.ClientState, surface *WlSurface) {
+	if x.pendingGeometry == nil {
 		return
 	}
+	x.Geometry = *x.pendingGeometry
+	x.pendingGeometry = nil
+	position := x.surfacePosition(s, surface)
+	surface.Position.X = position.X
+	surface.Position.Y = position.Y
+}
 
-	go func() {
-		xdg_surface_state.configure(s)
-		// reposition the popup somehow
-	}()
+/**
+ * Where the popup's surface goes, relative to the
+ * parent's window geometry (see Desktop.DrawClients).
+ */
+func (x *XdgPopup) surfacePosition(s protocols.ClientState, surface *WlSurface) Point {
+	position := Point{X: x.Geometry.X, Y: x.Geometry.Y}
+	if surface.XdgSurfaceState == nil {
+		return position
+	}
+	if xdgSurface := GetXdgSurfaceObject(s, *surface.XdgSurfaceState); xdgSurface != nil {
+		position.X -= xdgSurface.WindowGeometry.X
+		position.Y -= xdgSurface.WindowGeometry.Y
+	}
+	return position
+}
 
+/**
+ * The top left of the xdg_surface's window geometry
+ * on the desktop. Popups are positioned relative to this.
+ */
+func xdgSurfaceGeometryOrigin(s protocols.ClientState, xdgSurfaceID protocols.ObjectID[protocols.XdgSurface]) Point {
+	xdgSurface := GetXdgSurfaceObject(s, xdgSurfaceID)
+	surface := GetSurfaceFromRole(s, xdgSurfaceID)
+	if xdgSurface == nil || surface == nil {
+		return Point{}
+	}
+	origin := Point{
+		X: surface.Position.X + xdgSurface.WindowGeometry.X,
+		Y: surface.Position.Y + xdgSurface.WindowGeometry.Y,
+	}
+	role, ok := surface.Role.(*SurfaceRoleXdgPopup)
+	if !ok || role.Data == nil {
+		return origin
+	}
+	/**
+	 * A popup's position is relative to its parent
+	 */
+	popup := GetXdgPopupObject(s, *role.Data)
+	if popup == nil || popup.Parent == nil || *popup.Parent == xdgSurfaceID {
+		return origin
+	}
+	parentOrigin := xdgSurfaceGeometryOrigin(s, *popup.Parent)
+	origin.X += parentOrigin.X
+	origin.Y += parentOrigin.Y
+	return origin
 }
 
 func (x *XdgPopup) OnBind(
@@ -82,7 +82,7 @@ func (x *XdgPositioner) XdgPositioner_set_constraint_adjustment(
 	_ protocols.ObjectID[protocols.XdgPositioner],
 	adj protocols.XdgPositionerConstraintAdjustment_enum,
 ) {
-	/** @TODO: Implement xdg_positioner_set_constraint_adjustment */
+	x.state.ConstraintAdjustment = adj
 }
 
 func (x *XdgPositioner) XdgPositioner_set_offset(
@@ -139,3 +139,197 @@ func MakeXdgPositioner() *protocols.XdgPositioner {
 		Delegate: &XdgPositioner{},
 	}
 }
+
+/**
+ * The point on the anchor rect the popup is positioned from
+ */
+func (p *XdgPositionerState) anchorPoint(anchor protocols.XdgPositionerAnchor_enum) Point {
+	r := p.AnchorRect
+	point := Point{X: r.X + r.Width/2, Y: r.Y + r.Height/2}
+	switch anchor {
+	case protocols.XdgPositionerAnchor_enum_left,
+		protocols.XdgPositionerAnchor_enum_top_left,
+		protocols.XdgPositionerAnchor_enum_bottom_left:
+		point.X = r.X
+	case protocols.XdgPositionerAnchor_enum_right,
+		protocols.XdgPositionerAnchor_enum_top_right,
+		protocols.XdgPositionerAnchor_enum_bottom_right:
+		point.X = r.X + r.Width
+	}
+	switch anchor {
+	case protocols.XdgPositionerAnchor_enum_top,
+		protocols.XdgPositionerAnchor_enum_top_left,
+		protocols.XdgPositionerAnchor_enum_top_right:
+		point.Y = r.Y
+	case protocols.XdgPositionerAnchor_enum_bottom,
+		protocols.XdgPositionerAnchor_enum_bottom_left,
+		protocols.XdgPositionerAnchor_enum_bottom_right:
+		point.Y = r.Y + r.Height
+	}
+	return point
+}
+
+/**
+ * Where the popup goes with this anchor and gravity,
+ * before any constraint adjustment.
+ */
+func (p *XdgPositionerState) unconstrained(
+	anchor protocols.XdgPositionerAnchor_enum,
+	gravity protocols.XdgPositionerGravity_enum,
+) Rect {
+	point := p.anchorPoint(anchor)
+	box := Rect{
+		X:      point.X + p.Offset.X - p.Width/2,
+		Y:      point.Y + p.Offset.Y - p.Height/2,
+		Width:  p.Width,
+		Height: p.Height,
+	}
+	/**
+	 * Gravity is the direction the popup
+	 * extends from the anchor point.
+	 */
+	switch gravity {
+	case protocols.XdgPositionerGravity_enum_left,
+		protocols.XdgPositionerGravity_enum_top_left,
+		protocols.XdgPositionerGravity_enum_bottom_left:
+		box.X = point.X + p.Offset.X - p.Width
+	case protocols.XdgPositionerGravity_enum_right,
+		protocols.XdgPositionerGravity_enum_top_right,
+		protocols.XdgPositionerGravity_enum_bottom_right:
+		box.X = point.X + p.Offset.X
+	}
+	switch gravity {
+	case protocols.XdgPositionerGravity_enum_top,
+		protocols.XdgPositionerGravity_enum_top_left,
+		protocols.XdgPositionerGravity_enum_top_right:
+		box.Y = point.Y + p.Offset.Y - p.Height
+	case protocols.XdgPositionerGravity_enum_bottom,
+		protocols.XdgPositionerGravity_enum_bottom_left,
+		protocols.XdgPositionerGravity_enum_bottom_right:
+		box.Y = point.Y + p.Offset.Y
+	}
+	return box
+}
+
+func flipAnchorX(anchor protocols.XdgPositionerAnchor_enum) protocols.XdgPositionerAnchor_enum {
+	switch anchor {
+	case protocols.XdgPositionerAnchor_enum_left:
+		return protocols.XdgPositionerAnchor_enum_right
+	case protocols.XdgPositionerAnchor_enum_right:
+		return protocols.XdgPositionerAnchor_enum_left
+	case protocols.XdgPositionerAnchor_enum_top_left:
+		return protocols.XdgPositionerAnchor_enum_top_right
+	case protocols.XdgPositionerAnchor_enum_top_right:
+		return protocols.XdgPositionerAnchor_enum_top_left
+	case protocols.XdgPositionerAnchor_enum_bottom_left:
+		return protocols.XdgPositionerAnchor_enum_bottom_right
+	case protocols.XdgPositionerAnchor_enum_bottom_right:
+		return protocols.XdgPositionerAnchor_enum_bottom_left
+	}
+	return anchor
+}
+
+func flipAnchorY(anchor protocols.XdgPositionerAnchor_enum) protocols.XdgPositionerAnchor_enum {
+	switch anchor {
+	case protocols.XdgPositionerAnchor_enum_top:
+		return protocols.XdgPositionerAnchor_enum_bottom
+	case protocols.XdgPositionerAnchor_enum_bottom:
+		return protocols.XdgPositionerAnchor_enum_top
+	case protocols.XdgPositionerAnchor_enum_top_left:
+		return protocols.XdgPositionerAnchor_enum_bottom_left
+	case protocols.XdgPositionerAnchor_enum_bottom_left:
+		return protocols.XdgPositionerAnchor_enum_top_left
+	case protocols.XdgPositionerAnchor_enum_top_right:
+		return protocols.XdgPositionerAnchor_enum_bottom_right
+	case protocols.XdgPositionerAnchor_enum_bottom_right:
+		return protocols.XdgPositionerAnchor_enum_top_right
+	}
+	return anchor
+}
+
+/**
+ * Anchors and gravities have the same values
+ */
+func flipGravityX(gravity protocols.XdgPositionerGravity_enum) protocols.XdgPositionerGravity_enum {
+	return protocols.XdgPositionerGravity_enum(flipAnchorX(protocols.XdgPositionerAnchor_enum(gravity)))
+}
+
+func flipGravityY(gravity protocols.XdgPositionerGravity_enum) protocols.XdgPositionerGravity_enum {
+	return protocols.XdgPositionerGravity_enum(flipAnchorY(protocols.XdgPositionerAnchor_enum(gravity)))
+}
+
+func fitsX(box Rect, bounds Rect) bool {
+	return box.X >= bounds.X && box.X+box.Width <= bounds.X+bounds.Width
+}
+
+func fitsY(box Rect, bounds Rect) bool {
+	return box.Y >= bounds.Y && box.Y+box.Height <= bounds.Y+bounds.Height
+}
+
+/**
+ * Moves start so that [start, start+size) is inside of
+ * [boundsStart, boundsStart+boundsSize), or lines up
+ * with boundsStart if it is too big to fit.
+ */
+func slideInto(start, size, boundsStart, boundsSize int32) int32 {
+	if start+size > boundsStart+boundsSize {
+		start = boundsStart + boundsSize - size
+	}
+	if start < boundsStart {
+		start = boundsStart
+	}
+	return start
+}
+
+/**
+ * Cuts off the part of [start, start+size) outside of bounds
+ */
+func resizeInto(start, size, boundsStart, boundsSize int32) (int32, int32) {
+	end := min(start+size, boundsStart+boundsSize)
+	start = max(start, boundsStart)
+	return start, max(end-start, 1)
+}
+
+/**
+ * The xdg_positioner algorithm. Returns where the popup goes
+ * relative to the parent's window geometry. bounds is the area
+ * the popup has to stay inside (the virtual monitor) in the
+ * same coordinates. The constraint adjustments are tried in
+ * the order from the spec: flip, then slide, then resize.
+ */
+func (p *XdgPositionerState) Place(bounds Rect) Rect {
+	anchor := p.Anchor
+	gravity := p.Gravity
+	box := p.unconstrained(anchor, gravity)
+	adjustment := p.ConstraintAdjustment
+
+	if !fitsX(box, bounds) && adjustment&protocols.XdgPositionerConstraintAdjustment_enum_flip_x != 0 {
+		flipped := p.unconstrained(flipAnchorX(anchor), flipGravityX(gravity))
+		if fitsX(flipped, bounds) {
+			anchor = flipAnchorX(anchor)
+			gravity = flipGravityX(gravity)
+			box.X = flipped.X
+		}
+	}
+	if !fitsY(box, bounds) && adjustment&protocols.XdgPositionerConstraintAdjustment_enum_flip_y != 0 {
+		flipped := p.unconstrained(flipAnchorY(anchor), flipGravityY(gravity))
+		if fitsY(flipped, bounds) {
+			box.Y = flipped.Y
+		}
+	}
+
+	if !fitsX(box, bounds) && adjustment&protocols.XdgPositionerConstraintAdjustment_enum_slide_x != 0 {
+		box.X = slideInto(box.X, box.Width, bounds.X, bounds.Width)
+	}
+	if !fitsY(box, bounds) && adjustment&protocols.XdgPositionerConstraintAdjustment_enum_slide_y != 0 {
+		box.Y = slideInto(box.Y, box.Height, bounds.Y, bounds.Height)
+	}
+
+	if !fitsX(box, bounds) && adjustment&protocols.XdgPositionerConstraintAdjustment_enum_resize_x != 0 {
+		box.X, box.Width = resizeInto(box.X, box.Width, bounds.X, bounds.Width)
+	}
+	if !fitsY(box, bounds) && adjustment&protocols.XdgPositionerConstraintAdjustment_enum_resize_y != 0 {
+		box.Y, box.Height = resizeInto(box.Y, box.Height, bounds.Y, bounds.Height)
+	}
+	return box
+}
@@ -2,7 +2,6 @@ package wayland
 
 import (
 	"fmt"
-	"time"
 
 	"github.com/mmulet/term.everything/wayland/protocols"
 )
@@ -22,8 +21,6 @@ type XdgSurface struct {
 	WindowGeometry XdgWindowGeometry
 }
 
-var GlobalEnterSerial uint32 = 0
-
 // Sends a configure event and waits for the client to ack it. Blocks until ack received.
 func (x *XdgSurface) configure(s protocols.ClientState) {
 	serial := x.LatestSerial
@@ -113,20 +110,28 @@ func (x *XdgSurface) XdgSurface_get_toplevel(
 	}
 
 	surfaceRole.Data = &id
-	AddObject(s, id, MakeXdgToplevel())
+	toplevel := MakeXdgToplevel()
+	AddObject(s, id, toplevel)
 
 	RegisterRoleToSurface(s, id, *surface_id)
 	s.TopLevelSurfaces()[id] = true
 
+	if client, ok := s.(*Client); ok {
+		Focus.ToplevelMapped(&ToplevelRef{
+			Client:     client,
+			ToplevelID: id,
+			SurfaceID:  *surface_id,
+			Toplevel:   toplevel.Delegate.(*XdgToplevel),
+			XdgSurface: x,
+		})
+	}
+
 	protocols.XdgToplevel_configure(
 		s,
 		id,
 		int32(VirtualMonitorSize.Width),
 		int32(VirtualMonitorSize.Height),
-		ToBytes([]protocols.XdgToplevelState_enum{
-			protocols.XdgToplevelState_enum_maximized,
-			protocols.XdgToplevelState_enum_fullscreen,
-		}),
+		ToBytes(toplevel.Delegate.(*XdgToplevel).states(true, true)),
 	)
 
 	// TODO this is necessary, but when?
@@ -139,22 +144,11 @@ func (x *XdgSurface) XdgSurface_get_toplevel(
 			protocols.WlSurface_enter(s, *surface_id, output_id)
 		}
 	}
-	serial := GlobalEnterSerial
-	GlobalEnterSerial += 1
 
-	if keyboard_binds := protocols.GetGlobalWlKeyboardBinds(s); keyboard_binds != nil {
-
-		for keyboard_id, _ := range keyboard_binds {
-			protocols.WlKeyboard_enter(s, keyboard_id, serial, *surface_id, []byte{})
-		}
-	}
-
-	if pointer_binds := protocols.GetGlobalWlPointerBinds(s); pointer_binds != nil {
-		for pointer_id, version := range pointer_binds {
-			protocols.WlPointer_enter(s, pointer_id, serial, *surface_id, Pointer.WindowX, Pointer.WindowY)
-			protocols.WlPointer_frame(s, uint32(version), pointer_id)
-		}
-	}
+	/**
+	 * Pointer focus is given by hit testing (see Focus)
+	 * once the surface has been drawn.
+	 */
 
 	/**
 	 * commented because it
@@ -168,27 +162,6 @@ func (x *XdgSurface) XdgSurface_get_toplevel(
 	//   virtual_monitor_size.width,
 	//   virtual_monitor_size.height
 	// );
-	/**
-	 * So with Xwayland clients, pointer enter doesn't stick?
-	 *
-	 * So let's do it again
-	 * after a timeout
-	 * @TODO where to actually put this?
-	 */
-
-	go func() {
-		time.Sleep(100 * time.Millisecond)
-		if pointer_binds := protocols.GetGlobalWlPointerBinds(s); pointer_binds != nil {
-			for pointer_id, _ := range pointer_binds {
-				pointer := GetWlPointerObject(s, pointer_id)
-				if pointer == nil {
-					continue
-				}
-				protocols.WlPointer_enter(s, pointer_id, 0, *surface_id, pointer.WindowX, pointer.WindowY)
-			}
-		}
-	}()
-
 }
 
 func (x *XdgSurface) XdgSurface_get_popup(
@@ -246,17 +219,14 @@ func (x *XdgSurface) XdgSurface_get_popup(
 	}
 	surfaceRole.Data = &id
 
-	AddObject(s, id, MakeXdgPopup(x.Version, parent, positioner.state))
+	popup := MakeXdgPopup(x.Version, parent, positioner.state)
+	AddObject(s, id, popup)
 
 	RegisterRoleToSurface(s, id, *surface_id)
 
-	protocols.XdgPopup_configure(
-		s,
-		id,
-		0, 0,
-		int32(VirtualMonitorSize.Width),
-		int32(VirtualMonitorSize.Height),
-	)
+	popupState := popup.Delegate.(*XdgPopup)
+	popupState.Geometry = popupState.place(s)
+	popupState.sendConfigure(s, id, popupState.Geometry)
 }
 
 func (x *XdgSurface) XdgSurface_set_window_geometry(
@@ -17,6 +17,10 @@ type XdgToplevel struct {
 
 	Maximized  bool
 	Fullscreen bool
+	/**
+	 * Has the keyboard focus, see Focus
+	 */
+	Activated bool
 
 	MinSize *Size
 	MaxSize *Size
@@ -32,6 +36,9 @@ func (t *XdgToplevel) XdgToplevel_destroy(
 
 	UnregisterRoleToSurface(s, objectID)
 	s.TopLevelSurfaces()[objectID] = false
+	if client, ok := s.(*Client); ok {
+		Focus.ToplevelUnmapped(client, objectID)
+	}
 	if surface != nil {
 		surface.ClearRoleData()
 	}
@@ -39,12 +46,45 @@ func (t *XdgToplevel) XdgToplevel_destroy(
 
 }
 
+/**
+ * Dialogs (toplevels with a parent) get to pick their
+ * own size, and are centered on the monitor.
+ */
 func (t *XdgToplevel) XdgToplevel_set_parent(
-	_ protocols.ClientState,
-	_ protocols.ObjectID[protocols.XdgToplevel],
+	s protocols.ClientState,
+	objectID protocols.ObjectID[protocols.XdgToplevel],
 	parent *protocols.ObjectID[protocols.XdgToplevel],
 ) {
+	if parent != nil && *parent == 0 {
+		parent = nil
+	}
+	hadParent := t.Parent != nil
 	t.Parent = parent
+	if hadParent == (parent != nil) {
+		return
+	}
+	t.Maximized = parent == nil
+	t.Fullscreen = parent == nil
+
+	surface := GetSurfaceFromRole(s, objectID)
+	if surface == nil || surface.XdgSurfaceState == nil {
+		return
+	}
+	xdgSurface := GetXdgSurfaceObject(s, *surface.XdgSurfaceState)
+	if xdgSurface == nil {
+		return
+	}
+	t.sendConfigure(s, objectID, xdgSurface)
+}
+
+/**
+ * 0x0 lets the client pick its size
+ */
+func (t *XdgToplevel) configureSize(maximized bool, fullscreen bool) (int32, int32) {
+	if !maximized && !fullscreen {
+		return 0, 0
+	}
+	return int32(VirtualMonitorSize.Width), int32(VirtualMonitorSize.Height)
 }
 
 func (t *XdgToplevel) XdgToplevel_set_title(
@@ -223,6 +263,20 @@ func (t *XdgToplevel) stateConfiguration(
 		return false
 	}
 
+	width, height := t.configureSize(maximized, fullscreen)
+	protocols.XdgToplevel_configure(
+		s,
+		objectID,
+		width,
+		height,
+		ToBytes(t.states(maximized, fullscreen)),
+	)
+	xdg_surface_State.configure(s)
+
+	return true
+}
+
+func (t *XdgToplevel) states(maximized bool, fullscreen bool) []protocols.XdgToplevelState_enum {
 	var states []protocols.XdgToplevelState_enum
 	if maximized {
 		states = append(states, protocols.XdgToplevelState_enum_maximized)
@@ -230,21 +284,42 @@ func (t *XdgToplevel) stateConfiguration(
 	if fullscreen {
 		states = append(states, protocols.XdgToplevelState_enum_fullscreen)
 	}
+	if t.Activated {
+		states = append(states, protocols.XdgToplevelState_enum_activated)
+	}
+	return states
+}
 
+/**
+ * For state changes the compositor makes on
+ * its own (ie activated), so don't wait for the ack.
+ */
+func (t *XdgToplevel) sendConfigure(
+	s protocols.ClientState,
+	objectID protocols.ObjectID[protocols.XdgToplevel],
+	xdgSurface *XdgSurface,
+) {
+	width, height := t.configureSize(t.Maximized, t.Fullscreen)
 	protocols.XdgToplevel_configure(
 		s,
 		objectID,
-		int32(VirtualMonitorSize.Width),
-		int32(VirtualMonitorSize.Height),
-		ToBytes(states),
+		width,
+		height,
+		ToBytes(t.states(t.Maximized, t.Fullscreen)),
 	)
-	xdg_surface_State.configure(s)
-
-	return true
+	xdgSurface.LatestSerial += 1
+	protocols.XdgSurface_configure(s, xdgSurface.XdgSurfaceID, xdgSurface.LatestSerial)
 }
 
 func MakeXdgToplevel() *protocols.XdgToplevel {
 	return &protocols.XdgToplevel{
-		Delegate: &XdgToplevel{},
+		/**
+		 * Every toplevel starts out taking up the
+		 * whole virtual monitor
+		 */
+		Delegate: &XdgToplevel{
+			Maximized:  true,
+			Fullscreen: true,
+		},
 	}
 }
@@ -0,0 +1,48 @@
+package wayland
+
+import (
+	"github.com/mmulet/term.everything/wayland/protocols"
+)
+
+type ZwpTextInputManagerV3 struct{}
+
+func (m *ZwpTextInputManagerV3) ZwpTextInputManagerV3_destroy(
+	_ protocols.ClientState,
+	_ protocols.ObjectID[protocols.ZwpTextInputManagerV3],
+) bool {
+	return true
+}
+
+func (m *ZwpTextInputManagerV3) ZwpTextInputManagerV3_get_text_input(
+	s protocols.ClientState,
+	_ protocols.ObjectID[protocols.ZwpTextInputManagerV3],
+	id protocols.ObjectID[protocols.ZwpTextInputV3],
+	_ protocols.ObjectID[protocols.WlSeat],
+) {
+	textInput := &ZwpTextInputV3{}
+	AddObject(s, id, &protocols.ZwpTextInputV3{
+		Delegate: textInput,
+	})
+	if client, ok := s.(*Client); ok {
+		Focus.TextInputCreated(&TextInputRef{
+			Client:      client,
+			TextInputID: id,
+			TextInput:   textInput,
+		})
+	}
+}
+
+func (m *ZwpTextInputManagerV3) OnBind(
+	_ protocols.ClientState,
+	_ protocols.AnyObjectID,
+	_ string,
+	_ protocols.AnyObjectID,
+	_ uint32,
+) {
+}
+
+func MakeZwpTextInputManagerV3() *protocols.ZwpTextInputManagerV3 {
+	return &protocols.ZwpTextInputManagerV3{
+		Delegate: &ZwpTextInputManagerV3{},
+	}
+}
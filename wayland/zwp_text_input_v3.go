@@ -0,0 +1,238 @@
+package wayland
+
+import (
+	"slices"
+	"unicode/utf8"
+
+	"github.com/mmulet/term.everything/wayland/protocols"
+)
+
+/**
+ * Lets text that has no key in our keymap (ie é,
+ * CJK or emoji typed in the terminal) go to the
+ * app as commit_string. There is no input method,
+ * so preedit and surrounding text are never used.
+ */
+type ZwpTextInputV3 struct {
+	/**
+	 * The surface from the last enter, nil after leave
+	 */
+	Entered *protocols.ObjectID[protocols.WlSurface]
+
+	Enabled bool
+
+	/**
+	 * enable or disable since the last commit, nil if neither
+	 */
+	pendingEnabled *bool
+
+	/**
+	 * The number of commit requests, sent back in done
+	 */
+	Serial uint32
+}
+
+func (t *ZwpTextInputV3) ZwpTextInputV3_destroy(
+	s protocols.ClientState,
+	objectID protocols.ObjectID[protocols.ZwpTextInputV3],
+) bool {
+	if client, ok := s.(*Client); ok {
+		Focus.TextInputDestroyed(client, objectID)
+	}
+	return true
+}
+
+func (t *ZwpTextInputV3) ZwpTextInputV3_enable(
+	_ protocols.ClientState,
+	_ protocols.ObjectID[protocols.ZwpTextInputV3],
+) {
+	enabled := true
+	t.pendingEnabled = &enabled
+}
+
+func (t *ZwpTextInputV3) ZwpTextInputV3_disable(
+	_ protocols.ClientState,
+	_ protocols.ObjectID[protocols.ZwpTextInputV3],
+) {
+	enabled := false
+	t.pendingEnabled = &enabled
+}
+
+func (t *ZwpTextInputV3) ZwpTextInputV3_set_surrounding_text(
+	_ protocols.ClientState,
+	_ protocols.ObjectID[protocols.ZwpTextInputV3],
+	_ string,
+	_ int32,
+	_ int32,
+) {
+}
+
+func (t *ZwpTextInputV3) ZwpTextInputV3_set_text_change_cause(
+	_ protocols.ClientState,
+	_ protocols.ObjectID[protocols.ZwpTextInputV3],
+	_ protocols.ZwpTextInputV3ChangeCause_enum,
+) {
+}
+
+func (t *ZwpTextInputV3) ZwpTextInputV3_set_content_type(
+	_ protocols.ClientState,
+	_ protocols.ObjectID[protocols.ZwpTextInputV3],
+	_ protocols.ZwpTextInputV3ContentHint_enum,
+	_ protocols.ZwpTextInputV3ContentPurpose_enum,
+) {
+}
+
+func (t *ZwpTextInputV3) ZwpTextInputV3_set_cursor_rectangle(
+	_ protocols.ClientState,
+	_ protocols.ObjectID[protocols.ZwpTextInputV3],
+	_ int32,
+	_ int32,
+	_ int32,
+	_ int32,
+) {
+}
+
+func (t *ZwpTextInputV3) ZwpTextInputV3_commit(
+	_ protocols.ClientState,
+	_ protocols.ObjectID[protocols.ZwpTextInputV3],
+) {
+	t.Serial++
+	if t.pendingEnabled == nil {
+		return
+	}
+	/**
+	 * Requests are ignored between leave and the next enter
+	 */
+	if t.Entered != nil {
+		t.Enabled = *t.pendingEnabled
+	}
+	t.pendingEnabled = nil
+}
+
+func (t *ZwpTextInputV3) OnBind(
+	_ protocols.ClientState,
+	_ protocols.AnyObjectID,
+	_ string,
+	_ protocols.AnyObjectID,
+	_ uint32,
+) {
+}
+
+type TextInputRef struct {
+	Client      *Client
+	TextInputID protocols.ObjectID[protocols.ZwpTextInputV3]
+	TextInput   *ZwpTextInputV3
+}
+
+/**
+ * Text input focus follows the keyboard focus, so
+ * call this whenever keyboardTarget may have changed.
+ */
+func (f *SeatFocus) updateTextInputFocus() {
+	target := f.keyboardTarget()
+	f.TextInputs = slices.DeleteFunc(f.TextInputs, func(t *TextInputRef) bool {
+		return t.Client.Status != ClientStatus_Connected
+	})
+	for _, t := range f.TextInputs {
+		var want *protocols.ObjectID[protocols.WlSurface]
+		if target != nil && target.Client == t.Client {
+			surfaceID := target.SurfaceID
+			want = &surfaceID
+		}
+		f.toClient(t.Client, func() {
+			t.enter(want)
+		})
+	}
+}
+
+/**
+ * Send leave and enter if the text input is not
+ * already on surfaceID, nil leaves. Call with
+ * the client locked.
+ */
+func (t *TextInputRef) enter(surfaceID *protocols.ObjectID[protocols.WlSurface]) {
+	if t.Client.GetObject(protocols.AnyObjectID(t.TextInputID)) == nil {
+		return
+	}
+	entered := t.TextInput.Entered
+	if (entered == nil && surfaceID == nil) || (entered != nil && surfaceID != nil && *entered == *surfaceID) {
+		return
+	}
+	if entered != nil && t.Client.GetObject(protocols.AnyObjectID(*entered)) != nil {
+		protocols.ZwpTextInputV3_leave(t.Client, t.TextInputID, *entered)
+	}
+	t.TextInput.Entered = nil
+	t.TextInput.Enabled = false
+	t.TextInput.pendingEnabled = nil
+	if surfaceID == nil {
+		return
+	}
+	t.TextInput.Entered = surfaceID
+	protocols.ZwpTextInputV3_enter(t.Client, t.TextInputID, *surfaceID)
+}
+
+func (f *SeatFocus) TextInputCreated(textInput *TextInputRef) {
+	defer f.lockFromClient(textInput.Client)()
+	f.TextInputs = append(f.TextInputs, textInput)
+	f.updateTextInputFocus()
+}
+
+func (f *SeatFocus) TextInputDestroyed(client *Client, textInputID protocols.ObjectID[protocols.ZwpTextInputV3]) {
+	defer f.lockFromClient(client)()
+	f.TextInputs = slices.DeleteFunc(f.TextInputs, func(t *TextInputRef) bool {
+		return t.Client == client && t.TextInputID == textInputID
+	})
+}
+
+/**
+ * commit_string has to fit in a wayland message (4096 bytes)
+ */
+const maxCommitStringBytes = 4000
+
+/**
+ * Send text to the enabled text inputs of the surface
+ * with keyboard focus. Returns false if there are none,
+ * then the text has to be typed with keys instead.
+ */
+func (f *SeatFocus) CommitText(text string) bool {
+	defer f.lockWithClients()()
+	target := f.keyboardTarget()
+	if target == nil {
+		return false
+	}
+	sent := false
+	for _, t := range f.TextInputs {
+		if t.Client != target.Client ||
+			!t.TextInput.Enabled ||
+			t.TextInput.Entered == nil ||
+			*t.TextInput.Entered != target.SurfaceID {
+			continue
+		}
+		for _, chunk := range splitUTF8(text, maxCommitStringBytes) {
+			protocols.ZwpTextInputV3_commit_string(t.Client, t.TextInputID, chunk)
+			protocols.ZwpTextInputV3_done(t.Client, t.TextInputID, t.TextInput.Serial)
+		}
+		sent = true
+	}
+	return sent
+}
+
+/**
+ * Split text into pieces of at most size bytes,
+ * without cutting a character in half.
+ */
+func splitUTF8(text string, size int) []string {
+	chunks := make([]string, 0, len(text)/size+1)
+	for len(text) > size {
+		end := size
+		for end > 0 && !utf8.RuneStart(text[end]) {
+			end--
+		}
+		if end == 0 {
+			end = size
+		}
+		chunks = append(chunks, text[:end])
+		text = text[end:]
+	}
+	return append(chunks, text)
+}